@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/demula/mono/apidiff"
+	"github.com/demula/mono/git"
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/semver"
+)
+
+const apicheckUsage = "" +
+	`Running on the root of your monorepo to compare the exported API of every
+module between a previous tag and the working tree:
+	mono apicheck --since="v0.1.0"
+
+Specify the root of your monorepo when not in current directory :
+	mono apicheck --context="./testdata" --since="v0.1.0"
+
+It fails on incompatible changes unless the version to release is a new major
+version (or a new minor version for v0 modules):
+	mono apicheck --since="v0.1.0" "v1.0.0"
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+var ErrIncompatibleAPI = errors.New("incompatible API changes")
+
+var apicheckCommand = &subcommand{
+	Name:          "apicheck",
+	Args:          "[version]",
+	Summary:       "compare the API of the modules against a previous tag",
+	Usage:         apicheckUsage,
+	MaxArgs:       1,
+	ArgsComplete:  []completer{completeVersions},
+	FlagsComplete: map[string]completer{"since": completeTags},
+	Flags: func(fs *flag.FlagSet) builder {
+		since := fs.String("since", "", "git tag (or revision) of the previous release")
+		return func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+			if *since == "" {
+				return nil, fmt.Errorf("%w. missing --since flag", ErrInput)
+			}
+			version := ""
+			if len(args) == 1 {
+				version = args[0]
+				if !semver.IsValid(version) {
+					return nil, fmt.Errorf("%w. invalid version provided", ErrInput)
+				}
+			}
+			return APICheckCmd(g.ContextDir, *since, version, g.IsDebug, flags, args), nil
+		}
+	},
+}
+
+func APICheckCmd(
+	contextDir string,
+	since string,
+	version string,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "apicheck",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			old, err := git.Archive(contextDir, since)
+			if err != nil {
+				return fmt.Errorf("failed to read monorepo at %q: %w", since, err)
+			}
+			err = apicheck(old, vfs.Dir(contextDir), since, version, os.Stdout)
+			if errors.Is(err, ErrNoModulesFound) {
+				return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+			}
+			return err
+		},
+	}
+}
+
+// apicheck prints the API changes of the modules from old to new and fails
+// when there are incompatible ones that version does not allow.
+func apicheck(old, new fs.FS, since, version string, out io.Writer) error {
+	newMods, err := modules.All(vfs.NewOverlay(new), ".")
+	if err != nil {
+		return fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(newMods) == 0 {
+		return ErrNoModulesFound
+	}
+	oldMods, err := modules.All(vfs.NewOverlay(old), ".")
+	if err != nil {
+		return fmt.Errorf("failed to fetch monorepo modules at %q: %w", since, err)
+	}
+	roots := func(ms []*modules.Module) map[string]string {
+		r := make(map[string]string)
+		for _, m := range ms {
+			r[m.Path()] = m.Dir()
+		}
+		return r
+	}
+	oldRoots, newRoots := roots(oldMods), roots(newMods)
+	oldLoader := apidiff.NewLoader(old, oldRoots)
+	newLoader := apidiff.NewLoader(new, newRoots)
+
+	var incompatible []string
+	for _, m := range newMods {
+		newPkgs, err := newLoader.Packages(m.Path())
+		if err != nil {
+			return fmt.Errorf("failed to check %q API: %w", m.Dir(), err)
+		}
+		if _, ok := oldRoots[m.Path()]; !ok {
+			// new modules have no previous API to break
+			continue
+		}
+		oldPkgs, err := oldLoader.Packages(m.Path())
+		if err != nil {
+			return fmt.Errorf("failed to check %q API at %q: %w", m.Dir(), since, err)
+		}
+		r := apidiff.Diff(oldPkgs, newPkgs)
+		err = r.Write(out)
+		if err != nil {
+			return err
+		}
+		if r.Incompatible() {
+			incompatible = append(incompatible, m.Path())
+		}
+	}
+	if len(incompatible) == 0 {
+		return nil
+	}
+	if version != "" && isBreakingAllowed(path.Base(since), version) {
+		return nil
+	}
+	return fmt.Errorf("%w in %s. release a new major version",
+		ErrIncompatibleAPI, strings.Join(incompatible, ", "))
+}
+
+// isBreakingAllowed reports whether going from the previous to the next
+// version can break the API: a new major version or, as v0 makes no
+// compatibility promises, a new v0 minor version.
+func isBreakingAllowed(previous, next string) bool {
+	if !semver.IsValid(previous) || semver.Compare(next, previous) <= 0 {
+		return false
+	}
+	if semver.Major(previous) == "v0" && semver.Major(next) == "v0" {
+		return semver.MajorMinor(next) != semver.MajorMinor(previous)
+	}
+	return semver.Major(next) != semver.Major(previous)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPICheck(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		old      string
+		since    string
+		version  string
+		expected []string
+		errMsg   string
+	}{
+		{
+			name:     "no changes",
+			old:      "./testdata/apicheck/new/",
+			since:    "v1.2.0",
+			version:  "v1.2.1",
+			expected: nil,
+		},
+		{
+			name:     "breaking changes on a patch version",
+			old:      "./testdata/apicheck/old/",
+			since:    "v1.2.0",
+			version:  "v1.2.1",
+			expected: []string{"# example.com/mono/api\n## incompatible changes\n", "# example.com/mono/core\n"},
+			errMsg:   "incompatible API changes in example.com/mono/api. release a new major version",
+		},
+		{
+			name:     "breaking changes without version",
+			old:      "./testdata/apicheck/old/",
+			since:    "v1.2.0",
+			expected: []string{"Removed: removed\n"},
+			errMsg:   "incompatible API changes in example.com/mono/api. release a new major version",
+		},
+		{
+			name:     "breaking changes on a major version",
+			old:      "./testdata/apicheck/old/",
+			since:    "v1.2.0",
+			version:  "v2.0.0",
+			expected: []string{"Removed: removed\n"},
+		},
+		{
+			name:     "breaking changes on a v0 minor version",
+			old:      "./testdata/apicheck/old/",
+			since:    "api/v0.3.1",
+			version:  "v0.4.0",
+			expected: []string{"Removed: removed\n"},
+		},
+		{
+			name:     "since is not a version",
+			old:      "./testdata/apicheck/old/",
+			since:    "main",
+			version:  "v2.0.0",
+			expected: []string{"Removed: removed\n"},
+			errMsg:   "incompatible API changes in example.com/mono/api. release a new major version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			out := &bytes.Buffer{}
+			err := apicheck(os.DirFS(tt.old), os.DirFS("./testdata/apicheck/new/"), tt.since, tt.version, out)
+			if tt.errMsg != "" {
+				if err == nil || err.Error() != tt.errMsg {
+					t.Fatalf("expected error %q, got %v", tt.errMsg, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if tt.expected == nil && out.Len() > 0 {
+				t.Errorf("expected no changes, got:\n%s", out.String())
+			}
+			for _, e := range tt.expected {
+				if !strings.Contains(out.String(), e) {
+					t.Errorf("expected report to contain %q, got:\n%s", e, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestAPICheckCmd(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	err := os.CopyFS(dir, os.DirFS("./testdata/apicheck/old/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, dir, "init", "--quiet")
+	gitRun(t, dir, "config", "user.name", "mono")
+	gitRun(t, dir, "config", "user.email", "mono@example.com")
+	gitRun(t, dir, "add", "--all")
+	gitRun(t, dir, "commit", "--quiet", "--no-gpg-sign", "--message=init")
+	gitRun(t, dir, "tag", "v1.0.0")
+	err = os.CopyFS(filepath.Join(dir, "next"), os.DirFS("./testdata/apicheck/new/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []string{"api", "core"} {
+		err = os.RemoveAll(filepath.Join(dir, m))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Rename(filepath.Join(dir, "next", m), filepath.Join(dir, m))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(since, version string) error {
+		flags := flag.NewFlagSet("apicheck", flag.ContinueOnError)
+		flags.SetOutput(&bytes.Buffer{})
+		return APICheckCmd(dir, since, version, false, flags, nil).Run()
+	}
+
+	err = run("v1.0.0", "v1.1.0")
+	if err == nil || !strings.Contains(err.Error(), "incompatible API changes") {
+		t.Fatalf("expected incompatible API error, got %v", err)
+	}
+	err = run("v1.0.0", "v2.0.0")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	err = run("v0.9.0", "v2.0.0")
+	if err == nil || !strings.Contains(err.Error(), "v0.9.0") {
+		t.Fatalf("expected unknown revision error, got %v", err)
+	}
+}
+
+func TestIsBreakingAllowed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		previous string
+		next     string
+		expected bool
+	}{
+		{previous: "v1.2.0", next: "v2.0.0", expected: true},
+		{previous: "v1.2.0", next: "v1.3.0", expected: false},
+		{previous: "v1.2.0", next: "v1.2.1", expected: false},
+		{previous: "v2.0.0", next: "v1.0.0", expected: false},
+		{previous: "v0.2.0", next: "v0.3.0", expected: true},
+		{previous: "v0.2.0", next: "v0.2.1", expected: false},
+		{previous: "v0.2.0", next: "v1.0.0", expected: true},
+		{previous: "main", next: "v1.0.0", expected: false},
+	}
+	for _, tt := range tests {
+		actual := isBreakingAllowed(tt.previous, tt.next)
+		if actual != tt.expected {
+			t.Errorf("expected %s -> %s allowed to be %t", tt.previous, tt.next, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,652 @@
+// Package apidiff reports the changes between two versions of the exported
+// API of the monorepo modules, the way golang.org/x/exp/apidiff does.
+//
+// Packages are type-checked from source with go/types. Imports of monorepo
+// modules are resolved in the same filesystem and the standard library with
+// the default importer. External dependencies are not read: every identifier
+// selected from them is declared as an opaque named type, so their types are
+// compared by package and name only and their methods and fields are unknown.
+package apidiff
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// Change is a difference found in the API of a package.
+type Change struct {
+	Package string
+	// Name is the changed identifier, empty when the whole package changed.
+	Name       string
+	Message    string
+	Compatible bool
+}
+
+func (c Change) String() string {
+	if c.Name == "" {
+		return "package " + c.Message
+	}
+	return c.Name + ": " + c.Message
+}
+
+// Report holds the changes of a module API sorted by package.
+type Report struct {
+	Changes []Change
+}
+
+// Incompatible reports whether any change breaks the clients of the API.
+func (r Report) Incompatible() bool {
+	return slices.ContainsFunc(r.Changes, func(c Change) bool { return !c.Compatible })
+}
+
+// Write prints the changes of every package as gorelease does.
+func (r Report) Write(w io.Writer) error {
+	var pkgs []string
+	for _, c := range r.Changes {
+		if !slices.Contains(pkgs, c.Package) {
+			pkgs = append(pkgs, c.Package)
+		}
+	}
+	for _, p := range pkgs {
+		_, err := fmt.Fprintf(w, "# %s\n", p)
+		if err != nil {
+			return err
+		}
+		for _, compatible := range []bool{false, true} {
+			header := "## incompatible changes\n"
+			if compatible {
+				header = "## compatible changes\n"
+			}
+			for _, c := range r.Changes {
+				if c.Package != p || c.Compatible != compatible {
+					continue
+				}
+				if header != "" {
+					_, err = io.WriteString(w, header)
+					if err != nil {
+						return err
+					}
+					header = ""
+				}
+				_, err = fmt.Fprintln(w, c)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Loader type-checks the packages of the monorepo modules in a filesystem.
+// Checked packages are cached so a Loader is not safe for concurrent use.
+type Loader struct {
+	fsys fs.FS
+	// roots maps the module paths to their directory in fsys.
+	roots map[string]string
+	fset  *token.FileSet
+	ctx   build.Context
+	std   types.Importer
+	pkgs  map[string]*types.Package
+}
+
+// NewLoader returns a Loader for the modules of fsys. roots maps every module
+// path to its directory.
+func NewLoader(fsys fs.FS, roots map[string]string) *Loader {
+	ctx := build.Default
+	ctx.CgoEnabled = false
+	ctx.JoinPath = path.Join
+	ctx.IsAbsPath = path.IsAbs
+	ctx.IsDir = func(name string) bool {
+		info, err := fs.Stat(fsys, name)
+		return err == nil && info.IsDir()
+	}
+	ctx.ReadDir = func(dir string) ([]fs.FileInfo, error) {
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			return nil, err
+		}
+		infos := make([]fs.FileInfo, 0, len(entries))
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+		return infos, nil
+	}
+	ctx.OpenFile = func(name string) (io.ReadCloser, error) {
+		return fsys.Open(name)
+	}
+	return &Loader{
+		fsys:  fsys,
+		roots: roots,
+		fset:  token.NewFileSet(),
+		ctx:   ctx,
+		std:   importer.Default(),
+		pkgs:  make(map[string]*types.Package),
+	}
+}
+
+// Packages returns the packages of the module that other modules can import,
+// keyed by import path. Commands, internal and test data packages are left out.
+func (l *Loader) Packages(modPath string) (map[string]*types.Package, error) {
+	root, ok := l.roots[modPath]
+	if !ok {
+		return nil, fmt.Errorf("unknown module %q", modPath)
+	}
+	pkgs := make(map[string]*types.Package)
+	err := fs.WalkDir(l.fsys, root, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if dir != root {
+			name := d.Name()
+			if name == "testdata" || name == "vendor" || name == "internal" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return fs.SkipDir
+			}
+			// nested modules are not part of this one
+			_, err := fs.Stat(l.fsys, path.Join(dir, "go.mod"))
+			if err == nil {
+				return fs.SkipDir
+			}
+		}
+		importPath := modPath
+		if dir != root {
+			importPath = path.Join(modPath, strings.TrimPrefix(dir, root+"/"))
+		}
+		pkg, err := l.load(importPath, dir)
+		if errors.Is(err, errNoPackage) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if pkg.Name() != "main" {
+			pkgs[importPath] = pkg
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+var errNoPackage = errors.New("no go files")
+
+// Import implements types.Importer.
+func (l *Loader) Import(importPath string) (*types.Package, error) {
+	if pkg, ok := l.pkgs[importPath]; ok {
+		return pkg, nil
+	}
+	if dir, ok := l.dir(importPath); ok {
+		pkg, err := l.load(importPath, dir)
+		if err == nil {
+			return pkg, nil
+		}
+		if !errors.Is(err, errNoPackage) {
+			return nil, err
+		}
+	} else if !isExternal(importPath) {
+		return l.std.Import(importPath)
+	}
+	return l.stub(importPath), nil
+}
+
+// isExternal reports whether the import path is outside the standard library.
+func isExternal(importPath string) bool {
+	return strings.Contains(strings.Split(importPath, "/")[0], ".")
+}
+
+// stub returns the empty package standing for an external dependency.
+func (l *Loader) stub(importPath string) *types.Package {
+	if pkg, ok := l.pkgs[importPath]; ok {
+		return pkg
+	}
+	pkg := types.NewPackage(importPath, packageName(importPath))
+	pkg.MarkComplete()
+	l.pkgs[importPath] = pkg
+	return pkg
+}
+
+// declareExternal declares in the stubs of the external dependencies imported
+// by files every identifier the files select from them, as a named type.
+func (l *Loader) declareExternal(files []*ast.File) {
+	for _, f := range files {
+		stubs := make(map[string]*types.Package)
+		for _, spec := range f.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || !isExternal(importPath) {
+				continue
+			}
+			if _, ok := l.dir(importPath); ok {
+				continue
+			}
+			name := packageName(importPath)
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			if name != "_" && name != "." {
+				stubs[name] = l.stub(importPath)
+			}
+		}
+		if len(stubs) == 0 {
+			continue
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			x, ok := sel.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			pkg, ok := stubs[x.Name]
+			if !ok || !sel.Sel.IsExported() || pkg.Scope().Lookup(sel.Sel.Name) != nil {
+				return true
+			}
+			obj := types.NewTypeName(token.NoPos, pkg, sel.Sel.Name, nil)
+			types.NewNamed(obj, types.NewInterfaceType(nil, nil), nil)
+			pkg.Scope().Insert(obj)
+			return true
+		})
+	}
+}
+
+// dir returns the directory of the import path when it belongs to a module.
+func (l *Loader) dir(importPath string) (string, bool) {
+	best := ""
+	for modPath := range l.roots {
+		if (importPath == modPath || strings.HasPrefix(importPath, modPath+"/")) && len(modPath) > len(best) {
+			best = modPath
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return path.Join(l.roots[best], strings.TrimPrefix(importPath, best)), true
+}
+
+func (l *Loader) load(importPath, dir string) (*types.Package, error) {
+	if pkg, ok := l.pkgs[importPath]; ok {
+		return pkg, nil
+	}
+	bp, err := l.ctx.ImportDir(dir, 0)
+	var noGo *build.NoGoError
+	if errors.As(err, &noGo) {
+		return nil, errNoPackage
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package %q: %w", importPath, err)
+	}
+	files := make([]*ast.File, 0, len(bp.GoFiles))
+	for _, name := range bp.GoFiles {
+		data, err := fs.ReadFile(l.fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(l.fset, path.Join(dir, name), data, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse package %q: %w", importPath, err)
+		}
+		files = append(files, f)
+	}
+	l.declareExternal(files)
+	conf := types.Config{
+		Importer:    l,
+		FakeImportC: true,
+		// the members of external dependencies are unknown
+		Error: func(err error) {
+			slog.Debug("type checking error", slog.String("error", err.Error()))
+		},
+	}
+	pkg, _ := conf.Check(importPath, l.fset, files, nil)
+	l.pkgs[importPath] = pkg
+	return pkg, nil
+}
+
+// packageName guesses the name of a package that can not be read.
+func packageName(importPath string) string {
+	prefix, _, ok := module.SplitPathVersion(importPath)
+	if ok && prefix != "" {
+		importPath = prefix
+	}
+	return strings.NewReplacer("-", "_", ".", "_").Replace(path.Base(importPath))
+}
+
+// Diff returns the API changes from the old to the new packages.
+func Diff(old, new map[string]*types.Package) Report {
+	var paths []string
+	for p := range old {
+		paths = append(paths, p)
+	}
+	for p := range new {
+		if _, ok := old[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	slices.Sort(paths)
+
+	var r Report
+	for _, p := range paths {
+		o, n := old[p], new[p]
+		switch {
+		case n == nil:
+			r.Changes = append(r.Changes, Change{Package: p, Message: "removed"})
+		case o == nil:
+			r.Changes = append(r.Changes, Change{Package: p, Message: "added", Compatible: true})
+		default:
+			d := &differ{pkg: p}
+			d.packages(o, n)
+			r.Changes = append(r.Changes, d.changes...)
+		}
+	}
+	return r
+}
+
+type differ struct {
+	pkg     string
+	changes []Change
+}
+
+func (d *differ) incompatible(name, format string, a ...any) {
+	d.changes = append(d.changes, Change{Package: d.pkg, Name: name, Message: fmt.Sprintf(format, a...)})
+}
+
+func (d *differ) compatible(name, format string, a ...any) {
+	d.changes = append(d.changes, Change{Package: d.pkg, Name: name, Message: fmt.Sprintf(format, a...), Compatible: true})
+}
+
+// qualifier prints other packages by name and the compared one unqualified.
+func (d *differ) qualifier(p *types.Package) string {
+	if p.Path() == d.pkg {
+		return ""
+	}
+	return p.Name()
+}
+
+func (d *differ) str(t types.Type) string {
+	return types.TypeString(t, d.qualifier)
+}
+
+// same reports whether the types print the same without the names of the
+// function parameters and results, as renaming them keeps the API.
+func (d *differ) same(old, new types.Type) bool {
+	return d.str(unnamed(old)) == d.str(unnamed(new))
+}
+
+// unnamed returns t with the names of its function parameters and results
+// dropped. Named types are kept as they print by name.
+func unnamed(t types.Type) types.Type {
+	switch t := t.(type) {
+	case *types.Signature:
+		vars := func(tuple *types.Tuple) *types.Tuple {
+			var vs []*types.Var
+			for v := range tuple.Variables() {
+				vs = append(vs, types.NewParam(v.Pos(), v.Pkg(), "", unnamed(v.Type())))
+			}
+			return types.NewTuple(vs...)
+		}
+		// type parameters are bound to a single signature
+		var tps []*types.TypeParam
+		for tp := range t.TypeParams().TypeParams() {
+			obj := types.NewTypeName(tp.Obj().Pos(), tp.Obj().Pkg(), tp.Obj().Name(), nil)
+			tps = append(tps, types.NewTypeParam(obj, tp.Constraint()))
+		}
+		return types.NewSignatureType(nil, nil, tps, vars(t.Params()), vars(t.Results()), t.Variadic())
+	case *types.Pointer:
+		return types.NewPointer(unnamed(t.Elem()))
+	case *types.Slice:
+		return types.NewSlice(unnamed(t.Elem()))
+	case *types.Array:
+		return types.NewArray(unnamed(t.Elem()), t.Len())
+	case *types.Map:
+		return types.NewMap(unnamed(t.Key()), unnamed(t.Elem()))
+	case *types.Chan:
+		return types.NewChan(t.Dir(), unnamed(t.Elem()))
+	}
+	return t
+}
+
+func (d *differ) packages(old, new *types.Package) {
+	for _, name := range old.Scope().Names() {
+		o := old.Scope().Lookup(name)
+		if !o.Exported() {
+			continue
+		}
+		n := new.Scope().Lookup(name)
+		if n == nil || !n.Exported() {
+			d.incompatible(name, "removed")
+			continue
+		}
+		d.objects(name, o, n)
+	}
+	for _, name := range new.Scope().Names() {
+		n := new.Scope().Lookup(name)
+		if n.Exported() && old.Scope().Lookup(name) == nil {
+			d.compatible(name, "added")
+		}
+	}
+}
+
+func (d *differ) objects(name string, old, new types.Object) {
+	switch o := old.(type) {
+	case *types.Const:
+		n, ok := new.(*types.Const)
+		if !ok {
+			d.incompatible(name, "changed from %s to %s", d.kind(old), d.kind(new))
+			return
+		}
+		if !d.same(o.Type(), n.Type()) {
+			d.incompatible(name, "changed from %s to %s", d.str(o.Type()), d.str(n.Type()))
+			return
+		}
+		if o.Val().ExactString() != n.Val().ExactString() {
+			d.incompatible(name, "value changed from %s to %s", o.Val(), n.Val())
+		}
+	case *types.Var, *types.Func:
+		switch {
+		case fmt.Sprintf("%T", old) != fmt.Sprintf("%T", new):
+			d.incompatible(name, "changed from %s to %s", d.kind(old), d.kind(new))
+		case !d.same(old.Type(), new.Type()):
+			d.incompatible(name, "changed from %s to %s", d.str(old.Type()), d.str(new.Type()))
+		}
+	case *types.TypeName:
+		n, ok := new.(*types.TypeName)
+		if !ok {
+			d.incompatible(name, "changed from %s to %s", d.kind(old), d.kind(new))
+			return
+		}
+		d.types(name, o, n)
+	}
+}
+
+// kind describes the object for messages.
+func (d *differ) kind(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Const:
+		return "const " + d.str(obj.Type())
+	case *types.Var:
+		return "var " + d.str(obj.Type())
+	case *types.Func:
+		return d.str(obj.Type())
+	case *types.TypeName:
+		return "type " + d.str(obj.Type().Underlying())
+	}
+	return obj.String()
+}
+
+func (d *differ) types(name string, old, new *types.TypeName) {
+	ot, nt := old.Type(), new.Type()
+	if tparams(ot) != tparams(nt) {
+		d.incompatible(name, "changed type parameters from [%s] to [%s]", tparams(ot), tparams(nt))
+		return
+	}
+	switch ou := ot.Underlying().(type) {
+	case *types.Struct:
+		nu, ok := nt.Underlying().(*types.Struct)
+		if !ok {
+			d.incompatible(name, "changed from struct to %s", d.str(nt.Underlying()))
+			return
+		}
+		d.structs(name, ou, nu)
+	case *types.Interface:
+		nu, ok := nt.Underlying().(*types.Interface)
+		if !ok {
+			d.incompatible(name, "changed from interface to %s", d.str(nt.Underlying()))
+			return
+		}
+		d.interfaces(name, ou, nu)
+		return
+	default:
+		if !d.same(ou, nt.Underlying()) {
+			d.incompatible(name, "changed from %s to %s", d.str(ou), d.str(nt.Underlying()))
+			return
+		}
+	}
+	d.methods(name, ot, nt)
+}
+
+func tparams(t types.Type) string {
+	named, ok := t.(*types.Named)
+	if !ok || named.TypeParams() == nil {
+		return ""
+	}
+	var ps []string
+	for i := range named.TypeParams().Len() {
+		p := named.TypeParams().At(i)
+		ps = append(ps, p.Obj().Name()+" "+p.Constraint().String())
+	}
+	return strings.Join(ps, ", ")
+}
+
+func (d *differ) structs(name string, old, new *types.Struct) {
+	fields := func(s *types.Struct) map[string]*types.Var {
+		fs := make(map[string]*types.Var)
+		for f := range s.Fields() {
+			if f.Exported() {
+				fs[f.Name()] = f
+			}
+		}
+		return fs
+	}
+	of, nf := fields(old), fields(new)
+	for f := range old.Fields() {
+		if !f.Exported() {
+			continue
+		}
+		n, ok := nf[f.Name()]
+		if !ok {
+			d.incompatible(name+"."+f.Name(), "removed")
+			continue
+		}
+		if !d.same(f.Type(), n.Type()) {
+			d.incompatible(name+"."+f.Name(), "changed from %s to %s", d.str(f.Type()), d.str(n.Type()))
+		}
+	}
+	for f := range new.Fields() {
+		if _, ok := of[f.Name()]; f.Exported() && !ok {
+			d.compatible(name+"."+f.Name(), "added")
+		}
+	}
+}
+
+func (d *differ) interfaces(name string, old, new *types.Interface) {
+	methods := func(i *types.Interface) map[string]*types.Func {
+		ms := make(map[string]*types.Func)
+		for m := range i.Methods() {
+			ms[m.Name()] = m
+		}
+		return ms
+	}
+	om, nm := methods(old), methods(new)
+	// only the package can implement interfaces with unexported methods
+	sealed := false
+	for m := range old.Methods() {
+		if !m.Exported() {
+			sealed = true
+		}
+		n, ok := nm[m.Name()]
+		if !ok {
+			d.incompatible(name+"."+m.Name(), "removed")
+			continue
+		}
+		if !d.same(m.Type(), n.Type()) {
+			d.incompatible(name+"."+m.Name(), "changed from %s to %s", d.str(m.Type()), d.str(n.Type()))
+		}
+	}
+	for m := range new.Methods() {
+		if _, ok := om[m.Name()]; ok {
+			continue
+		}
+		if sealed {
+			d.compatible(name+"."+m.Name(), "added")
+		} else {
+			d.incompatible(name+"."+m.Name(), "added")
+		}
+	}
+}
+
+// methods compares the exported method sets of the pointers to the types and
+// then the ones of the types themselves, as moving a method from a value to a
+// pointer receiver removes it from the type method set.
+func (d *differ) methods(name string, old, new types.Type) {
+	ms := types.NewMethodSet(types.NewPointer(new))
+	seen := make(map[string]bool)
+	for sel := range types.NewMethodSet(types.NewPointer(old)).Methods() {
+		m := sel.Obj()
+		if !m.Exported() {
+			continue
+		}
+		seen[m.Name()] = true
+		n := ms.Lookup(nil, m.Name())
+		if n == nil {
+			d.incompatible(name+"."+m.Name(), "removed")
+			continue
+		}
+		if !d.same(m.Type(), n.Obj().Type()) {
+			d.incompatible(name+"."+m.Name(), "changed from %s to %s", d.str(m.Type()), d.str(n.Obj().Type()))
+		}
+	}
+	for sel := range ms.Methods() {
+		if m := sel.Obj(); m.Exported() && !seen[m.Name()] {
+			d.compatible(name+"."+m.Name(), "added")
+		}
+	}
+
+	ovs, nvs := types.NewMethodSet(old), types.NewMethodSet(new)
+	for sel := range ovs.Methods() {
+		m := sel.Obj()
+		if m.Exported() && nvs.Lookup(nil, m.Name()) == nil && ms.Lookup(nil, m.Name()) != nil {
+			d.incompatible(name+"."+m.Name(), "changed from value to pointer receiver")
+		}
+	}
+	for sel := range nvs.Methods() {
+		m := sel.Obj()
+		if m.Exported() && seen[m.Name()] && ovs.Lookup(nil, m.Name()) == nil {
+			d.compatible(name+"."+m.Name(), "changed from pointer to value receiver")
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package apidiff_test
+
+import (
+	"bytes"
+	"go/types"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/demula/mono/apidiff"
+)
+
+var roots = map[string]string{
+	"example.com/mono/api":  "api",
+	"example.com/mono/core": "core",
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		module       string
+		expected     string
+		incompatible bool
+	}{
+		{
+			module: "example.com/mono/api",
+			expected: `# example.com/mono/api
+## incompatible changes
+Greeter.Close: added
+Hello.Lang: removed
+Removed: removed
+Say: changed from func(h Hello) string to func(h Hello, lang string) string
+Version: value changed from 1 to 2
+## compatible changes
+Client.Close: added
+Hello.Age: added
+# example.com/mono/api/extra
+## compatible changes
+package added
+`,
+			incompatible: true,
+		},
+		{
+			module: "example.com/mono/core",
+			expected: `# example.com/mono/core
+## compatible changes
+Sayer.Say: added
+`,
+		},
+	}
+
+	// loaders cache the checked packages and are not safe for concurrent use
+	old := apidiff.NewLoader(os.DirFS("../testdata/apicheck/old"), roots)
+	new := apidiff.NewLoader(os.DirFS("../testdata/apicheck/new"), roots)
+	for _, tt := range tests {
+		t.Run(tt.module, func(t *testing.T) {
+			o, err := old.Packages(tt.module)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			n, err := new.Packages(tt.module)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			r := apidiff.Diff(o, n)
+			out := &bytes.Buffer{}
+			err = r.Write(out)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("unexpected report.\nexpected:\n%s\ngot:\n%s", tt.expected, out.String())
+			}
+			if r.Incompatible() != tt.incompatible {
+				t.Errorf("expected incompatible %t, got %t", tt.incompatible, r.Incompatible())
+			}
+		})
+	}
+}
+
+func TestDiffSources(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{
+		{
+			name: "external types",
+			old: `package api
+
+import (
+	"example.com/dep"
+	ext "example.com/other/v2"
+)
+
+func F(x dep.A) ext.Result { return nil }
+
+func G(x dep.A) {}
+`,
+			new: `package api
+
+import (
+	"example.com/dep"
+	ext "example.com/other/v2"
+)
+
+func F(x dep.B) ext.Result { return nil }
+
+func G(x dep.A) {}
+`,
+			expected: `# example.com/mono/api
+## incompatible changes
+F: changed from func(x dep.A) other.Result to func(x dep.B) other.Result
+`,
+		},
+		{
+			name: "receivers",
+			old: `package api
+
+type T struct{}
+
+func (T) M() {}
+
+func (*T) N() {}
+
+func (T) O() {}
+`,
+			new: `package api
+
+type T struct{}
+
+func (*T) M() {}
+
+func (T) N() {}
+
+func (T) O() {}
+`,
+			expected: `# example.com/mono/api
+## incompatible changes
+T.M: changed from value to pointer receiver
+## compatible changes
+T.N: changed from pointer to value receiver
+`,
+		},
+		{
+			name: "parameter names",
+			old: `package api
+
+type T struct{}
+
+func (T) M(a int) (n int, err error) { return 0, nil }
+
+func F(a int, f func(x string)) {}
+
+func G[E any](xs ...E) {}
+`,
+			new: `package api
+
+type T struct{}
+
+func (T) M(b int) (int, error) { return 0, nil }
+
+func F(b int, f func(y string)) {}
+
+func G[E any](ys ...E) {}
+
+func H(a int) {}
+`,
+			expected: `# example.com/mono/api
+## compatible changes
+H: added
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			roots := map[string]string{"example.com/mono/api": "api"}
+			load := func(src string) map[string]*types.Package {
+				fsys := fstest.MapFS{
+					"api/go.mod": {Data: []byte("module example.com/mono/api\n")},
+					"api/api.go": {Data: []byte(src)},
+				}
+				pkgs, err := apidiff.NewLoader(fsys, roots).Packages("example.com/mono/api")
+				if err != nil {
+					t.Fatalf("unexpected error %q", err)
+				}
+				return pkgs
+			}
+			out := &bytes.Buffer{}
+			err := apidiff.Diff(load(tt.old), load(tt.new)).Write(out)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("unexpected report.\nexpected:\n%s\ngot:\n%s", tt.expected, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/demula/mono/gosum"
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+)
+
+const checkUsage = "" +
+	`Running on the root of your monorepo to validate its go.sum files:
+	mono check
+
+Specify the root of your monorepo when not in current directory :
+	mono check --context="./testdata"
+
+Every problem found is reported with its file and line number:
+	core/go.sum:3: malformed line: expected 3 fields, found 2
+
+Modules that would be published without a license or notice file are
+warned about. The recognised file names can be changed with:
+	mono check --license-files="LICENSE,COPYING"
+
+Modules depending on a deprecated sibling, while not deprecated themselves,
+are warned about too.
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+var ErrCheckFailed = errors.New("check failed")
+
+var checkCommand = &subcommand{
+	Name:    "check",
+	Summary: "validate the go.sum files, licenses and deprecated requirements",
+	Usage:   checkUsage,
+	Flags: func(fs *flag.FlagSet) builder {
+		licenseFiles := fs.String("license-files", strings.Join(modules.LicenseFiles, ","),
+			"comma separated license and notice file names")
+		return func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+			return CheckCmd(g.ContextDir, licenseNames(*licenseFiles), g.IsDebug, flags, args), nil
+		}
+	},
+}
+
+// licenseNames returns the comma separated file names of list leaving out
+// the empty ones.
+func licenseNames(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool { return r == ',' })
+}
+
+func CheckCmd(
+	contextDir string,
+	licenseFiles []string,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "check",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			err := check(vfs.Dir(contextDir), licenseFiles, flags.Output())
+			if err != nil {
+				if errors.Is(err, ErrNoModulesFound) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+func check(fsys vfs.FS, licenseFiles []string, out io.Writer) error {
+	ms, err := modules.AllLicensed(fsys, ".", licenseFiles)
+	if err != nil {
+		return fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return ErrNoModulesFound
+	}
+	problems := 0
+	for _, m := range ms {
+		err = modules.CheckGoSum(m)
+		var errs gosum.ErrorList
+		if errors.As(err, &errs) {
+			for _, e := range errs {
+				_, pErr := fmt.Fprintln(out, e)
+				if pErr != nil {
+					return pErr
+				}
+			}
+			problems += len(errs)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check %q go.sum: %w", m.Dir(), err)
+		}
+	}
+	unlicensed, err := unlicensed(ms, licenseFiles)
+	if err != nil {
+		return err
+	}
+	for _, m := range unlicensed {
+		slog.Warn("module would be published without a license",
+			slog.String("module", m.Path()),
+			slog.String("looked-for", strings.Join(licenseFiles, ", ")),
+		)
+	}
+	for _, d := range deprecatedDeps(ms) {
+		slog.Warn("module depends on a deprecated sibling",
+			slog.String("module", d.Module.Path()),
+			slog.String("sibling", d.Sibling.Path()),
+			slog.String("deprecated", d.Sibling.Deprecated()),
+		)
+	}
+	if problems > 0 {
+		return fmt.Errorf("%w: %d problems found", ErrCheckFailed, problems)
+	}
+	slog.Info("all modules checked")
+	return nil
+}
+
+// unlicensed returns the modules whose zip would not hold any of the license
+// files.
+func unlicensed(ms []*modules.Module, licenseFiles []string) ([]*modules.Module, error) {
+	var found []*modules.Module
+	for _, m := range ms {
+		licenses, err := modules.Licenses(m, licenseFiles)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look for %q licenses: %w", m.Dir(), err)
+		}
+		if len(licenses) == 0 {
+			found = append(found, m)
+		}
+	}
+	return found, nil
+}
+
+// deprecatedDep is a requirement on a deprecated sibling.
+type deprecatedDep struct {
+	Module  *modules.Module
+	Sibling *modules.Module
+}
+
+// deprecatedDeps returns the requirements of modules that are not deprecated
+// on deprecated siblings.
+func deprecatedDeps(ms []*modules.Module) []deprecatedDep {
+	var found []deprecatedDep
+	for _, m := range ms {
+		if m.Deprecated() != "" {
+			continue
+		}
+		for _, r := range m.File.Require {
+			for _, s := range ms {
+				if s.Path() == r.Mod.Path && s.Deprecated() != "" {
+					found = append(found, deprecatedDep{Module: m, Sibling: s})
+				}
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		context  string
+		expected []string
+		errMsg   string
+	}{
+		{
+			name:    "golden",
+			context: "./testdata/golden/",
+		},
+		{
+			name:    "from development",
+			context: "./testdata/dev-commits/",
+		},
+		{
+			name:    "no modules found",
+			context: "./testdata/empty/",
+			errMsg:  "no modules found",
+		},
+		{
+			name:    "corrupt core go.sum",
+			context: "./testdata/corrupt-gosum/",
+			expected: []string{
+				"core/go.sum:3: malformed line: expected 3 fields, found 2",
+				"core/go.sum:4: duplicate line: already on line 1",
+				"core/go.sum:5: malformed line: expected 3 fields, found 1",
+				"core/go.sum:6: invalid module path: malformed module path",
+				"core/go.sum:7: non-canonical version \"v1.0\"",
+				"core/go.sum:8: unknown hash algorithm \"h2\"",
+				"core/go.sum:9: malformed hash",
+				"core/go.sum:10: obsolete empty go.mod hash",
+				"core/go.sum:11: malformed line: expected 3 fields, found 2",
+			},
+			errMsg: "check failed: 9 problems found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			out := &bytes.Buffer{}
+			err := check(vfs.Dir(tt.context), modules.LicenseFiles, out)
+			if tt.errMsg != "" {
+				if err == nil {
+					t.Fatalf("expected error %q", tt.errMsg)
+				}
+				if !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("error %q does not match expected error %q", err, tt.errMsg)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(tt.expected) == 0 {
+				if out.Len() != 0 {
+					t.Errorf("unexpected output:\n%s", out.String())
+				}
+				return
+			}
+			if len(lines) != len(tt.expected) {
+				t.Fatalf("expected %d problems, got:\n%s", len(tt.expected), out.String())
+			}
+			for i, e := range tt.expected {
+				if !strings.HasPrefix(lines[i], e) {
+					t.Errorf("problem %d does not match.\nexpected: %s\ngot: %s", i, e, lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUnlicensed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		context      string
+		licenseFiles []string
+		expected     int
+	}{
+		{
+			name:         "without license",
+			context:      "./testdata/golden/",
+			licenseFiles: modules.LicenseFiles,
+			expected:     4,
+		},
+		{
+			name:         "with root license",
+			context:      "./testdata/golden-license/",
+			licenseFiles: modules.LicenseFiles,
+		},
+		{
+			name:         "with root license not recognised",
+			context:      "./testdata/golden-license/",
+			licenseFiles: []string{"COPYING"},
+			expected:     4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ms, err := modules.AllLicensed(vfs.Dir(tt.context), ".", tt.licenseFiles)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			actual, err := unlicensed(ms, tt.licenseFiles)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if len(actual) != tt.expected {
+				t.Errorf("expected %d modules without license, got %d", tt.expected, len(actual))
+			}
+		})
+	}
+}
+
+func TestLicenseNames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		list     string
+		expected []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "empty names left out",
+			list:     ",LICENSE,,COPYING,",
+			expected: []string{"LICENSE", "COPYING"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual := licenseNames(tt.list)
+			if !slices.Equal(actual, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDeprecatedDeps(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		deprecated []string
+		expected   []string
+	}{
+		{
+			name: "nothing deprecated",
+		},
+		{
+			name:       "dependents of deprecated module",
+			deprecated: []string{"api"},
+			expected: []string{
+				"github.com/demula/mono-example/cli -> github.com/demula/mono-example/api",
+				"github.com/demula/mono-example/core -> github.com/demula/mono-example/api",
+				"github.com/demula/mono-example/server -> github.com/demula/mono-example/api",
+			},
+		},
+		{
+			name:       "deprecated dependents",
+			deprecated: []string{"api", "core", "cli", "server"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fsys := vfs.NewOverlay(os.DirFS("./testdata/golden/"))
+			for _, d := range tt.deprecated {
+				err := deprecate(fsys, d, "use the v2 modules")
+				if err != nil {
+					t.Fatalf("unexpected error %q", err)
+				}
+			}
+			ms, err := modules.All(fsys, ".")
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			var actual []string
+			for _, d := range deprecatedDeps(ms) {
+				actual = append(actual, d.Module.Path()+" -> "+d.Sibling.Path())
+			}
+			if !slices.Equal(actual, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
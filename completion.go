@@ -0,0 +1,358 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/demula/mono/git"
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/semver"
+)
+
+const completionUsage = "" +
+	`Print the shell completion script for bash, zsh, fish or powershell. The
+scripts ask mono for the candidates, so modules and tags are completed from
+the monorepo in --context (or the current directory).
+
+Load the completion in the current bash shell:
+	source <(mono completion bash)
+
+or in zsh, fish and powershell:
+	source <(mono completion zsh)
+	mono completion fish | source
+	mono completion powershell | Out-String | Invoke-Expression
+
+Add the line to your shell profile to load it in every new shell.
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+// completeName is the hidden subcommand the completion scripts call with
+// the words typed so far, the last one being completed. It prints the
+// candidates one per line.
+const completeName = "__complete"
+
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// completion is the state of the command line being completed.
+type completion struct {
+	ContextDir string
+	// Args are the positional arguments before the one being completed.
+	Args []string
+	// Current is the word being completed.
+	Current string
+}
+
+// completer returns the candidates of an argument or flag value. They are
+// filtered by the word being completed afterwards.
+type completer func(c completion) []string
+
+var completionCommand = &subcommand{
+	Name:        "completion",
+	Args:        "<" + strings.Join(completionShells, "|") + ">",
+	Summary:     "print the shell completion script",
+	Usage:       completionUsage,
+	MinArgs:     1,
+	MaxArgs:     1,
+	MissingArgs: "missing shell argument",
+	Flags: noFlags(func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+		if !slices.Contains(completionShells, args[0]) {
+			return nil, fmt.Errorf("%w. unknown shell %q", ErrInput, args[0])
+		}
+		return CompletionCmd(args[0], g.IsDebug, flags, args), nil
+	}),
+	ArgsComplete: []completer{completeValues(completionShells...)},
+}
+
+func CompletionCmd(
+	shell string,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "completion",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			_, err := fmt.Fprint(os.Stdout, completionScripts[shell])
+			return err
+		},
+	}
+}
+
+// complete returns the candidates for the last of words, the arguments
+// typed after mono. Flags are parsed as parse would, so the --context given
+// anywhere is used for the dynamic candidates.
+func complete(defaultDir string, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	var (
+		c        = completion{ContextDir: defaultDir, Current: words[len(words)-1]}
+		sub      *subcommand
+		isHelp   bool
+		isDashes bool
+		expects  string // flag waiting for its value
+	)
+	fs := completionFlags(nil, defaultDir)
+	for _, w := range words[:len(words)-1] {
+		switch {
+		case expects != "":
+			if expects == "context" {
+				c.ContextDir = w
+			}
+			expects = ""
+			continue
+		case isDashes:
+		case w == "--":
+			isDashes = true
+			continue
+		case len(w) > 1 && strings.HasPrefix(w, "-"):
+			name, value, hasValue := strings.Cut(strings.TrimLeft(w, "-"), "=")
+			if name == "context" && hasValue {
+				c.ContextDir = value
+			}
+			if f := fs.Lookup(name); f != nil && !hasValue && !isBoolFlag(f) {
+				expects = name
+			}
+			continue
+		case sub == nil && !isHelp && w == "help":
+			isHelp = true
+			continue
+		case sub == nil:
+			sub = lookup(w)
+			if sub == nil {
+				return nil
+			}
+			if isHelp {
+				// nothing else to complete
+				return nil
+			}
+			fs = completionFlags(sub, defaultDir)
+			continue
+		}
+		c.Args = append(c.Args, w)
+	}
+
+	var candidates []string
+	switch {
+	case expects != "":
+		candidates = flagValues(sub, expects, c)
+	case !isDashes && strings.HasPrefix(c.Current, "-"):
+		word := c.Current
+		if name, value, ok := strings.Cut(strings.TrimLeft(word, "-"), "="); ok {
+			c.Current = value
+			dashes := word[:len(word)-len(strings.TrimLeft(word, "-"))]
+			for _, v := range flagValues(sub, name, c) {
+				candidates = append(candidates, dashes+name+"="+v)
+			}
+			c.Current = word
+			break
+		}
+		fs.VisitAll(func(f *flag.Flag) {
+			if isBoolFlag(f) {
+				candidates = append(candidates, "--"+f.Name)
+			} else {
+				candidates = append(candidates, "--"+f.Name+"=")
+			}
+		})
+	case sub == nil:
+		for _, s := range subcommands {
+			candidates = append(candidates, s.Name)
+		}
+		if !isHelp {
+			candidates = append(candidates, "help")
+		}
+	case len(c.Args) < len(sub.ArgsComplete):
+		candidates = sub.ArgsComplete[len(c.Args)](c)
+	}
+
+	var found []string
+	for _, cand := range candidates {
+		if strings.HasPrefix(cand, c.Current) {
+			found = append(found, cand)
+		}
+	}
+	return found
+}
+
+// completionFlags returns the global flags and the local ones of sub, if any.
+func completionFlags(sub *subcommand, defaultDir string) *flag.FlagSet {
+	fs := flag.NewFlagSet(completeName, flag.ContinueOnError)
+	globalFlags(fs, defaultDir)
+	if sub != nil {
+		sub.Flags(fs)
+	}
+	return fs
+}
+
+// flagValues returns the candidates of the value of flag name.
+func flagValues(sub *subcommand, name string, c completion) []string {
+	switch name {
+	case "context":
+		return completeDirs(c)
+	case "log-format":
+		return logFormats
+	case "log-level":
+		return logLevels
+	}
+	if sub == nil || sub.FlagsComplete[name] == nil {
+		return nil
+	}
+	return sub.FlagsComplete[name](c)
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// completeValues completes a fixed set of values.
+func completeValues(values ...string) completer {
+	return func(completion) []string { return values }
+}
+
+// completeModules completes the directories and paths of the monorepo
+// modules, plus any extra values.
+func completeModules(extra ...string) completer {
+	return func(c completion) []string {
+		ms, err := modules.All(vfs.Dir(c.ContextDir), ".")
+		if err != nil {
+			return extra
+		}
+		var found []string
+		for _, m := range ms {
+			found = append(found, m.Dir(), m.Path())
+		}
+		return append(found, extra...)
+	}
+}
+
+// completeTags completes the tags of the monorepo, relative to it.
+func completeTags(c completion) []string {
+	prefix, err := git.Prefix(c.ContextDir)
+	if err != nil {
+		return nil
+	}
+	tags, err := git.Tags(c.ContextDir)
+	if err != nil {
+		return nil
+	}
+	var found []string
+	for _, t := range tags {
+		if t, ok := strings.CutPrefix(t, prefix); ok {
+			found = append(found, t)
+		}
+	}
+	return found
+}
+
+// completeVersions completes the versions tagged in the monorepo, newest
+// first.
+func completeVersions(c completion) []string {
+	var found []string
+	for _, t := range completeTags(c) {
+		v := tagVersion(t)
+		if semver.IsValid(v) && !slices.Contains(found, v) {
+			found = append(found, v)
+		}
+	}
+	slices.SortFunc(found, func(a, b string) int { return semver.Compare(b, a) })
+	return found
+}
+
+// completeDirs completes the directories starting with the current word.
+func completeDirs(c completion) []string {
+	dir, _ := filepath.Split(c.Current)
+	read := dir
+	if read == "" {
+		read = "."
+	}
+	entries, err := os.ReadDir(read)
+	if err != nil {
+		return nil
+	}
+	var found []string
+	for _, e := range entries {
+		if e.IsDir() {
+			found = append(found, dir+e.Name()+"/")
+		}
+	}
+	return found
+}
+
+// completionScripts delegate to the hidden __complete subcommand. Candidates
+// ending in "=" or "/" are not followed by a space so the value can be typed
+// right after.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for mono
+_mono_completion() {
+	local line="${COMP_LINE:0:COMP_POINT}"
+	local -a words
+	read -r -a words <<< "$line"
+	if [[ "$line" == *" " ]]; then
+		words+=("")
+	fi
+	local cur="${words[${#words[@]}-1]}"
+	local IFS=$'\n'
+	COMPREPLY=($(mono __complete "${words[@]:1}" 2>/dev/null))
+	# bash splits the word being completed at "=" when it is a word break
+	if [[ "$cur" == *=* && "$COMP_WORDBREAKS" == *=* ]]; then
+		local i
+		for i in "${!COMPREPLY[@]}"; do
+			COMPREPLY[i]="${COMPREPLY[i]#"${cur%%=*}="}"
+		done
+	fi
+	if [[ ${#COMPREPLY[@]} -eq 1 && ( "${COMPREPLY[0]}" == *= || "${COMPREPLY[0]}" == */ ) ]]; then
+		compopt -o nospace
+	fi
+}
+complete -F _mono_completion mono
+`,
+	"zsh": `#compdef mono
+# zsh completion for mono
+_mono() {
+	local -a candidates nospace
+	local c
+	candidates=("${(@f)$(mono __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	for c in "${candidates[@]}"; do
+		[[ -z "$c" ]] && continue
+		if [[ "$c" == *= || "$c" == */ ]]; then
+			compadd -Q -S '' -- "$c"
+		else
+			compadd -Q -- "$c"
+		fi
+	done
+}
+compdef _mono mono
+`,
+	"fish": `# fish completion for mono
+function __mono_complete
+	set -l words (commandline -opc)
+	set -e words[1]
+	mono __complete $words (commandline -ct) 2>/dev/null
+end
+complete -c mono -f -a '(__mono_complete)'
+`,
+	"powershell": `# powershell completion for mono
+Register-ArgumentCompleter -Native -CommandName mono -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+	$words = @($commandAst.CommandElements |
+		Where-Object { $_.Extent.EndOffset -lt $cursorPosition } |
+		Select-Object -Skip 1 |
+		ForEach-Object { $_.ToString() })
+	$words += $wordToComplete
+	mono __complete @words 2>$null | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+`,
+}
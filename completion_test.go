@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	t.Parallel()
+
+	const dir = "./testdata/prev-release"
+	modules := []string{
+		"api", "github.com/demula/mono-example/api",
+		"cli", "github.com/demula/mono-example/cli",
+		"core", "github.com/demula/mono-example/core",
+		"server", "github.com/demula/mono-example/server",
+	}
+	tests := []struct {
+		name     string
+		words    []string
+		expected []string
+	}{
+		{
+			name:     "subcommands",
+			words:    []string{"re"},
+			expected: []string{"release", "retract"},
+		},
+		{
+			name:     "help subcommand",
+			words:    []string{"help", "st"},
+			expected: []string{"status"},
+		},
+		{
+			name:  "nothing after help subcommand",
+			words: []string{"help", "status", ""},
+		},
+		{
+			name:  "unknown subcommand",
+			words: []string{"unknown", ""},
+		},
+		{
+			name:     "global flags",
+			words:    []string{"--c"},
+			expected: []string{"--context="},
+		},
+		{
+			name:     "local and global flags",
+			words:    []string{"release", "--d"},
+			expected: []string{"--debug", "--diff=", "--dry-run"},
+		},
+		{
+			name:     "flag values",
+			words:    []string{"status", "--output", ""},
+			expected: []string{"table", "json"},
+		},
+		{
+			name:     "flag values after equal sign",
+			words:    []string{"release", "--diff=s"},
+			expected: []string{"--diff=side-by-side"},
+		},
+		{
+			name:     "global flag values",
+			words:    []string{"status", "--log-format=j"},
+			expected: []string{"--log-format=json"},
+		},
+		{
+			name:     "modules",
+			words:    []string{"--context=" + dir, "deprecate", ""},
+			expected: modules,
+		},
+		{
+			name:     "modules with context after arguments",
+			words:    []string{"retract", "--dry-run", "--context", dir, "c"},
+			expected: []string{"cli", "core"},
+		},
+		{
+			name:     "all modules",
+			words:    []string{"retract", "--context=" + dir, "a"},
+			expected: []string{"api", "all"},
+		},
+		{
+			name:     "arguments after terminator",
+			words:    []string{"deprecate", "--context=" + dir, "--", "-"},
+			expected: nil,
+		},
+		{
+			name:  "too many arguments",
+			words: []string{"deprecate", "--context=" + dir, "api", ""},
+		},
+		{
+			name:     "shells",
+			words:    []string{"completion", ""},
+			expected: completionShells,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual := complete(".", test.words)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	t.Parallel()
+
+	for _, shell := range completionShells {
+		if !strings.Contains(completionScripts[shell], "mono "+completeName) {
+			t.Errorf("expected the %s script to call %q", shell, completeName)
+		}
+	}
+}
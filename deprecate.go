@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+)
+
+const deprecateUsage = "" +
+	`Running on the root of your monorepo to deprecate a module (by directory or
+module path) with a "// Deprecated:" comment on its module directive:
+	mono deprecate --message="use example.com/mono/client/v2" client
+
+Specify the root of your monorepo when not in current directory :
+	mono deprecate --context="./testdata" --message="..." client
+
+A previous deprecation message is replaced. The deprecation reaches the proxy
+with the next release.
+
+You can skip writing any files by using --dry-run:
+	mono deprecate --dry-run --message="..." client
+
+The changes are printed as a unified diff instead, or side by side with
+--diff=side-by-side. Save them as a patch for "git apply" with:
+	mono deprecate --dry-run --patch-out="deprecate.patch" --message="..." client
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+var deprecateCommand = &subcommand{
+	Name:          "deprecate",
+	Args:          "<module>",
+	Summary:       "deprecate a module",
+	Usage:         deprecateUsage,
+	MinArgs:       1,
+	MaxArgs:       1,
+	MissingArgs:   "missing module argument",
+	ArgsComplete:  []completer{completeModules()},
+	FlagsComplete: map[string]completer{"diff": completeValues(diffUnified, diffSideBySide)},
+	Flags: func(fs *flag.FlagSet) builder {
+		var (
+			message   = fs.String("message", "", "deprecation message, i.e. the module to use instead")
+			isDryRun  = fs.Bool("dry-run", false, "skip writing to files")
+			diffStyle = fs.String("diff", diffUnified, "diff style of --dry-run: unified or side-by-side")
+			patchOut  = fs.String("patch-out", "", "write the --dry-run changes as a git patch to the given file")
+		)
+		return func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+			if strings.TrimSpace(*message) == "" {
+				return nil, fmt.Errorf("%w. missing --message flag", ErrInput)
+			}
+			dryRun, err := parseDryRun(*isDryRun, *diffStyle, *patchOut)
+			if err != nil {
+				return nil, err
+			}
+			return DeprecateCmd(g.ContextDir, args[0], *message, dryRun, g.IsDebug, flags, args), nil
+		}
+	},
+}
+
+func DeprecateCmd(
+	contextDir string,
+	target string,
+	message string,
+	dryRun *dryRun,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "deprecate",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			fsys := vfs.NewOverlay(os.DirFS(contextDir))
+			err := deprecate(fsys, target, message)
+			if err != nil {
+				if errors.Is(err, ErrNoModulesFound) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			if dryRun != nil {
+				return dryRun.preview(contextDir, fsys, os.Stdout)
+			}
+			return fsys.Commit(vfs.Dir(contextDir))
+		},
+	}
+}
+
+// deprecate sets the deprecation message of the target module.
+func deprecate(fsys vfs.FS, target, message string) error {
+	ms, err := modules.All(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return ErrNoModulesFound
+	}
+	for _, m := range ms {
+		if m.FileName != target && m.Path() != target {
+			continue
+		}
+		err = modules.Deprecate(m, message)
+		if err != nil {
+			return fmt.Errorf("failed to deprecate %q: %w", m.Dir(), err)
+		}
+		slog.Info("module deprecated",
+			slog.String("module", m.Path()),
+			slog.String("file", path.Join(m.Dir(), "go.mod")),
+			slog.String("deprecated", m.Deprecated()),
+		)
+		return nil
+	}
+	return fmt.Errorf("%w. unknown module %q", ErrInput, target)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+)
+
+func TestDeprecate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		target   string
+		expected string
+		errMsg   string
+	}{
+		{
+			name:     "module by directory",
+			target:   "cli",
+			expected: "github.com/demula/mono-example/cli",
+		},
+		{
+			name:     "module by path",
+			target:   "github.com/demula/mono-example/core",
+			expected: "github.com/demula/mono-example/core",
+		},
+		{
+			name:   "unknown module",
+			target: "client",
+			errMsg: "input error. unknown module \"client\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fsys := vfs.NewOverlay(os.DirFS("./testdata/golden/"))
+			err := deprecate(fsys, tt.target, "use the server module")
+			if tt.errMsg != "" {
+				if err == nil || err.Error() != tt.errMsg {
+					t.Fatalf("expected error %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			ms, err := modules.All(fsys, ".")
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			for _, m := range ms {
+				expected := ""
+				if m.Path() == tt.expected {
+					expected = "use the server module"
+				}
+				if m.Deprecated() != expected {
+					t.Errorf("expected %s deprecation %q, got %q", m.Path(), expected, m.Deprecated())
+				}
+			}
+			if len(fsys.Changes()) != 1 {
+				t.Errorf("expected only the deprecated go.mod to change, got %v", fsys.Changes())
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+// Package diff compares files line by line and prints the differences as a
+// unified diff that git can apply or side by side.
+package diff
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Op is the kind of change of a line.
+type Op byte
+
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// Line is a line of an edit script. Text keeps its line ending so a missing
+// one at the end of the file is a change too.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxEdits bounds the work of Lines. Past it the remaining lines are replaced
+// as a whole which is still a correct, if longer, diff.
+const maxEdits = 1000
+
+// Lines returns the shortest edit script turning a into b using the Myers
+// algorithm.
+func Lines(a, b []string) []Line {
+	var prefix, suffix []Line
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, Line{Equal, a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append(suffix, Line{Equal, a[len(a)-1]})
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	slices.Reverse(suffix)
+	return slices.Concat(prefix, myers(a, b), suffix)
+}
+
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	// trace holds v before every step, only the diagonals reachable in it
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, slices.Clone(v[offset-d:offset+d+1]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	lines := make([]Line, 0, n+m)
+	for _, l := range a {
+		lines = append(lines, Line{Delete, l})
+	}
+	for _, l := range b {
+		lines = append(lines, Line{Insert, l})
+	}
+	return lines
+}
+
+func backtrack(a, b []string, trace [][]int) []Line {
+	var lines []Line
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		// trace[d] covers the diagonals -d..d
+		at := func(k int) int { return trace[d][k+d] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			lines = append(lines, Line{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			lines = append(lines, Line{Insert, b[y-1]})
+			y--
+		} else {
+			lines = append(lines, Line{Delete, a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		lines = append(lines, Line{Equal, a[x-1]})
+		x--
+		y--
+	}
+	slices.Reverse(lines)
+	return lines
+}
+
+// split returns the lines of data keeping their line endings.
+func split(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// File is a changed file. Old is nil for new files.
+type File struct {
+	Name string
+	Old  []byte
+	New  []byte
+}
+
+// hunk is a group of changes with their surrounding context.
+type hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []Line
+}
+
+func (h hunk) header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// hunks groups the edit script in hunks with context lines around changes.
+func hunks(lines []Line, context int) []hunk {
+	var hs []hunk
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+		start := max(0, i-context)
+		h := hunk{OldStart: oldLine - (i - start), NewStart: newLine - (i - start)}
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].Op != Equal {
+				end = j
+				continue
+			}
+			if j-end > 2*context {
+				break
+			}
+		}
+		end = min(len(lines), end+context+1)
+		h.Lines = lines[start:end]
+		for _, l := range h.Lines {
+			if l.Op != Insert {
+				h.OldLines++
+			}
+			if l.Op != Delete {
+				h.NewLines++
+			}
+		}
+		for _, l := range lines[i:end] {
+			if l.Op != Insert {
+				oldLine++
+			}
+			if l.Op != Delete {
+				newLine++
+			}
+		}
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+		hs = append(hs, h)
+		i = end
+	}
+	return hs
+}
+
+const (
+	red   = "\x1b[31m"
+	green = "\x1b[32m"
+	cyan  = "\x1b[36m"
+	bold  = "\x1b[1m"
+	reset = "\x1b[0m"
+)
+
+func paint(isColor bool, color, s string) string {
+	if !isColor {
+		return s
+	}
+	return color + s + reset
+}
+
+// Unified writes the changed files as a git patch with 3 lines of context.
+// Files whose content did not change are left out. Colors are only meant for
+// terminals, patches to apply must not have them.
+func Unified(w io.Writer, files []File, isColor bool) error {
+	b := &strings.Builder{}
+	for _, f := range files {
+		lines := Lines(split(f.Old), split(f.New))
+		if !slices.ContainsFunc(lines, func(l Line) bool { return l.Op != Equal }) && f.Old != nil {
+			continue
+		}
+		old := "a/" + f.Name
+		b.WriteString(paint(isColor, bold, "diff --git a/"+f.Name+" b/"+f.Name) + "\n")
+		if f.Old == nil {
+			b.WriteString(paint(isColor, bold, "new file mode 100644") + "\n")
+			old = "/dev/null"
+		}
+		b.WriteString(paint(isColor, bold, "--- "+old) + "\n")
+		b.WriteString(paint(isColor, bold, "+++ b/"+f.Name) + "\n")
+		for _, h := range hunks(lines, 3) {
+			b.WriteString(paint(isColor, cyan, h.header()) + "\n")
+			for _, l := range h.Lines {
+				text := string(l.Op) + strings.TrimSuffix(l.Text, "\n")
+				switch l.Op {
+				case Delete:
+					text = paint(isColor, red, text)
+				case Insert:
+					text = paint(isColor, green, text)
+				}
+				b.WriteString(text + "\n")
+				if !strings.HasSuffix(l.Text, "\n") {
+					b.WriteString("\\ No newline at end of file\n")
+				}
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// SideBySide writes the changed files in two columns of width characters,
+// the old content on the left and the new one on the right.
+func SideBySide(w io.Writer, files []File, width int, isColor bool) error {
+	b := &strings.Builder{}
+	cell := func(s string) string {
+		s = strings.TrimSuffix(s, "\n")
+		s = strings.ReplaceAll(s, "\t", "    ")
+		if utf8.RuneCountInString(s) > width {
+			s = string([]rune(s)[:width-1]) + "…"
+		}
+		return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+	}
+	for _, f := range files {
+		lines := Lines(split(f.Old), split(f.New))
+		if !slices.ContainsFunc(lines, func(l Line) bool { return l.Op != Equal }) && f.Old != nil {
+			continue
+		}
+		b.WriteString(paint(isColor, bold, f.Name) + "\n")
+		for _, h := range hunks(lines, 3) {
+			b.WriteString(paint(isColor, cyan, h.header()) + "\n")
+			for i := 0; i < len(h.Lines); {
+				if h.Lines[i].Op == Equal {
+					b.WriteString(strings.TrimRight(cell(h.Lines[i].Text)+"   "+cell(h.Lines[i].Text), " ") + "\n")
+					i++
+					continue
+				}
+				// pair the deleted lines with the inserted ones that follow
+				var deleted, inserted []string
+				for ; i < len(h.Lines) && h.Lines[i].Op == Delete; i++ {
+					deleted = append(deleted, h.Lines[i].Text)
+				}
+				for ; i < len(h.Lines) && h.Lines[i].Op == Insert; i++ {
+					inserted = append(inserted, h.Lines[i].Text)
+				}
+				for j := range max(len(deleted), len(inserted)) {
+					left, right, mark := cell(""), "", " | "
+					if j < len(deleted) {
+						left = paint(isColor, red, cell(deleted[j]))
+					} else {
+						mark = " > "
+					}
+					if j < len(inserted) {
+						right = paint(isColor, green, strings.TrimRight(cell(inserted[j]), " "))
+					} else {
+						mark = " < "
+					}
+					b.WriteString(strings.TrimRight(left+mark+right, " ") + "\n")
+				}
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
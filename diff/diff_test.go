@@ -0,0 +1,170 @@
+package diff_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/demula/mono/diff"
+)
+
+func TestLines(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{
+			name:     "equal",
+			a:        "abc",
+			b:        "abc",
+			expected: " a b c",
+		},
+		{
+			name:     "insert",
+			a:        "ac",
+			b:        "abc",
+			expected: " a+b c",
+		},
+		{
+			name:     "delete",
+			a:        "abc",
+			b:        "ac",
+			expected: " a-b c",
+		},
+		{
+			name:     "replace",
+			a:        "abcabba",
+			b:        "cbabac",
+			expected: "-a-b c+b a b-b a+c",
+		},
+		{
+			name:     "empty old",
+			a:        "",
+			b:        "ab",
+			expected: "+a+b",
+		},
+		{
+			name:     "empty new",
+			a:        "ab",
+			b:        "",
+			expected: "-a-b",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			lines := diff.Lines(strings.Split(test.a, ""), strings.Split(test.b, ""))
+			var got strings.Builder
+			for _, l := range lines {
+				got.WriteString(string(l.Op) + l.Text)
+			}
+			if got.String() != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got.String())
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	t.Parallel()
+
+	long := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	tests := []struct {
+		name     string
+		file     diff.File
+		expected string
+	}{
+		{
+			name: "unchanged",
+			file: diff.File{Name: "go.mod", Old: []byte("a\n"), New: []byte("a\n")},
+		},
+		{
+			name: "new file",
+			file: diff.File{Name: "api/go.sum", New: []byte("a\nb\n")},
+			expected: "diff --git a/api/go.sum b/api/go.sum\n" +
+				"new file mode 100644\n" +
+				"--- /dev/null\n" +
+				"+++ b/api/go.sum\n" +
+				"@@ -0,0 +1,2 @@\n" +
+				"+a\n" +
+				"+b\n",
+		},
+		{
+			name: "hunks",
+			file: diff.File{
+				Name: "go.mod",
+				Old:  []byte(long),
+				New:  []byte(strings.Replace(strings.Replace(long, "2\n", "two\n", 1), "11\n", "", 1)),
+			},
+			expected: "diff --git a/go.mod b/go.mod\n" +
+				"--- a/go.mod\n" +
+				"+++ b/go.mod\n" +
+				"@@ -1,5 +1,5 @@\n" +
+				" 1\n" +
+				"-2\n" +
+				"+two\n" +
+				" 3\n" +
+				" 4\n" +
+				" 5\n" +
+				"@@ -8,5 +8,4 @@\n" +
+				" 8\n" +
+				" 9\n" +
+				" 10\n" +
+				"-11\n" +
+				" 12\n",
+		},
+		{
+			name: "missing newline",
+			file: diff.File{Name: "VERSION", Old: []byte("v0.1.0"), New: []byte("v0.2.0\n")},
+			expected: "diff --git a/VERSION b/VERSION\n" +
+				"--- a/VERSION\n" +
+				"+++ b/VERSION\n" +
+				"@@ -1,1 +1,1 @@\n" +
+				"-v0.1.0\n" +
+				"\\ No newline at end of file\n" +
+				"+v0.2.0\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got bytes.Buffer
+			err := diff.Unified(&got, []diff.File{test.file}, false)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if got.String() != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, got.String())
+			}
+		})
+	}
+}
+
+func TestSideBySide(t *testing.T) {
+	t.Parallel()
+
+	files := []diff.File{{
+		Name: "go.mod",
+		Old:  []byte("module example.com/api\n\nrequire example.com/core v0.1.0\n"),
+		New:  []byte("module example.com/api\n\nrequire example.com/core v0.2.0\nrequire example.com/cli v0.2.0\n"),
+	}}
+	expected := "go.mod\n" +
+		"@@ -1,3 +1,4 @@\n" +
+		"module example.com/api     module example.com/api\n" +
+		"\n" +
+		"require example.com/cor… | require example.com/cor…\n" +
+		"                         > require example.com/cli…\n"
+	var got bytes.Buffer
+	err := diff.SideBySide(&got, files, 24, false)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if got.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got.String())
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/demula/mono/git"
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+const doctorUsage = "" +
+	`Running on the root of your monorepo to diagnose the environment and the
+repository before a release:
+	mono doctor
+
+Specify the root of your monorepo when not in current directory :
+	mono doctor --context="./testdata"
+
+It checks that git and go are available, the working tree is clean, the go
+toolchain is recent enough for the go directives, GOFLAGS, GOPROXY,
+GOPRIVATE, GONOPROXY and GONOSUMDB cover the module paths consistently,
+go.work uses every module, the modules have a license, tags follow the
+"<dir>/<version>" convention and no module holds a nested one. Every problem
+is printed with the way to fix it:
+	fail  repository  uncommitted changes on api/api.go, core/go.mod
+	                  fix: commit or stash them before releasing
+
+It fails when a problem would break the release, warnings do not.
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+var ErrDoctorFailed = errors.New("doctor failed")
+
+// Status of a diagnosis.
+const (
+	diagnosisOK   = "ok"
+	diagnosisWarn = "warn"
+	diagnosisFail = "fail"
+)
+
+// diagnosis is the result of a doctor check and, for problems, how to fix
+// them.
+type diagnosis struct {
+	Check   string
+	Status  string
+	Message string
+	Fix     string
+}
+
+// environment gives access to the tools the releases depend on.
+type environment struct {
+	// GitVersion fails when git is not available.
+	GitVersion func() (string, error)
+	// Dirty returns the uncommitted files, it fails outside a repository.
+	Dirty func() ([]string, error)
+	// Tags are relative to the monorepo root.
+	Tags func() ([]string, error)
+	// GoEnv returns the values of the go env variables, it fails when go is
+	// not available.
+	GoEnv func(names ...string) (map[string]string, error)
+}
+
+var doctorCommand = &subcommand{
+	Name:    "doctor",
+	Summary: "diagnose the environment and repository before a release",
+	Usage:   doctorUsage,
+	Flags: noFlags(func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+		return DoctorCmd(g.ContextDir, g.IsDebug, flags, args), nil
+	}),
+}
+
+func DoctorCmd(
+	contextDir string,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "doctor",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			ds, err := doctor(vfs.Dir(contextDir), localEnvironment(contextDir))
+			if err != nil {
+				if errors.Is(err, ErrNoModulesFound) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			err = writeDiagnoses(os.Stdout, ds)
+			if err != nil {
+				return err
+			}
+			failed := 0
+			for _, d := range ds {
+				if d.Status == diagnosisFail {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%w: %d problems found", ErrDoctorFailed, failed)
+			}
+			return nil
+		},
+	}
+}
+
+// localEnvironment is the environment of the monorepo at contextDir.
+func localEnvironment(contextDir string) environment {
+	return environment{
+		GitVersion: git.Version,
+		Dirty: func() ([]string, error) {
+			return git.Dirty(contextDir)
+		},
+		Tags: func() ([]string, error) {
+			h, err := gitHistory(contextDir)
+			return h.Tags, err
+		},
+		GoEnv: func(names ...string) (map[string]string, error) {
+			cmd := exec.Command("go", append([]string{"env", "-json"}, names...)...)
+			cmd.Dir = contextDir
+			out, err := cmd.Output()
+			if err != nil {
+				return nil, fmt.Errorf("go env: %w", err)
+			}
+			vars := make(map[string]string)
+			err = json.Unmarshal(out, &vars)
+			if err != nil {
+				return nil, fmt.Errorf("go env: %w", err)
+			}
+			return vars, nil
+		},
+	}
+}
+
+// doctor diagnoses the environment and the monorepo in fsys.
+func doctor(fsys vfs.FS, env environment) ([]diagnosis, error) {
+	ms, err := modules.All(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, ErrNoModulesFound
+	}
+	var ds []diagnosis
+	ds = append(ds, diagnoseGit(ms, env)...)
+	ds = append(ds, diagnoseGo(ms, env)...)
+	ds = append(ds, diagnoseWorkspace(fsys, ms))
+	d, err := diagnoseLicenses(ms)
+	if err != nil {
+		return nil, err
+	}
+	ds = append(ds, d)
+	d, err = diagnoseNested(fsys, ms)
+	if err != nil {
+		return nil, err
+	}
+	return append(ds, d), nil
+}
+
+// diagnoseGit checks git, the working tree and the tags. The last two are
+// skipped without git.
+func diagnoseGit(ms []*modules.Module, env environment) []diagnosis {
+	version, err := env.GitVersion()
+	if err != nil {
+		return []diagnosis{{
+			Check:   "git",
+			Status:  diagnosisFail,
+			Message: "git not found: " + err.Error(),
+			Fix:     "install git and add it to the PATH",
+		}}
+	}
+	ds := []diagnosis{{Check: "git", Status: diagnosisOK, Message: "git " + version}}
+
+	dirty, err := env.Dirty()
+	switch {
+	case errors.Is(err, git.ErrNotRepository):
+		return append(ds, diagnosis{
+			Check:   "repository",
+			Status:  diagnosisFail,
+			Message: "not a git repository",
+			Fix:     "run mono on a clone of the monorepo",
+		})
+	case err != nil:
+		ds = append(ds, diagnosis{
+			Check:   "repository",
+			Status:  diagnosisFail,
+			Message: "failed to check for uncommitted changes: " + err.Error(),
+			Fix:     `check "git status" works`,
+		})
+	case len(dirty) > 0:
+		ds = append(ds, diagnosis{
+			Check:   "repository",
+			Status:  diagnosisFail,
+			Message: "uncommitted changes on " + strings.Join(dirty, ", "),
+			Fix:     "commit or stash them before releasing",
+		})
+	default:
+		ds = append(ds, diagnosis{Check: "repository", Status: diagnosisOK, Message: "working tree clean"})
+	}
+
+	tags, err := env.Tags()
+	if err != nil {
+		return append(ds, diagnosis{
+			Check:   "tags",
+			Status:  diagnosisFail,
+			Message: "failed to list tags: " + err.Error(),
+			Fix:     `check "git tag --list" works`,
+		})
+	}
+	return append(ds, diagnoseTags(ms, tags))
+}
+
+// diagnoseTags checks the version tags are plain or prefixed by a module
+// directory, with a version of the major version of its module path. Other
+// tags are ignored.
+func diagnoseTags(ms []*modules.Module, tags []string) diagnosis {
+	var wrong []string
+	for _, t := range tags {
+		dir, v := "", t
+		if i := strings.LastIndex(t, "/"); i >= 0 {
+			dir, v = t[:i], t[i+1:]
+		}
+		if !strings.HasPrefix(v, "v") || !semver.IsValid(v) {
+			if dir != "" && semver.IsValid("v"+v) {
+				// api/1.0.0 is meant as a version
+				wrong = append(wrong, t)
+			}
+			continue
+		}
+		if semver.Canonical(v) != v {
+			wrong = append(wrong, t)
+			continue
+		}
+		if dir == "" {
+			continue
+		}
+		i := slices.IndexFunc(ms, func(m *modules.Module) bool { return m.FileName == dir })
+		if i < 0 {
+			wrong = append(wrong, t)
+			continue
+		}
+		_, pathMajor, _ := module.SplitPathVersion(ms[i].Path())
+		if module.CheckPathMajor(v, pathMajor) != nil {
+			wrong = append(wrong, t)
+		}
+	}
+	if len(wrong) > 0 {
+		return diagnosis{
+			Check:   "tags",
+			Status:  diagnosisWarn,
+			Message: "tags ignored by go as module versions: " + strings.Join(wrong, ", "),
+			Fix:     `name them "<module dir>/vMAJOR.MINOR.PATCH" with the major version of the module path`,
+		}
+	}
+	return diagnosis{Check: "tags", Status: diagnosisOK, Message: fmt.Sprintf("%d tags", len(tags))}
+}
+
+// diagnoseGo checks the go toolchain and its env variables.
+func diagnoseGo(ms []*modules.Module, env environment) []diagnosis {
+	vars, err := env.GoEnv("GOVERSION", "GOTOOLCHAIN", "GOFLAGS", "GOPROXY", "GOPRIVATE", "GONOPROXY", "GONOSUMDB")
+	if err != nil {
+		return []diagnosis{{
+			Check:   "go",
+			Status:  diagnosisFail,
+			Message: "go not found: " + err.Error(),
+			Fix:     "install go from https://go.dev/dl and add it to the PATH",
+		}}
+	}
+
+	var ds []diagnosis
+	required, dir := "", ""
+	for _, m := range ms {
+		if m.File.Go != nil && (required == "" || modules.CompareGo(m.File.Go.Version, required) > 0) {
+			required, dir = m.File.Go.Version, m.Dir()
+		}
+	}
+	goVersion := strings.TrimPrefix(vars["GOVERSION"], "go")
+	switch {
+	case required == "" || modules.CompareGo(goVersion, required) >= 0:
+		ds = append(ds, diagnosis{Check: "go", Status: diagnosisOK, Message: vars["GOVERSION"]})
+	case vars["GOTOOLCHAIN"] == "local":
+		ds = append(ds, diagnosis{
+			Check:   "go",
+			Status:  diagnosisFail,
+			Message: fmt.Sprintf("%s is older than the go %s directive of %s", vars["GOVERSION"], required, dir),
+			Fix:     fmt.Sprintf("install go%s or unset GOTOOLCHAIN=local", required),
+		})
+	default:
+		ds = append(ds, diagnosis{
+			Check:   "go",
+			Status:  diagnosisWarn,
+			Message: fmt.Sprintf("%s is older than the go %s directive of %s, go%s gets downloaded", vars["GOVERSION"], required, dir, required),
+			Fix:     fmt.Sprintf("install go%s", required),
+		})
+	}
+
+	var problems []diagnosis
+	if vars["GOPROXY"] == "off" {
+		problems = append(problems, diagnosis{
+			Check:   "go env",
+			Status:  diagnosisFail,
+			Message: "GOPROXY=off, modules cannot be downloaded",
+			Fix:     "go env -w GOPROXY=https://proxy.golang.org,direct",
+		})
+	}
+	for _, f := range strings.Fields(vars["GOFLAGS"]) {
+		if strings.HasPrefix(f, "-mod=") || strings.HasPrefix(f, "-modfile=") {
+			problems = append(problems, diagnosis{
+				Check:   "go env",
+				Status:  diagnosisWarn,
+				Message: fmt.Sprintf("GOFLAGS has %s, go.mod files are not read as released", f),
+				Fix:     "go env -u GOFLAGS",
+			})
+		}
+	}
+	for _, name := range []string{"GOPRIVATE", "GONOPROXY", "GONOSUMDB"} {
+		globs := vars[name]
+		if globs == "" || (name != "GOPRIVATE" && globs == vars["GOPRIVATE"]) {
+			// GONOPROXY and GONOSUMDB default to GOPRIVATE
+			continue
+		}
+		var covered, uncovered []string
+		for _, m := range ms {
+			if module.MatchPrefixPatterns(globs, m.Path()) {
+				covered = append(covered, m.Path())
+			} else {
+				uncovered = append(uncovered, m.Path())
+			}
+		}
+		if len(covered) > 0 && len(uncovered) > 0 {
+			problems = append(problems, diagnosis{
+				Check:   "go env",
+				Status:  diagnosisWarn,
+				Message: fmt.Sprintf("%s=%s covers %s but not %s", name, globs, strings.Join(covered, ", "), strings.Join(uncovered, ", ")),
+				Fix:     fmt.Sprintf("go env -w %s=%s,%s", name, globs, commonPath(ms)),
+			})
+		}
+	}
+	if len(problems) == 0 {
+		problems = append(problems, diagnosis{
+			Check:   "go env",
+			Status:  diagnosisOK,
+			Message: "GOPROXY=" + vars["GOPROXY"],
+		})
+	}
+	return append(ds, problems...)
+}
+
+// commonPath returns the longest path prefix of the module paths.
+func commonPath(ms []*modules.Module) string {
+	common := ms[0].Path()
+	for _, m := range ms[1:] {
+		for common != "." && common != m.Path() && !strings.HasPrefix(m.Path(), common+"/") {
+			common = path.Dir(common)
+		}
+	}
+	return common
+}
+
+// diagnoseWorkspace checks go.work uses every module and nothing else.
+func diagnoseWorkspace(fsys fs.FS, ms []*modules.Module) diagnosis {
+	var dirs []string
+	for _, m := range ms {
+		dirs = append(dirs, "./"+m.Dir())
+	}
+	contents, err := fs.ReadFile(fsys, "go.work")
+	if errors.Is(err, fs.ErrNotExist) {
+		return diagnosis{
+			Check:   "go.work",
+			Status:  diagnosisWarn,
+			Message: "no go.work, siblings are built from the proxy instead of the working tree",
+			Fix:     "go work init " + strings.Join(dirs, " "),
+		}
+	}
+	var wf *modfile.WorkFile
+	if err == nil {
+		wf, err = modfile.ParseWork("go.work", contents, nil)
+	}
+	if err != nil {
+		return diagnosis{
+			Check:   "go.work",
+			Status:  diagnosisFail,
+			Message: "failed to read go.work: " + err.Error(),
+			Fix:     "rm go.work && go work init " + strings.Join(dirs, " "),
+		}
+	}
+	var used []string
+	for _, u := range wf.Use {
+		used = append(used, "./"+path.Clean(strings.TrimPrefix(u.Path, "./")))
+	}
+	var missing, extra []string
+	for _, d := range dirs {
+		if !slices.Contains(used, d) {
+			missing = append(missing, d)
+		}
+	}
+	for _, u := range used {
+		if !slices.Contains(dirs, u) {
+			extra = append(extra, u)
+		}
+	}
+	switch {
+	case len(missing) > 0:
+		return diagnosis{
+			Check:   "go.work",
+			Status:  diagnosisWarn,
+			Message: "go.work does not use " + strings.Join(missing, ", "),
+			Fix:     "go work use " + strings.Join(missing, " "),
+		}
+	case len(extra) > 0:
+		return diagnosis{
+			Check:   "go.work",
+			Status:  diagnosisWarn,
+			Message: "go.work uses " + strings.Join(extra, ", ") + ", not a monorepo module",
+			Fix:     "go work edit -dropuse=" + strings.Join(extra, " -dropuse="),
+		}
+	}
+	return diagnosis{Check: "go.work", Status: diagnosisOK, Message: fmt.Sprintf("uses the %d modules", len(ms))}
+}
+
+// diagnoseLicenses checks every module zip would hold a license.
+func diagnoseLicenses(ms []*modules.Module) (diagnosis, error) {
+	found, err := unlicensed(ms, modules.LicenseFiles)
+	if err != nil {
+		return diagnosis{}, err
+	}
+	if len(found) > 0 {
+		var dirs []string
+		for _, m := range found {
+			dirs = append(dirs, m.Dir())
+		}
+		return diagnosis{
+			Check:   "licenses",
+			Status:  diagnosisWarn,
+			Message: "published without a license: " + strings.Join(dirs, ", "),
+			Fix:     "add a LICENSE file to the monorepo root or to the module directories",
+		}, nil
+	}
+	return diagnosis{Check: "licenses", Status: diagnosisOK, Message: "every module has a license"}, nil
+}
+
+// diagnoseNested checks no module holds another one. The go command leaves
+// the nested module out of the zip while its files are hashed on release,
+// so the go.sum hashes would not match.
+func diagnoseNested(fsys fs.FS, ms []*modules.Module) (diagnosis, error) {
+	var nested []string
+	for _, m := range ms {
+		err := fs.WalkDir(fsys, m.Dir(), func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && d.Name() == "go.mod" && path.Dir(name) != m.Dir() {
+				nested = append(nested, path.Dir(name))
+			}
+			return nil
+		})
+		if err != nil {
+			return diagnosis{}, fmt.Errorf("failed to look for nested modules in %q: %w", m.Dir(), err)
+		}
+	}
+	if len(nested) > 0 {
+		return diagnosis{
+			Check:   "nested",
+			Status:  diagnosisFail,
+			Message: "modules inside other modules: " + strings.Join(nested, ", "),
+			Fix:     "move them to their own top level directory",
+		}, nil
+	}
+	return diagnosis{Check: "nested", Status: diagnosisOK, Message: "no nested modules"}, nil
+}
+
+// writeDiagnoses prints a line per diagnosis followed by its fix, if any.
+func writeDiagnoses(w io.Writer, ds []diagnosis) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, d := range ds {
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", d.Status, d.Check, d.Message)
+		if err != nil {
+			return err
+		}
+		if d.Fix != "" {
+			_, err = fmt.Fprintf(tw, "\t\tfix: %s\n", d.Fix)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Flush()
+}
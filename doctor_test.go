@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/demula/mono/git"
+	"github.com/demula/mono/vfs"
+)
+
+func TestDoctor(t *testing.T) {
+	t.Parallel()
+
+	monorepo := fstest.MapFS{
+		"LICENSE":       {Data: []byte("MIT\n")},
+		"go.work":       {Data: []byte("go 1.25\n\nuse (\n\t./api\n\t./core\n)\n")},
+		"api/go.mod":    {Data: []byte("module example.com/mono/api\n\ngo 1.24\n")},
+		"api/api.go":    {Data: []byte("package api\n")},
+		"core/go.mod":   {Data: []byte("module example.com/mono/core/v2\n\ngo 1.25.1\n")},
+		"core/core.go":  {Data: []byte("package core\n")},
+		"docs/index.md": {Data: []byte("# docs\n")},
+	}
+	healthy := environment{
+		GitVersion: func() (string, error) { return "2.43.0", nil },
+		Dirty:      func() ([]string, error) { return nil, nil },
+		Tags: func() ([]string, error) {
+			return []string{"api/v0.1.0", "core/v2.0.0", "v0.1.0", "nightly"}, nil
+		},
+		GoEnv: func(names ...string) (map[string]string, error) {
+			return map[string]string{
+				"GOVERSION":   "go1.25.3",
+				"GOTOOLCHAIN": "auto",
+				"GOPROXY":     "https://proxy.golang.org,direct",
+				"GONOSUMDB":   "",
+			}, nil
+		},
+	}
+	healthyDiagnoses := []diagnosis{
+		{Check: "git", Status: diagnosisOK, Message: "git 2.43.0"},
+		{Check: "repository", Status: diagnosisOK, Message: "working tree clean"},
+		{Check: "tags", Status: diagnosisOK, Message: "4 tags"},
+		{Check: "go", Status: diagnosisOK, Message: "go1.25.3"},
+		{Check: "go env", Status: diagnosisOK, Message: "GOPROXY=https://proxy.golang.org,direct"},
+		{Check: "go.work", Status: diagnosisOK, Message: "uses the 2 modules"},
+		{Check: "licenses", Status: diagnosisOK, Message: "every module has a license"},
+		{Check: "nested", Status: diagnosisOK, Message: "no nested modules"},
+	}
+
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		env      func(env *environment)
+		expected map[string]diagnosis
+	}{
+		{
+			name: "healthy",
+		},
+		{
+			name: "no git",
+			env: func(env *environment) {
+				env.GitVersion = func() (string, error) { return "", errors.New("executable file not found") }
+			},
+			expected: map[string]diagnosis{
+				"git": {
+					Check:   "git",
+					Status:  diagnosisFail,
+					Message: "git not found: executable file not found",
+					Fix:     "install git and add it to the PATH",
+				},
+				"repository": {},
+				"tags":       {},
+			},
+		},
+		{
+			name: "not a repository",
+			env: func(env *environment) {
+				env.Dirty = func() ([]string, error) { return nil, fmt.Errorf("%w: %q", git.ErrNotRepository, ".") }
+			},
+			expected: map[string]diagnosis{
+				"repository": {
+					Check:   "repository",
+					Status:  diagnosisFail,
+					Message: "not a git repository",
+					Fix:     "run mono on a clone of the monorepo",
+				},
+				"tags": {},
+			},
+		},
+		{
+			name: "dirty tree and wrong tags",
+			env: func(env *environment) {
+				env.Dirty = func() ([]string, error) { return []string{"api/api.go", "core/go.mod"}, nil }
+				env.Tags = func() ([]string, error) {
+					return []string{"api/1.0.0", "api/v1.0", "api/v2.0.0", "core/v1.0.0", "web/v1.0.0"}, nil
+				}
+			},
+			expected: map[string]diagnosis{
+				"repository": {
+					Check:   "repository",
+					Status:  diagnosisFail,
+					Message: "uncommitted changes on api/api.go, core/go.mod",
+					Fix:     "commit or stash them before releasing",
+				},
+				"tags": {
+					Check:   "tags",
+					Status:  diagnosisWarn,
+					Message: "tags ignored by go as module versions: api/1.0.0, api/v1.0, api/v2.0.0, core/v1.0.0, web/v1.0.0",
+					Fix:     `name them "<module dir>/vMAJOR.MINOR.PATCH" with the major version of the module path`,
+				},
+			},
+		},
+		{
+			name: "old local toolchain",
+			env: func(env *environment) {
+				env.GoEnv = func(names ...string) (map[string]string, error) {
+					return map[string]string{"GOVERSION": "go1.25rc1", "GOTOOLCHAIN": "local"}, nil
+				}
+			},
+			expected: map[string]diagnosis{
+				"go": {
+					Check:   "go",
+					Status:  diagnosisFail,
+					Message: "go1.25rc1 is older than the go 1.25.1 directive of core",
+					Fix:     "install go1.25.1 or unset GOTOOLCHAIN=local",
+				},
+				"go env": {Check: "go env", Status: diagnosisOK, Message: "GOPROXY="},
+			},
+		},
+		{
+			name: "partially private modules",
+			env: func(env *environment) {
+				env.GoEnv = func(names ...string) (map[string]string, error) {
+					return map[string]string{
+						"GOVERSION": "go1.25.3",
+						"GOPROXY":   "off",
+						"GOPRIVATE": "example.com/mono/api",
+						"GONOPROXY": "example.com/mono/api",
+						"GONOSUMDB": "example.com/mono/api",
+					}, nil
+				}
+			},
+			expected: map[string]diagnosis{
+				"go env": {
+					Check:   "go env",
+					Status:  diagnosisFail,
+					Message: "GOPROXY=off, modules cannot be downloaded",
+					Fix:     "go env -w GOPROXY=https://proxy.golang.org,direct",
+				},
+				"go env 2": {
+					Check:   "go env",
+					Status:  diagnosisWarn,
+					Message: "GOPRIVATE=example.com/mono/api covers example.com/mono/api but not example.com/mono/core/v2",
+					Fix:     "go env -w GOPRIVATE=example.com/mono/api,example.com/mono",
+				},
+			},
+		},
+		{
+			name: "go.work out of sync",
+			files: fstest.MapFS{
+				"go.work": {Data: []byte("go 1.25\n\nuse ./api\n")},
+			},
+			expected: map[string]diagnosis{
+				"go.work": {
+					Check:   "go.work",
+					Status:  diagnosisWarn,
+					Message: "go.work does not use ./core",
+					Fix:     "go work use ./core",
+				},
+			},
+		},
+		{
+			name: "unlicensed nested module",
+			files: fstest.MapFS{
+				"LICENSE":           nil,
+				"api/tools/go.mod":  {Data: []byte("module example.com/mono/api/tools\n")},
+				"api/tools/main.go": {Data: []byte("package main\n")},
+			},
+			expected: map[string]diagnosis{
+				"licenses": {
+					Check:   "licenses",
+					Status:  diagnosisWarn,
+					Message: "published without a license: api, core",
+					Fix:     "add a LICENSE file to the monorepo root or to the module directories",
+				},
+				"nested": {
+					Check:   "nested",
+					Status:  diagnosisFail,
+					Message: "modules inside other modules: api/tools",
+					Fix:     "move them to their own top level directory",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			files := fstest.MapFS{}
+			for name, f := range monorepo {
+				files[name] = f
+			}
+			for name, f := range tt.files {
+				if f == nil {
+					delete(files, name)
+					continue
+				}
+				files[name] = f
+			}
+			env := healthy
+			if tt.env != nil {
+				tt.env(&env)
+			}
+			// expected diagnoses replace the healthy ones, empty ones are
+			// not diagnosed
+			var expected []diagnosis
+			for _, d := range healthyDiagnoses {
+				for i, suffix := range []string{"", " 2"} {
+					e, ok := tt.expected[d.Check+suffix]
+					switch {
+					case !ok && i == 0:
+						expected = append(expected, d)
+					case ok && e.Check != "":
+						expected = append(expected, e)
+					}
+				}
+			}
+
+			actual, err := doctor(vfs.NewOverlay(files), env)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("expected diagnoses:\n%v\ngot:\n%v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestWriteDiagnoses(t *testing.T) {
+	t.Parallel()
+
+	out := &bytes.Buffer{}
+	err := writeDiagnoses(out, []diagnosis{
+		{Check: "git", Status: diagnosisOK, Message: "git 2.43.0"},
+		{Check: "repository", Status: diagnosisFail, Message: "uncommitted changes on api/api.go", Fix: "commit or stash them before releasing"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	expected := "" +
+		"ok    git         git 2.43.0\n" +
+		"fail  repository  uncommitted changes on api/api.go\n" +
+		"                  fix: commit or stash them before releasing\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
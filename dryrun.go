@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/demula/mono/diff"
+	"github.com/demula/mono/git"
+	"github.com/demula/mono/vfs"
+)
+
+// Diff styles of the --dry-run preview.
+const (
+	diffUnified    = "unified"
+	diffSideBySide = "side-by-side"
+)
+
+// dryRun configures how the changes skipped by --dry-run are shown.
+type dryRun struct {
+	Style string
+	// PatchOut is the file the changes are written to as a patch, if any.
+	PatchOut string
+}
+
+// preview prints the changes of fsys to out and writes them to the patch
+// file. Patch paths are relative to the repository root so "git apply" works
+// from anywhere in it.
+func (d *dryRun) preview(contextDir string, fsys *vfs.Overlay, out io.Writer) error {
+	prefix, err := git.Prefix(contextDir)
+	if err != nil {
+		slog.Debug("could not find the git repository root, patch paths are relative to the context",
+			slog.String("error", err.Error()),
+		)
+		prefix = ""
+	}
+	var files []diff.File
+	for _, name := range fsys.Changes() {
+		f := diff.File{Name: prefix + name}
+		f.Old, err = fsys.Original(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to read original %q: %w", name, err)
+		}
+		f.New, err = fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	isColor := isTerminal(out) && os.Getenv("NO_COLOR") == ""
+	switch d.Style {
+	case diffSideBySide:
+		err = diff.SideBySide(out, files, columnWidth(), isColor)
+	default:
+		err = diff.Unified(out, files, isColor)
+	}
+	if err != nil {
+		return err
+	}
+	if d.PatchOut == "" {
+		return nil
+	}
+	patch, err := os.Create(d.PatchOut)
+	if err != nil {
+		return fmt.Errorf("failed to create patch file: %w", err)
+	}
+	defer patch.Close()
+	err = diff.Unified(patch, files, false)
+	if err != nil {
+		return fmt.Errorf("failed to write patch file: %w", err)
+	}
+	slog.Info("patch written", slog.String("file", d.PatchOut))
+	return patch.Close()
+}
+
+// isTerminal reports whether w is a terminal, the only place for colors.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// columnWidth splits the terminal width, from $COLUMNS, in two columns.
+func columnWidth() int {
+	columns, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || columns < 40 {
+		columns = 160
+	}
+	return (columns - 3) / 2
+}
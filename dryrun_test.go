@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/demula/mono/vfs"
+)
+
+func TestPreview(t *testing.T) {
+	t.Parallel()
+
+	base := fstest.MapFS{
+		"api/go.mod": {Data: []byte("module example.com/mono/api\n\nrequire example.com/mono/core v0.1.0\n")},
+		"api/go.sum": {Data: []byte("example.com/mono/core v0.1.0/go.mod h1:old=\n")},
+	}
+	// columns are as wide as the terminal
+	w := columnWidth()
+	tests := []struct {
+		name     string
+		style    string
+		expected string
+	}{
+		{
+			name:  "unified",
+			style: diffUnified,
+			expected: "diff --git a/api/go.mod b/api/go.mod\n" +
+				"--- a/api/go.mod\n" +
+				"+++ b/api/go.mod\n" +
+				"@@ -1,3 +1,3 @@\n" +
+				" module example.com/mono/api\n" +
+				" \n" +
+				"-require example.com/mono/core v0.1.0\n" +
+				"+require example.com/mono/core v0.2.0\n" +
+				"diff --git a/core/go.sum b/core/go.sum\n" +
+				"new file mode 100644\n" +
+				"--- /dev/null\n" +
+				"+++ b/core/go.sum\n" +
+				"@@ -0,0 +1,1 @@\n" +
+				"+example.com/mono/api v0.2.0/go.mod h1:new=\n",
+		},
+		{
+			name:  "side by side",
+			style: diffSideBySide,
+			expected: "api/go.mod\n" +
+				"@@ -1,3 +1,3 @@\n" +
+				fmt.Sprintf("%-*s   %s\n", w, "module example.com/mono/api", "module example.com/mono/api") +
+				"\n" +
+				fmt.Sprintf("%-*s | %s\n", w, "require example.com/mono/core v0.1.0", "require example.com/mono/core v0.2.0") +
+				"core/go.sum\n" +
+				"@@ -0,0 +1,1 @@\n" +
+				fmt.Sprintf("%*s > %s\n", w, "", "example.com/mono/api v0.2.0/go.mod h1:new="),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			fsys := vfs.NewOverlay(base)
+			err := fsys.WriteFile("api/go.mod",
+				[]byte("module example.com/mono/api\n\nrequire example.com/mono/core v0.2.0\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// rewriting a file with the same content is no change
+			err = fsys.WriteFile("api/go.sum", base["api/go.sum"].Data, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = fsys.WriteFile("core/go.sum", []byte("example.com/mono/api v0.2.0/go.mod h1:new=\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			patch := filepath.Join(dir, "release.patch")
+			var out bytes.Buffer
+			d := &dryRun{Style: test.style, PatchOut: patch}
+			err = d.preview(dir, fsys, &out)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if out.String() != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, out.String())
+			}
+			data, err := os.ReadFile(patch)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if test.style == diffUnified && string(data) != test.expected {
+				t.Errorf("expected patch to match the preview, got:\n%s", data)
+			}
+			if !bytes.HasPrefix(data, []byte("diff --git a/api/go.mod b/api/go.mod\n")) {
+				t.Errorf("expected a git patch, got:\n%s", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/semver"
+)
+
+const explainHashUsage = "" +
+	`Running on the root of your monorepo to print the files hashed into the h1
+hash of a module (by directory or module path), with their sha256:
+	mono explain-hash api
+
+Specify the root of your monorepo when not in current directory :
+	mono explain-hash --context="./testdata" api
+
+File names start with the module version, the one required by its siblings
+or its latest tag, unless given:
+	mono explain-hash --at="v0.2.0" api
+
+Compare against the tree of a previous tag to list the files added, removed
+or changed since then:
+	mono explain-hash --against="api/v0.1.0" api
+
+or against the hash of a go.sum entry. The tagged trees are searched for it
+to compare against, and it fails when the hash does not match:
+	mono explain-hash --against="h1:DmFUhwzq4loJyq5UPKESKNmfp1bHB5eqBhbJE9Hv2sA=" api
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+var ErrHashMismatch = errors.New("hash mismatch")
+
+// hashExplanation is the manifest of a module hash and, when compared, the
+// one it is compared against.
+type hashExplanation struct {
+	Module  string
+	Version string
+	Hash    string
+	Files   []modules.FileHash
+	// Against is the tag or hash compared against, if any.
+	Against     string
+	AgainstHash string
+	// AgainstTag is the tag whose tree has AgainstHash, empty when none.
+	AgainstTag   string
+	AgainstFiles []modules.FileHash
+}
+
+var explainHashCommand = &subcommand{
+	Name:         "explain-hash",
+	Args:         "<module>",
+	Summary:      "print the files hashed into the h1 hash of a module",
+	Usage:        explainHashUsage,
+	MinArgs:      1,
+	MaxArgs:      1,
+	MissingArgs:  "missing module argument",
+	ArgsComplete: []completer{completeModules()},
+	FlagsComplete: map[string]completer{
+		"against": completeTags,
+		"at":      completeVersions,
+	},
+	Flags: func(fs *flag.FlagSet) builder {
+		var (
+			version = fs.String("at", "", "module version the file names start with")
+			against = fs.String("against", "", "git tag or h1 hash to compare against")
+		)
+		return func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+			if *version != "" && !semver.IsValid(*version) {
+				return nil, fmt.Errorf("%w. invalid version provided", ErrInput)
+			}
+			return ExplainHashCmd(g.ContextDir, args[0], *version, *against, g.IsDebug, flags, args), nil
+		}
+	},
+}
+
+func ExplainHashCmd(
+	contextDir string,
+	target string,
+	version string,
+	against string,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "explain-hash",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			h, err := gitHistory(contextDir)
+			if err != nil {
+				return err
+			}
+			// hashed as a release would do it
+			base, err := releaseBase(contextDir, "", false)
+			if err != nil {
+				return err
+			}
+			e, err := explainHash(base, h, target, version, against)
+			if err != nil {
+				if errors.Is(err, ErrNoModulesFound) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			err = writeExplanation(os.Stdout, e)
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(against, "h1:") && e.Hash != e.AgainstHash {
+				return fmt.Errorf("%w: %s@%s is %s, not %s", ErrHashMismatch, e.Module, e.Version, e.Hash, against)
+			}
+			return nil
+		},
+	}
+}
+
+// explainHash returns the manifest of the target module of fsys at version
+// and of the tree it is compared against. Without version the highest one
+// required by its siblings, or else its latest tag, is used.
+func explainHash(fsys fs.FS, h history, target, version, against string) (*hashExplanation, error) {
+	ms, err := modules.All(vfs.NewOverlay(fsys), ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, ErrNoModulesFound
+	}
+	m := pickModule(ms, target)
+	if m == nil {
+		return nil, fmt.Errorf("%w. unknown module %q", ErrInput, target)
+	}
+	if version == "" {
+		version = hashedVersion(ms, m, h.Tags)
+	}
+	if version == "" {
+		return nil, fmt.Errorf("%w. %q is neither required by a sibling nor tagged, use --at", ErrInput, m.Dir())
+	}
+	e := &hashExplanation{Module: m.Path(), Version: version, Against: against}
+	e.Files, err = manifestAt(m, version)
+	if err != nil {
+		return nil, err
+	}
+	e.Hash = modules.ManifestHash(e.Files)
+
+	switch {
+	case against == "":
+		return e, nil
+	case strings.HasPrefix(against, "h1:"):
+		e.AgainstHash = against
+		if e.AgainstHash == e.Hash {
+			return e, nil
+		}
+		// the tree with that hash is likely a previous release
+		tags := slices.Clone(h.Tags)
+		slices.SortFunc(tags, func(a, b string) int {
+			return semver.Compare(tagVersion(b), tagVersion(a))
+		})
+		for _, tag := range tags {
+			if !strings.HasPrefix(tag, m.FileName+"/") && strings.Contains(tag, "/") {
+				continue
+			}
+			files, err := taggedManifest(h, tag, m.Path(), version)
+			if err != nil || files == nil {
+				continue
+			}
+			if modules.ManifestHash(files) == against {
+				e.AgainstTag = tag
+				e.AgainstFiles = files
+				break
+			}
+		}
+	default:
+		e.AgainstFiles, err = taggedManifest(h, against, m.Path(), version)
+		if err != nil {
+			return nil, err
+		}
+		if e.AgainstFiles == nil {
+			return nil, fmt.Errorf("%w. module %q not found at %q", ErrInput, m.Path(), against)
+		}
+		e.AgainstTag = against
+		e.AgainstHash = modules.ManifestHash(e.AgainstFiles)
+	}
+	return e, nil
+}
+
+// hashedVersion returns the highest version of m required by ms, or else the
+// version of its latest tag.
+func hashedVersion(ms []*modules.Module, m *modules.Module, tags []string) string {
+	version := ""
+	for _, s := range ms {
+		for _, r := range s.File.Require {
+			if r.Mod.Path == m.Path() && (version == "" || semver.Compare(r.Mod.Version, version) > 0) {
+				version = r.Mod.Version
+			}
+		}
+	}
+	if version != "" {
+		return version
+	}
+	if tag := lastTag(tags, m.FileName); tag != "" {
+		return tagVersion(tag)
+	}
+	return ""
+}
+
+// manifestAt returns the manifest of m at version.
+func manifestAt(m *modules.Module, version string) ([]modules.FileHash, error) {
+	previous := m.Version()
+	m.File.Module.Mod.Version = version
+	defer func() { m.File.Module.Mod.Version = previous }()
+	files, err := modules.Manifest(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash %q: %w", m.Dir(), err)
+	}
+	return files, nil
+}
+
+// taggedManifest returns the manifest of the module path in the tree of tag,
+// nil when the module is not found there.
+func taggedManifest(h history, tag, modPath, version string) ([]modules.FileHash, error) {
+	old, err := h.Archive(tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read monorepo at %q: %w", tag, err)
+	}
+	ms, err := modules.All(vfs.NewOverlay(old), ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monorepo modules at %q: %w", tag, err)
+	}
+	for _, m := range ms {
+		if m.Path() == modPath {
+			return manifestAt(m, version)
+		}
+	}
+	return nil, nil
+}
+
+// writeExplanation prints the manifest as hashed, "sha256  name" lines, and
+// the files that differ from the tree compared against.
+func writeExplanation(w io.Writer, e *hashExplanation) error {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s@%s %s\n", e.Module, e.Version, e.Hash)
+	for _, f := range e.Files {
+		fmt.Fprintf(sb, "%s  %s\n", f.SHA256, f.Name)
+	}
+	switch {
+	case e.Against == "":
+	case e.AgainstHash == e.Hash:
+		fmt.Fprintf(sb, "\nmatches %s\n", e.Against)
+	case e.AgainstFiles == nil:
+		fmt.Fprintf(sb, "\ndoes not match %s, no tagged tree has that hash\n", e.Against)
+	default:
+		fmt.Fprintf(sb, "\ndiffers from %s (%s):\n", e.AgainstTag, e.AgainstHash)
+		prefix := e.Module + "@" + e.Version + "/"
+		old := make(map[string]string, len(e.AgainstFiles))
+		for _, f := range e.AgainstFiles {
+			old[f.Name] = f.SHA256
+		}
+		for _, f := range e.Files {
+			name := strings.TrimPrefix(f.Name, prefix)
+			sha, ok := old[f.Name]
+			switch {
+			case !ok:
+				fmt.Fprintf(sb, "\tadded    %s\n", name)
+			case sha != f.SHA256:
+				fmt.Fprintf(sb, "\tchanged  %s\n", name)
+			}
+			delete(old, f.Name)
+		}
+		for _, f := range e.AgainstFiles {
+			if _, ok := old[f.Name]; ok {
+				fmt.Fprintf(sb, "\tremoved  %s\n", strings.TrimPrefix(f.Name, prefix))
+			}
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
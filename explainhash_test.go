@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/demula/mono/vfs"
+)
+
+func TestExplainHash(t *testing.T) {
+	t.Parallel()
+
+	h := history{
+		Tags: []string{"api/v0.0.1", "core/v0.1.0", "api/v0.1.0"},
+		Archive: func(rev string) (fs.FS, error) {
+			if rev == "api/v0.0.1" {
+				return os.DirFS("./testdata/apicheck/new/"), nil
+			}
+			return os.DirFS("./testdata/apicheck/old/"), nil
+		},
+	}
+	fsys := vfs.Dir("./testdata/apicheck/new/")
+	tagged, err := explainHash(os.DirFS("./testdata/apicheck/old/"), h, "api", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		version  string
+		against  string
+		expected []string
+		err      error
+	}{
+		{
+			name:   "manifest at the required version",
+			target: "api",
+			expected: []string{
+				"example.com/mono/api@v0.1.0 h1:",
+				"  example.com/mono/api@v0.1.0/api.go\n",
+				"  example.com/mono/api@v0.1.0/go.mod\n",
+			},
+		},
+		{
+			name:     "manifest by module path at a version",
+			target:   "example.com/mono/core",
+			version:  "v0.2.0",
+			expected: []string{"example.com/mono/core@v0.2.0 h1:", "  example.com/mono/core@v0.2.0/core.go\n"},
+		},
+		{
+			name:    "against a tag",
+			target:  "api",
+			against: "api/v0.1.0",
+			expected: []string{
+				"\ndiffers from api/v0.1.0 (" + tagged.Hash + "):\n",
+				"\tchanged  api.go\n",
+				"\tadded    extra/extra.go\n",
+			},
+		},
+		{
+			name:     "against an unchanged tag",
+			target:   "core",
+			against:  "api/v0.0.1",
+			expected: []string{"\nmatches api/v0.0.1\n"},
+		},
+		{
+			name:     "against the hash of a tag",
+			target:   "api",
+			against:  tagged.Hash,
+			expected: []string{"\ndiffers from api/v0.1.0 (" + tagged.Hash + "):\n", "\tchanged  api.go\n"},
+		},
+		{
+			name:     "against an unknown hash",
+			target:   "api",
+			against:  "h1:DmFUhwzq4loJyq5UPKESKNmfp1bHB5eqBhbJE9Hv2sA=",
+			expected: []string{"\ndoes not match h1:DmFUhwzq4loJyq5UPKESKNmfp1bHB5eqBhbJE9Hv2sA=, no tagged tree has that hash\n"},
+		},
+		{
+			name:   "unknown module",
+			target: "client",
+			err:    ErrInput,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			e, err := explainHash(fsys, h, test.target, test.version, test.against)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if err != nil {
+				return
+			}
+			out := &bytes.Buffer{}
+			err = writeExplanation(out, e)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			for _, expected := range test.expected {
+				if !strings.Contains(out.String(), expected) {
+					t.Errorf("expected %q in:\n%s", expected, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/demula/mono/git"
+	"github.com/demula/mono/mono"
+	"github.com/demula/mono/vfs"
+)
+
+var ErrFinalizeFailed = errors.New("finalize failed")
+
+func FinalizeCmd(
+	contextDir string,
+	fromGit string,
+	dryRun *dryRun,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "release",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			var (
+				base fs.FS
+				err  error
+			)
+			if fromGit != "" {
+				base, err = git.Archive(contextDir, fromGit)
+			} else {
+				base, err = git.Staged(contextDir)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read monorepo to finalize: %w", err)
+			}
+			fsys := vfs.NewOverlay(base)
+			err = finalize(fsys, flags.Output())
+			if errors.Is(err, ErrNoModulesFound) {
+				return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+			}
+			if dryRun != nil {
+				pErr := dryRun.preview(contextDir, fsys, flags.Output())
+				if pErr != nil {
+					return pErr
+				}
+			}
+			if !errors.Is(err, ErrFinalizeFailed) || dryRun != nil {
+				return err
+			}
+			cErr := checkUnedited(contextDir, base, fsys.Changes())
+			if cErr != nil {
+				return fmt.Errorf("%w. updated go.sum files not written: %w", err, cErr)
+			}
+			cErr = fsys.Commit(vfs.Dir(contextDir))
+			if cErr != nil {
+				return cErr
+			}
+			return fmt.Errorf("%w. updated go.sum files written, stage them and finalize again", err)
+		},
+	}
+}
+
+// checkUnedited fails when any of the files differs between base and the
+// working tree at contextDir, as writing the finalized ones over it would
+// drop those edits.
+func checkUnedited(contextDir string, base fs.FS, names []string) error {
+	var edited []string
+	for _, name := range names {
+		expected, err := fs.ReadFile(base, name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		actual, err := os.ReadFile(filepath.Join(contextDir, filepath.FromSlash(name)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if !bytes.Equal(expected, actual) {
+			edited = append(edited, name)
+		}
+	}
+	if len(edited) > 0 {
+		return fmt.Errorf("%w on %s. stage or stash them before finalizing",
+			ErrDirtyTree, strings.Join(edited, ", "))
+	}
+	return nil
+}
+
+// finalize rehashes the monorepo in fsys until its go.sum files do not change
+// and prints every entry that changed to out.
+func finalize(fsys vfs.FS, out io.Writer) error {
+	ws, err := mono.Load(fsys, nil)
+	if err != nil {
+		if errors.Is(err, mono.ErrNoModules) {
+			return ErrNoModulesFound
+		}
+		return err
+	}
+	changed, err := ws.Finalize()
+	if err != nil {
+		return err
+	}
+	for _, c := range changed {
+		_, err = fmt.Fprintf(out, "%s: %s %s %s -> %s\n",
+			c.Module, c.Entry.Path, c.Entry.Version, c.Expected, c.Actual)
+		if err != nil {
+			return err
+		}
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("%w: %d go.sum entries changed", ErrFinalizeFailed, len(changed))
+	}
+	return nil
+}
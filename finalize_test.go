@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/demula/mono/vfs"
+)
+
+func TestFinalize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		context string
+		changed string
+		errMsg  string
+	}{
+		{
+			name:    "after release",
+			context: "./testdata/prev-release/",
+		},
+		{
+			name:    "file changed after release",
+			context: "./testdata/prev-release/",
+			changed: "api/main.go",
+			errMsg:  "finalize failed: 5 go.sum entries changed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fsys := vfs.NewOverlay(os.DirFS(tt.context))
+			err := release(fsys, "v1.0.0-rc.1", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.changed != "" {
+				err = fsys.WriteFile(tt.changed, []byte("package main\n"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			out := &bytes.Buffer{}
+			err = finalize(fsys, out)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %q", err)
+				}
+				if out.Len() != 0 {
+					t.Errorf("unexpected output:\n%s", out.String())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("expected error %q, got %v", tt.errMsg, err)
+			}
+			if !strings.HasPrefix(out.String(), "github.com/demula/mono-example/core: github.com/demula/mono-example/api v1.0.0-rc.1 ") {
+				t.Errorf("unexpected output:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestFinalizeCmd(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	err := os.CopyFS(dir, os.DirFS("./testdata/prev-release/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = release(vfs.Dir(dir), "v1.0.0-rc.1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, dir, "init", "--quiet")
+	gitRun(t, dir, "add", "--all")
+	run := func() error {
+		flags := flag.NewFlagSet("release", flag.ContinueOnError)
+		flags.SetOutput(&bytes.Buffer{})
+		return FinalizeCmd(dir, "", nil, false, flags, nil).Run()
+	}
+
+	err = run()
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	// changelog like tools running after the release
+	err = os.WriteFile(filepath.Join(dir, "api", "main.go"), []byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = run()
+	if err != nil {
+		t.Fatalf("unstaged changes should not be finalized, got %q", err)
+	}
+	gitRun(t, dir, "add", "--all")
+
+	// unstaged go.sum edits are not overwritten
+	sum := filepath.Join(dir, "core", "go.sum")
+	staged, err := os.ReadFile(sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := []byte(string(staged) + "example.com/local v1.0.0/go.mod h1:local=\n")
+	err = os.WriteFile(sum, edited, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = run()
+	if err == nil || !strings.Contains(err.Error(), "uncommitted changes on core/go.sum") {
+		t.Fatalf("expected edited go.sum error, got %v", err)
+	}
+	if actual, err := os.ReadFile(sum); err != nil || !bytes.Equal(actual, edited) {
+		t.Fatalf("edited go.sum overwritten, got:\n%s", actual)
+	}
+	err = os.WriteFile(sum, staged, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = run()
+	if err == nil || !strings.Contains(err.Error(), "stage them and finalize again") {
+		t.Fatalf("expected finalize error, got %v", err)
+	}
+	gitRun(t, dir, "add", "--all")
+	err = run()
+	if err != nil {
+		t.Fatalf("unexpected error after staging finalized files %q", err)
+	}
+}
@@ -0,0 +1,382 @@
+// Package git reads the monorepo files the way git stores them so the hashes
+// calculated match the module zips the Go proxy creates from a tagged commit.
+package git
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"testing/fstest"
+)
+
+var (
+	ErrNotRepository   = errors.New("not a git repository")
+	ErrUnknownRevision = errors.New("unknown revision")
+	ErrNothingToCommit = errors.New("nothing to commit")
+)
+
+// Tracked returns the files of the working tree at dir that are tracked by
+// git. Untracked and ignored files are left out, their content is the one on
+// disk. Tracked files deleted from the working tree, symbolic links and
+// submodules are left out too, as they are not part of module zips.
+func Tracked(dir string) (fs.FS, error) {
+	_, _, err := root(dir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := run(dir, "ls-files", "-z", "--stage")
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := run(dir, "ls-files", "-z", "--deleted")
+	if err != nil {
+		return nil, err
+	}
+	isDeleted := make(map[string]bool)
+	for _, name := range strings.Split(string(deleted), "\x00") {
+		isDeleted[name] = true
+	}
+	t := &trackedFS{
+		FS:    os.DirFS(dir),
+		files: make(map[string]bool),
+		dirs:  map[string]bool{".": true},
+	}
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// <mode> <object> <stage>\t<file>
+		info, name, ok := strings.Cut(entry, "\t")
+		if !ok || isDeleted[name] {
+			continue
+		}
+		if mode, _, _ := strings.Cut(info, " "); mode != "100644" && mode != "100755" {
+			// symbolic links and submodules are not part of module zips
+			continue
+		}
+		t.files[name] = true
+		for d := path.Dir(name); d != "."; d = path.Dir(d) {
+			t.dirs[d] = true
+		}
+	}
+	return t, nil
+}
+
+type trackedFS struct {
+	fs.FS
+	files map[string]bool
+	dirs  map[string]bool
+}
+
+func (t *trackedFS) Open(name string) (fs.File, error) {
+	if !t.files[name] && !t.dirs[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return t.FS.Open(name)
+}
+
+// ReadDir lists only the tracked entries of the directory name.
+func (t *trackedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !t.dirs[name] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries, err := fs.ReadDir(t.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	tracked := entries[:0]
+	for _, e := range entries {
+		p := path.Join(name, e.Name())
+		if t.files[p] || (e.IsDir() && t.dirs[p]) {
+			tracked = append(tracked, e)
+		}
+	}
+	return tracked, nil
+}
+
+// Archive returns the files of dir as committed on revision rev. Like the go
+// command, it uses 'git archive' so export-ignore attributes and line ending
+// normalization are applied.
+func Archive(dir, rev string) (fs.FS, error) {
+	top, prefix, err := root(dir)
+	if err != nil {
+		return nil, err
+	}
+	_, err = run(top, "rev-parse", "--verify", "--quiet", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRevision, rev)
+	}
+	out, err := run(top,
+		"-c", "core.autocrlf=input", "-c", "core.eol=lf",
+		"archive", "--format=tar", rev+":"+prefix,
+	)
+	if err != nil {
+		return nil, err
+	}
+	files := fstest.MapFS{}
+	r := tar.NewReader(bytes.NewReader(out))
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q archive: %w", rev, err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			// directories are implied and symbolic links are not part of
+			// module zips
+			continue
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q from %q archive: %w", h.Name, rev, err)
+		}
+		files[path.Clean(h.Name)] = &fstest.MapFile{
+			Data:    data,
+			Mode:    fs.FileMode(h.Mode).Perm(),
+			ModTime: h.ModTime,
+		}
+	}
+	return files, nil
+}
+
+// Staged returns the files of dir as staged in the git index, the tree the
+// next commit is created from.
+func Staged(dir string) (fs.FS, error) {
+	_, _, err := root(dir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := run(dir, "ls-files", "-z", "--stage")
+	if err != nil {
+		return nil, err
+	}
+	type entry struct {
+		name   string
+		object string
+		mode   fs.FileMode
+	}
+	var entries []entry
+	objects := &bytes.Buffer{}
+	for _, line := range strings.Split(string(out), "\x00") {
+		if line == "" {
+			continue
+		}
+		// <mode> <object> <stage>\t<file>
+		info, name, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected git index entry %q", line)
+		}
+		if fields[2] != "0" {
+			return nil, fmt.Errorf("unmerged git index entry %q", name)
+		}
+		mode := fs.FileMode(0644)
+		switch fields[0] {
+		case "100755":
+			mode = 0755
+		case "100644":
+		default:
+			// symbolic links and submodules are not part of module zips
+			continue
+		}
+		entries = append(entries, entry{name: name, object: fields[1], mode: mode})
+		objects.WriteString(fields[1] + "\n")
+	}
+	out, err = runInput(dir, objects, "cat-file", "--batch")
+	if err != nil {
+		return nil, err
+	}
+	files := fstest.MapFS{}
+	for _, e := range entries {
+		// <object> blob <size>\n<content>\n
+		header, rest, ok := bytes.Cut(out, []byte("\n"))
+		fields := strings.Fields(string(header))
+		if !ok || len(fields) != 3 || fields[0] != e.object {
+			return nil, fmt.Errorf("unexpected git object header %q", header)
+		}
+		var size int
+		_, err = fmt.Sscan(fields[2], &size)
+		if err != nil || size+1 > len(rest) {
+			return nil, fmt.Errorf("unexpected git object header %q", header)
+		}
+		files[e.name] = &fstest.MapFile{Data: rest[:size], Mode: e.mode}
+		out = rest[size+1:]
+	}
+	return files, nil
+}
+
+// Dirty returns the tracked files with staged or unstaged changes of the
+// repository holding dir. Names are relative to dir so files outside of it
+// start with "../".
+func Dirty(dir string) ([]string, error) {
+	_, prefix, err := root(dir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := run(dir, "status", "--porcelain", "-z", "--untracked-files=no")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i < len(fields); i++ {
+		if len(fields[i]) < 4 {
+			continue
+		}
+		status, name := fields[i][:2], fields[i][3:]
+		if strings.ContainsAny(status, "RC") {
+			// renames and copies are followed by the original path
+			i++
+		}
+		names = append(names, relative(prefix, name))
+	}
+	return names, nil
+}
+
+// Commit stages files of dir and commits them with the given message. The
+// commit is signed when sign is true, otherwise the git configuration decides.
+func Commit(dir string, files []string, message string, sign bool) error {
+	if len(files) == 0 {
+		return ErrNothingToCommit
+	}
+	_, err := run(dir, append([]string{"add", "--"}, files...)...)
+	if err != nil {
+		return err
+	}
+	_, err = run(dir, "diff", "--cached", "--quiet")
+	if err == nil {
+		return ErrNothingToCommit
+	}
+	args := []string{"commit", "--quiet", "--message=" + message}
+	if sign {
+		args = append(args, "--gpg-sign")
+	}
+	_, err = run(dir, args...)
+	return err
+}
+
+// Tag creates the tag name on the HEAD commit of the repository holding dir.
+// Signed tags are annotated with their name as message.
+func Tag(dir, name string, sign bool) error {
+	args := []string{"tag"}
+	if sign {
+		args = append(args, "--sign", "--message="+name)
+	}
+	_, err := run(dir, append(args, name)...)
+	return err
+}
+
+// Tags returns the tags of the repository holding dir.
+func Tags(dir string) ([]string, error) {
+	out, err := run(dir, "tag", "--list")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Version returns the version of the git binary, as "2.43.0".
+func Version() (string, error) {
+	out, err := run(".", "version")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "git version "), nil
+}
+
+// Prefix returns the slash terminated path of dir inside its repository. The
+// go command expects the tags of the modules in a subdirectory to start with
+// it.
+func Prefix(dir string) (string, error) {
+	_, prefix, err := root(dir)
+	return prefix, err
+}
+
+// Changed returns the files under paths of dir whose working tree content
+// differs from revision rev. Names are relative to dir.
+func Changed(dir, rev string, paths ...string) ([]string, error) {
+	args := append([]string{"diff", "--name-only", "-z", "--relative", rev, "--"}, paths...)
+	out, err := run(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Commits counts the commits touching paths of dir since revision rev, or in
+// the whole history when rev is empty.
+func Commits(dir, rev string, paths ...string) (int, error) {
+	revs := "HEAD"
+	if rev != "" {
+		revs = rev + "..HEAD"
+	}
+	out, err := run(dir, append([]string{"rev-list", "--count", revs, "--"}, paths...)...)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+// relative returns the repository path name relative to the directory prefix.
+func relative(prefix, name string) string {
+	up := ""
+	for prefix != "" && !strings.HasPrefix(name, prefix) {
+		prefix = path.Dir(strings.TrimSuffix(prefix, "/")) + "/"
+		if prefix == "./" {
+			prefix = ""
+		}
+		up += "../"
+	}
+	return up + name[len(prefix):]
+}
+
+// root returns the top level directory of the repository holding dir and the
+// slash terminated path of dir inside it.
+func root(dir string) (string, string, error) {
+	out, err := run(dir, "rev-parse", "--show-toplevel", "--show-prefix")
+	if err != nil {
+		if strings.Contains(err.Error(), "not a git repository") {
+			return "", "", fmt.Errorf("%w: %q", ErrNotRepository, dir)
+		}
+		return "", "", err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != 2 {
+		return lines[0], "", nil
+	}
+	return lines[0], lines[1], nil
+}
+
+func run(dir string, args ...string) ([]byte, error) {
+	return runInput(dir, nil, args...)
+}
+
+func runInput(dir string, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+		}
+		return nil, fmt.Errorf("git %s: %s: %w", strings.Join(args, " "), msg, err)
+	}
+	return out, nil
+}
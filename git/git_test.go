@@ -0,0 +1,362 @@
+package git_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/demula/mono/git"
+)
+
+func TestTracked(t *testing.T) {
+	dir := newRepo(t)
+	write(t, dir, "api/go.mod", "module example.com/api\n")
+	write(t, dir, "api/api.go", "package api\n")
+	commit(t, dir)
+	write(t, dir, "api/.env", "SECRET=1\n")
+	write(t, dir, "api/build/out", "binary\n")
+
+	fsys, err := git.Tracked(dir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	files := walk(t, fsys)
+	expected := []string{"api/api.go", "api/go.mod"}
+	if !slices.Equal(files, expected) {
+		t.Errorf("expected files %v, got %v", expected, files)
+	}
+	_, err = fs.ReadFile(fsys, "api/.env")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected untracked file to not exist, got %v", err)
+	}
+
+	sub, err := git.Tracked(filepath.Join(dir, "api"))
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	files = walk(t, sub)
+	expected = []string{"api.go", "go.mod"}
+	if !slices.Equal(files, expected) {
+		t.Errorf("expected files %v on subdirectory, got %v", expected, files)
+	}
+}
+
+func TestTrackedDeletedSubmodulesAndSymlinks(t *testing.T) {
+	dir := newRepo(t)
+	write(t, dir, "api/go.mod", "module example.com/api\n")
+	write(t, dir, "api/api.go", "package api\n")
+	write(t, dir, "api/old/old.go", "package old\n")
+	write(t, dir, "api/sub/sub.go", "package sub\n")
+	sub := filepath.Join(dir, "api", "sub")
+	run(t, sub, "init", "--quiet")
+	run(t, sub, "config", "user.name", "mono")
+	run(t, sub, "config", "user.email", "mono@example.com")
+	run(t, sub, "config", "commit.gpgSign", "false")
+	commit(t, sub)
+	err := os.Symlink("api.go", filepath.Join(dir, "api", "link.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the nested repository is added as a submodule gitlink
+	commit(t, dir)
+	err = os.RemoveAll(filepath.Join(dir, "api", "old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := git.Tracked(dir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	files := walk(t, fsys)
+	expected := []string{"api/api.go", "api/go.mod"}
+	if !slices.Equal(files, expected) {
+		t.Errorf("expected files %v, got %v", expected, files)
+	}
+	for _, name := range []string{"api/old/old.go", "api/old", "api/sub", "api/sub/sub.go", "api/link.go"} {
+		_, err = fs.Stat(fsys, name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected %q to not exist, got %v", name, err)
+		}
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir := newRepo(t)
+	write(t, dir, "api/go.mod", "module example.com/api\n")
+	commit(t, dir)
+	run(t, dir, "tag", "v0.1.0")
+	write(t, dir, "api/api.go", "package api\n")
+	commit(t, dir)
+
+	fsys, err := git.Archive(filepath.Join(dir, "api"), "v0.1.0")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	files := walk(t, fsys)
+	if !slices.Equal(files, []string{"go.mod"}) {
+		t.Errorf("unexpected files at v0.1.0 %v", files)
+	}
+
+	fsys, err = git.Archive(dir, "HEAD")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	files = walk(t, fsys)
+	if !slices.Equal(files, []string{"api/api.go", "api/go.mod"}) {
+		t.Errorf("unexpected files at HEAD %v", files)
+	}
+
+	_, err = git.Archive(dir, "v9.9.9")
+	if !errors.Is(err, git.ErrUnknownRevision) {
+		t.Errorf("expected unknown revision error, got %v", err)
+	}
+}
+
+func TestStaged(t *testing.T) {
+	dir := newRepo(t)
+	write(t, dir, "api/go.mod", "module example.com/api\n")
+	write(t, dir, "api/go.sum", "")
+	commit(t, dir)
+	write(t, dir, "api/go.mod", "module example.com/api\n\ngo 1.25\n")
+	run(t, dir, "add", "api/go.mod")
+	write(t, dir, "api/go.mod", "module example.com/api/v2\n")
+	write(t, dir, "api/api.go", "package api\n")
+
+	fsys, err := git.Staged(filepath.Join(dir, "api"))
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	files := walk(t, fsys)
+	if !slices.Equal(files, []string{"go.mod", "go.sum"}) {
+		t.Errorf("unexpected staged files %v", files)
+	}
+	data, err := fs.ReadFile(fsys, "go.mod")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if string(data) != "module example.com/api\n\ngo 1.25\n" {
+		t.Errorf("unexpected staged content %q", data)
+	}
+}
+
+func TestDirty(t *testing.T) {
+	dir := newRepo(t)
+	write(t, dir, "api/go.mod", "module example.com/api\n")
+	write(t, dir, "core/go.mod", "module example.com/core\n")
+	write(t, dir, "go.work", "go 1.25\n")
+	commit(t, dir)
+	write(t, dir, "api/go.mod", "module example.com/api/v2\n")
+	write(t, dir, "go.work", "go 1.25.1\n")
+	write(t, dir, "core/untracked.go", "package core\n")
+	run(t, dir, "mv", "core/go.mod", "core/go.mod.bak")
+
+	dirty, err := git.Dirty(filepath.Join(dir, "api"))
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	slices.Sort(dirty)
+	expected := []string{"../core/go.mod.bak", "../go.work", "go.mod"}
+	if !slices.Equal(dirty, expected) {
+		t.Errorf("expected dirty files %v, got %v", expected, dirty)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	dir := newRepo(t)
+	write(t, dir, "api/go.mod", "module example.com/api\n")
+	write(t, dir, "api/go.sum", "")
+	commit(t, dir)
+
+	err := git.Commit(dir, []string{"api/go.mod"}, "chore(release): v0.1.0", false)
+	if !errors.Is(err, git.ErrNothingToCommit) {
+		t.Errorf("expected nothing to commit error, got %v", err)
+	}
+
+	write(t, dir, "api/go.mod", "module example.com/api\n\ngo 1.25\n")
+	write(t, dir, "api/go.sum", "changed\n")
+	err = git.Commit(filepath.Join(dir, "api"), []string{"go.mod"}, "chore(release): v0.1.0", false)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	dirty, err := git.Dirty(dir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if !slices.Equal(dirty, []string{"api/go.sum"}) {
+		t.Errorf("only the given files should be committed, dirty: %v", dirty)
+	}
+	out, err := exec.Command("git", "-C", dir, "log", "-1", "--format=%s").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "chore(release): v0.1.0\n" {
+		t.Errorf("unexpected commit message %q", out)
+	}
+}
+
+func TestTag(t *testing.T) {
+	dir := newRepo(t)
+	write(t, dir, "mono/api/go.mod", "module example.com/api\n")
+	commit(t, dir)
+
+	err := git.Tag(filepath.Join(dir, "mono"), "mono/api/v0.1.0", false)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	tags, err := git.Tags(dir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if !slices.Equal(tags, []string{"mono/api/v0.1.0"}) {
+		t.Errorf("expected the new tag, got %v", tags)
+	}
+	err = git.Tag(dir, "mono/api/v0.1.0", false)
+	if err == nil {
+		t.Errorf("expected error creating an existing tag")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	v, err := git.Version()
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if v == "" || strings.HasPrefix(v, "git") {
+		t.Errorf("expected a bare version, got %q", v)
+	}
+}
+
+func TestTagsAndChanged(t *testing.T) {
+	dir := newRepo(t)
+	write(t, dir, "mono/api/go.mod", "module example.com/api\n")
+	write(t, dir, "mono/core/go.mod", "module example.com/core\n")
+	commit(t, dir)
+	run(t, dir, "tag", "mono/api/v0.1.0")
+	run(t, dir, "tag", "v0.1.0")
+	write(t, dir, "mono/api/api.go", "package api\n")
+	run(t, dir, "add", "mono/api/api.go")
+	write(t, dir, "mono/core/go.mod", "module example.com/core\n\ngo 1.25\n")
+
+	tags, err := git.Tags(dir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	expected := []string{"mono/api/v0.1.0", "v0.1.0"}
+	if !slices.Equal(tags, expected) {
+		t.Errorf("expected tags %v, got %v", expected, tags)
+	}
+	mono := filepath.Join(dir, "mono")
+	prefix, err := git.Prefix(mono)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if prefix != "mono/" {
+		t.Errorf("expected prefix %q, got %q", "mono/", prefix)
+	}
+	changed, err := git.Changed(mono, "mono/api/v0.1.0", "api")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if !slices.Equal(changed, []string{"api/api.go"}) {
+		t.Errorf("expected changed files %v, got %v", []string{"api/api.go"}, changed)
+	}
+	changed, err = git.Changed(mono, "v0.1.0")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if !slices.Equal(changed, []string{"api/api.go", "core/go.mod"}) {
+		t.Errorf("expected all changed files, got %v", changed)
+	}
+	commit(t, dir)
+	count, err := git.Commits(mono, "mono/api/v0.1.0", "api")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 commit since tag, got %d", count)
+	}
+	count, err = git.Commits(mono, "", "core")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 commits in history, got %d", count)
+	}
+}
+
+func TestNotRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	_, err := git.Tracked(t.TempDir())
+	if !errors.Is(err, git.ErrNotRepository) {
+		t.Errorf("expected not a repository error, got %v", err)
+	}
+}
+
+func newRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	run(t, dir, "init", "--quiet")
+	run(t, dir, "config", "user.name", "mono")
+	run(t, dir, "config", "user.email", "mono@example.com")
+	run(t, dir, "config", "commit.gpgSign", "false")
+	write(t, dir, ".gitignore", "build/\n")
+	return dir
+}
+
+func commit(t *testing.T, dir string) {
+	t.Helper()
+	run(t, dir, "add", "--all")
+	run(t, dir, "commit", "--quiet", "--message=test")
+}
+
+func run(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %s: %s", args, err, out)
+	}
+}
+
+func write(t *testing.T, dir, name, content string) {
+	t.Helper()
+	name = filepath.Join(dir, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(name, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func walk(t *testing.T, fsys fs.FS) []string {
+	t.Helper()
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && name != ".gitignore" {
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	return files
+}
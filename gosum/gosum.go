@@ -11,6 +11,8 @@ package gosum
 
 import (
 	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -23,11 +25,88 @@ import (
 // We detect and remove them.
 const emptyGoModHash = "h1:G7mAYYxgmS0lVkHyy2hEOLQCFB0DlQFTMLWggykrydY="
 
+var (
+	ErrMalformedLine       = errors.New("malformed line")
+	ErrInvalidPath         = errors.New("invalid module path")
+	ErrNonCanonicalVersion = errors.New("non-canonical version")
+	ErrDuplicateLine       = errors.New("duplicate line")
+	ErrUnknownHash         = errors.New("unknown hash algorithm")
+	ErrMalformedHash       = errors.New("malformed hash")
+	ErrEmptyGoModHash      = errors.New("obsolete empty go.mod hash")
+)
+
+// Error is a problem found on a single line of a go.sum file.
+type Error struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrorList is the list of problems found on a go.sum file.
+type ErrorList []*Error
+
+func (e ErrorList) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e ErrorList) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Read adds the go.sum file contents into dst skipping malformed lines. A
+// missing file is not an error.
 func Read(dst map[module.Version][]string, file string) error {
 	data, err := os.ReadFile(file)
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	Parse(dst, file, data)
+	return nil
+}
+
+// ReadStrict works as Read but returns an ErrorList with every line that
+// is malformed, duplicated or that holds an invalid module path, version or
+// hash. Those lines are not added to dst.
+func ReadStrict(dst map[module.Version][]string, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return ParseStrict(dst, file, data)
+}
+
+// Parse adds data contents into dst the same way the go command does,
+// silently dropping malformed lines.
+func Parse(dst map[module.Version][]string, file string, data []byte) {
+	_ = parse(dst, file, data, false)
+}
+
+// ParseStrict adds data contents into dst returning an ErrorList with the
+// problems found. file is only used for reporting.
+func ParseStrict(dst map[module.Version][]string, file string, data []byte) error {
+	return parse(dst, file, data, true)
+}
+
+func parse(dst map[module.Version][]string, file string, data []byte, strict bool) error {
+	var errs ErrorList
+	report := func(lineno int, err error) {
+		errs = append(errs, &Error{File: file, Line: lineno, Err: err})
+	}
+	seen := make(map[string]int)
 
 	lineno := 0
 	for len(data) > 0 {
@@ -46,15 +125,57 @@ func Read(dst map[module.Version][]string, file string) error {
 		}
 		if len(f) != 3 {
 			// ignore malformed line
+			if strict {
+				report(lineno, fmt.Errorf("%w: expected 3 fields, found %d", ErrMalformedLine, len(f)))
+			}
 			continue
 		}
 		if f[2] == emptyGoModHash {
 			// Old bug; drop it.
+			if strict {
+				report(lineno, ErrEmptyGoModHash)
+			}
 			continue
 		}
+		if strict {
+			err := checkLine(f[0], f[1], f[2])
+			if err != nil {
+				report(lineno, err)
+				continue
+			}
+			key := strings.Join(f, " ")
+			if first, ok := seen[key]; ok {
+				report(lineno, fmt.Errorf("%w: already on line %d", ErrDuplicateLine, first))
+				continue
+			}
+			seen[key] = lineno
+		}
 		mod := module.Version{Path: f[0], Version: f[1]}
 		dst[mod] = append(dst[mod], f[2])
 	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkLine(path, version, hash string) error {
+	err := module.CheckPath(path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPath, err)
+	}
+	v := strings.TrimSuffix(version, "/go.mod")
+	if module.CanonicalVersion(v) != v {
+		return fmt.Errorf("%w %q", ErrNonCanonicalVersion, version)
+	}
+	alg, sum, ok := strings.Cut(hash, ":")
+	if !ok || alg != "h1" {
+		return fmt.Errorf("%w %q", ErrUnknownHash, alg)
+	}
+	b, err := base64.StdEncoding.DecodeString(sum)
+	if err != nil || len(b) != 32 {
+		return fmt.Errorf("%w %q", ErrMalformedHash, hash)
+	}
 	return nil
 }
 
@@ -0,0 +1,134 @@
+package gosum_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/demula/mono/gosum"
+	"golang.org/x/mod/module"
+)
+
+func TestParseStrict(t *testing.T) {
+	const (
+		zip   = "h1:sjRTlvgW2Y1jFzOQRR87ho1O2eM6KGuysl5IbeqRwaE="
+		gomod = "h1:D5a3K3mt3F4Pl63UfTUNn+mGZzzT4OpD0xi2bhJCeqU="
+	)
+	tests := []struct {
+		name     string
+		content  string
+		expected []error
+		lines    []int
+		entries  int
+	}{
+		{
+			name: "valid",
+			content: "" +
+				"example.com/api v1.0.0 " + zip + "\n" +
+				"\n" +
+				"example.com/api v1.0.0/go.mod " + gomod + "\n" +
+				"example.com/old v2.0.0+incompatible " + zip,
+			entries: 3,
+		},
+		{
+			name: "malformed line",
+			content: "" +
+				"example.com/api v1.0.0 " + zip + "\n" +
+				"<<<<<<< HEAD\n",
+			expected: []error{gosum.ErrMalformedLine},
+			lines:    []int{2},
+			entries:  1,
+		},
+		{
+			name:     "invalid module path",
+			content:  "example.com/api. v1.0.0 " + zip + "\n",
+			expected: []error{gosum.ErrInvalidPath},
+			lines:    []int{1},
+		},
+		{
+			name: "non-canonical version",
+			content: "" +
+				"example.com/api v1.0 " + zip + "\n" +
+				"example.com/api v1.0.0+build/go.mod " + gomod + "\n",
+			expected: []error{gosum.ErrNonCanonicalVersion, gosum.ErrNonCanonicalVersion},
+			lines:    []int{1, 2},
+		},
+		{
+			name: "duplicate line",
+			content: "" +
+				"example.com/api v1.0.0 " + zip + "\n" +
+				"example.com/api v1.0.0/go.mod " + gomod + "\n" +
+				"example.com/api v1.0.0 " + zip + "\n",
+			expected: []error{gosum.ErrDuplicateLine},
+			lines:    []int{3},
+			entries:  2,
+		},
+		{
+			name: "unknown hash algorithm",
+			content: "" +
+				"example.com/api v1.0.0 h2:sjRTlvgW2Y1jFzOQRR87ho1O2eM6KGuysl5IbeqRwaE=\n" +
+				"example.com/api v1.0.0/go.mod D5a3K3mt3F4Pl63UfTUNn+mGZzzT4OpD0xi2bhJCeqU=\n",
+			expected: []error{gosum.ErrUnknownHash, gosum.ErrUnknownHash},
+			lines:    []int{1, 2},
+		},
+		{
+			name:     "malformed hash",
+			content:  "example.com/api v1.0.0 h1:sjRTlvgW2Y1jFz\n",
+			expected: []error{gosum.ErrMalformedHash},
+			lines:    []int{1},
+		},
+		{
+			name:     "empty go.mod hash",
+			content:  "example.com/api v1.0.0/go.mod h1:G7mAYYxgmS0lVkHyy2hEOLQCFB0DlQFTMLWggykrydY=\n",
+			expected: []error{gosum.ErrEmptyGoModHash},
+			lines:    []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := make(map[module.Version][]string)
+			err := gosum.ParseStrict(dst, "go.sum", []byte(tt.content))
+
+			entries := 0
+			for _, hashes := range dst {
+				entries += len(hashes)
+			}
+			if entries != tt.entries {
+				t.Errorf("expected %d entries, got %d", tt.entries, entries)
+			}
+			if len(tt.expected) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error %q", err)
+				}
+				return
+			}
+			var errs gosum.ErrorList
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected error list, got %v", err)
+			}
+			if len(errs) != len(tt.expected) {
+				t.Fatalf("expected %d errors, got %d: %s", len(tt.expected), len(errs), err)
+			}
+			for i, e := range errs {
+				if !errors.Is(e, tt.expected[i]) {
+					t.Errorf("error %q is not %q", e, tt.expected[i])
+				}
+				if e.File != "go.sum" || e.Line != tt.lines[i] {
+					t.Errorf("error %q expected at go.sum:%d", e, tt.lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	content := "" +
+		"example.com/api v1.0.0 h1:sjRTlvgW2Y1jFzOQRR87ho1O2eM6KGuysl5IbeqRwaE=\n" +
+		"malformed\n" +
+		"example.com/api v1.0.0/go.mod h1:G7mAYYxgmS0lVkHyy2hEOLQCFB0DlQFTMLWggykrydY=\n"
+	dst := make(map[module.Version][]string)
+	gosum.Parse(dst, "go.sum", []byte(content))
+	if len(dst) != 1 {
+		t.Errorf("expected malformed and obsolete lines to be skipped, got %v", dst)
+	}
+}
@@ -0,0 +1,136 @@
+// Package license classifies license texts into SPDX identifiers.
+//
+// Texts are matched against the phrases that identify each license once
+// normalized (lower case words separated by single spaces) so formatting,
+// copyright lines and small wording changes do not matter.
+package license
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// NoAssertion is the SPDX value used when a license can not be determined.
+const NoAssertion = "NOASSERTION"
+
+// rule identifies the license ID when all of its phrases are found. Rules are
+// tried in order so licenses quoting others (i.e. GPL-3.0 mentions the Affero
+// and Lesser variants) come after them. OrLater is the ID used instead when
+// the text also grants any later version of the license.
+type rule struct {
+	ID      string
+	Phrases []string
+	OrLater string
+}
+
+var rules = []rule{
+	{"AGPL-3.0-only", []string{"gnu affero general public license version 3 19 november 2007"}, "AGPL-3.0-or-later"},
+	{"LGPL-3.0-only", []string{"gnu lesser general public license version 3 29 june 2007"}, "LGPL-3.0-or-later"},
+	{"LGPL-2.1-only", []string{"gnu lesser general public license version 2 1 february 1999"}, "LGPL-2.1-or-later"},
+	{"GPL-3.0-only", []string{"gnu general public license version 3 29 june 2007"}, "GPL-3.0-or-later"},
+	{"GPL-2.0-only", []string{"gnu general public license version 2 june 1991"}, "GPL-2.0-or-later"},
+	{"MPL-2.0", []string{"mozilla public license version 2 0"}, ""},
+	{"Apache-2.0", []string{"apache license", "version 2 0", "terms and conditions for use reproduction and distribution"}, ""},
+	{"BSL-1.0", []string{"boost software license version 1 0"}, ""},
+	{"BSD-3-Clause", []string{
+		"redistribution and use in source and binary forms with or without modification are permitted",
+		"redistributions in binary form must reproduce the above copyright notice",
+		"neither the name of",
+	}, ""},
+	{"BSD-2-Clause", []string{
+		"redistribution and use in source and binary forms with or without modification are permitted",
+		"redistributions in binary form must reproduce the above copyright notice",
+	}, ""},
+	{"MIT", []string{
+		"permission is hereby granted free of charge to any person obtaining a copy of this software",
+		"the above copyright notice and this permission notice shall be included in all copies or substantial portions of the software",
+	}, ""},
+	{"ISC", []string{
+		"permission to use copy modify and or distribute this software for any purpose with or without fee is hereby granted",
+		"provided that the above copyright notice and this permission notice appear in all copies",
+	}, ""},
+	{"0BSD", []string{
+		"permission to use copy modify and or distribute this software for any purpose with or without fee is hereby granted",
+	}, ""},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}, ""},
+	{"CC0-1.0", []string{"cc0 1 0 universal"}, ""},
+}
+
+const (
+	// orLaterClause grants any later version of the GNU licenses.
+	orLaterClause = " or at your option any later version "
+	// templateNotice starts the example notice of the "How to Apply These
+	// Terms" appendix, which holds orLaterClause in every GNU license text.
+	templateNotice = " copyright c year name of author "
+)
+
+// Classify returns the SPDX identifier of the license text or an empty string
+// when it is not recognised.
+func Classify(text []byte) string {
+	normalized := normalize(string(text))
+	for _, r := range rules {
+		if !slices.ContainsFunc(r.Phrases, func(p string) bool {
+			return !strings.Contains(normalized, " "+p+" ")
+		}) {
+			if r.OrLater != "" && isOrLater(normalized) {
+				return r.OrLater
+			}
+			return r.ID
+		}
+	}
+	return ""
+}
+
+// IDs returns the SPDX identifiers recognised by Classify.
+func IDs() []string {
+	ids := make([]string, 0, len(rules))
+	for _, r := range rules {
+		ids = append(ids, r.ID)
+		if r.OrLater != "" {
+			ids = append(ids, r.OrLater)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Matches reports whether the SPDX expression holds a license of the deny
+// list. Entries match identifiers exactly or as a prefix followed by a dash
+// so "GPL" denies "GPL-3.0-only" but not "LGPL-3.0-only".
+func Matches(expr string, deny []string) bool {
+	for _, id := range strings.Fields(expr) {
+		id = strings.Trim(id, "()")
+		for _, d := range deny {
+			if d == "" {
+				continue
+			}
+			if strings.EqualFold(id, d) || strings.HasPrefix(strings.ToLower(id), strings.ToLower(d)+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isOrLater reports whether the normalized text grants any later version
+// outside of the example notices of the license appendix.
+func isOrLater(normalized string) bool {
+	for {
+		before, after, ok := strings.Cut(normalized, templateNotice)
+		if !ok {
+			return strings.Contains(normalized, orLaterClause)
+		}
+		if _, rest, ok := strings.Cut(after, orLaterClause); ok {
+			after = rest
+		}
+		normalized = before + " " + after
+	}
+}
+
+func normalize(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return " " + strings.Join(words, " ") + " "
+}
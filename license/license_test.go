@@ -0,0 +1,64 @@
+package license_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/demula/mono/license"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		file     string
+		expected string
+	}{
+		{name: "apache", file: "../LICENSE", expected: "Apache-2.0"},
+		{name: "notice with bsd appendix", file: "../NOTICE", expected: "BSD-3-Clause"},
+		{name: "unknown", file: "testdata/unknown.txt", expected: ""},
+		{name: "mit", file: "testdata/MIT.txt", expected: "MIT"},
+		{name: "bsd 3 clause", file: "testdata/BSD-3-Clause.txt", expected: "BSD-3-Clause"},
+		{name: "isc", file: "testdata/ISC.txt", expected: "ISC"},
+		{name: "agpl", file: "testdata/AGPL-3.0-only.txt", expected: "AGPL-3.0-only"},
+		{name: "gpl quoting agpl and lgpl", file: "testdata/GPL-3.0-only.txt", expected: "GPL-3.0-only"},
+		{name: "gpl or later notice", file: "testdata/GPL-3.0-or-later.txt", expected: "GPL-3.0-or-later"},
+		{name: "lgpl or later notice after the appendix", file: "testdata/LGPL-2.1-or-later.txt", expected: "LGPL-2.1-or-later"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			data, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := license.Classify(data)
+			if actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr     string
+		deny     []string
+		expected bool
+	}{
+		{expr: "AGPL-3.0-only", deny: []string{"AGPL"}, expected: true},
+		{expr: "MIT AND AGPL-3.0-only", deny: []string{"agpl-3.0-only"}, expected: true},
+		{expr: "LGPL-3.0-only", deny: []string{"GPL"}, expected: false},
+		{expr: "GPL-2.0-only", deny: []string{"GPL"}, expected: true},
+		{expr: "MIT", deny: []string{""}, expected: false},
+	}
+	for _, tt := range tests {
+		actual := license.Matches(tt.expr, tt.deny)
+		if actual != tt.expected {
+			t.Errorf("expected %q matching %v to be %t", tt.expr, tt.deny, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/demula/mono/license"
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/module"
+)
+
+const licensesUsage = "" +
+	`Running on the root of your monorepo to report the licenses of every module
+and its external dependencies (found in the local module cache):
+	mono licenses
+
+Specify the root of your monorepo when not in current directory :
+	mono licenses --context="./testdata"
+
+The report can be written as markdown (default), json or csv:
+	mono licenses --format=json > licenses.json
+
+Fail when any license matches the deny list (prefixes are allowed):
+	mono licenses --deny="AGPL,GPL-3.0-only"
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+var (
+	ErrDeniedLicense = errors.New("denied license found")
+	licenseFormats   = []string{"markdown", "json", "csv"}
+)
+
+// licenseEntry is a row of the licenses report.
+type licenseEntry struct {
+	// Module is the monorepo module the entry belongs to.
+	Module string `json:"module"`
+	// Path is the module itself or one of its external dependencies.
+	Path    string   `json:"path"`
+	Version string   `json:"version,omitempty"`
+	License string   `json:"license"`
+	Files   []string `json:"files,omitempty"`
+	Denied  bool     `json:"denied,omitempty"`
+}
+
+var licensesCommand = &subcommand{
+	Name:          "licenses",
+	Summary:       "report the licenses of the modules and their dependencies",
+	Usage:         licensesUsage,
+	FlagsComplete: map[string]completer{"format": completeValues(licenseFormats...)},
+	Flags: func(fs *flag.FlagSet) builder {
+		var (
+			format       = fs.String("format", "markdown", "report format: "+strings.Join(licenseFormats, ", "))
+			deny         = fs.String("deny", "", "comma separated SPDX identifiers (or prefixes) to fail on")
+			modCacheDir  = fs.String("modcache", defaultModCache(), "go module cache directory")
+			licenseFiles = fs.String("license-files", strings.Join(modules.LicenseFiles, ","),
+				"comma separated license and notice file names")
+		)
+		return func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+			if !slices.Contains(licenseFormats, *format) {
+				return nil, fmt.Errorf("%w. unknown format %q", ErrInput, *format)
+			}
+			return LicensesCmd(
+				g.ContextDir,
+				*modCacheDir,
+				*format,
+				strings.Split(*deny, ","),
+				licenseNames(*licenseFiles),
+				g.IsDebug,
+				flags,
+				args,
+			), nil
+		}
+	},
+}
+
+func LicensesCmd(
+	contextDir string,
+	modCacheDir string,
+	format string,
+	deny []string,
+	licenseFiles []string,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "licenses",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			entries, err := licenses(vfs.Dir(contextDir), os.DirFS(modCacheDir), licenseFiles, deny)
+			if err != nil {
+				if errors.Is(err, ErrNoModulesFound) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			err = writeLicenses(os.Stdout, format, entries)
+			if err != nil {
+				return err
+			}
+			var denied []string
+			for _, e := range entries {
+				if e.Denied && !slices.Contains(denied, e.Path) {
+					denied = append(denied, e.Path)
+				}
+			}
+			if len(denied) > 0 {
+				return fmt.Errorf("%w on %s", ErrDeniedLicense, strings.Join(denied, ", "))
+			}
+			return nil
+		},
+	}
+}
+
+// licenses classifies the licenses of the monorepo modules and of their
+// external requirements found in modCache.
+func licenses(fsys vfs.FS, modCache fs.FS, licenseFiles, deny []string) ([]licenseEntry, error) {
+	ms, err := modules.AllLicensed(fsys, ".", licenseFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, ErrNoModulesFound
+	}
+	var entries []licenseEntry
+	for _, m := range ms {
+		names, err := modules.Licenses(m, licenseFiles)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look for %q licenses: %w", m.Dir(), err)
+		}
+		e := licenseEntry{Module: m.Path(), Path: m.Path(), Files: names}
+		e.License, err = classify(names, func(name string) ([]byte, error) {
+			if name == "LICENSE" && len(m.License) > 0 {
+				return fs.ReadFile(m.FS, m.License)
+			}
+			return fs.ReadFile(m.FS, path.Join(m.Dir(), name))
+		})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+
+		for _, r := range m.File.Require {
+			mv := replaced(m, r.Mod)
+			if slices.ContainsFunc(ms, func(s *modules.Module) bool { return s.Path() == mv.Path }) {
+				continue
+			}
+			e, err := dependencyLicense(modCache, mv, licenseFiles)
+			if err != nil {
+				return nil, err
+			}
+			e.Module = m.Path()
+			entries = append(entries, e)
+		}
+	}
+	for i := range entries {
+		entries[i].Denied = license.Matches(entries[i].License, deny)
+	}
+	return entries, nil
+}
+
+// replaced returns the module version that is used instead of mv.
+func replaced(m *modules.Module, mv module.Version) module.Version {
+	for _, r := range m.File.Replace {
+		if r.Old.Path == mv.Path && (r.Old.Version == "" || r.Old.Version == mv.Version) {
+			return r.New
+		}
+	}
+	return mv
+}
+
+// dependencyLicense classifies the licenses of mv as extracted in the module
+// cache. Local replacements and modules not downloaded get no assertion.
+func dependencyLicense(modCache fs.FS, mv module.Version, licenseFiles []string) (licenseEntry, error) {
+	e := licenseEntry{Path: mv.Path, Version: mv.Version, License: license.NoAssertion}
+	if mv.Version == "" {
+		return e, nil
+	}
+	escPath, err := module.EscapePath(mv.Path)
+	if err != nil {
+		return e, err
+	}
+	escVersion, err := module.EscapeVersion(mv.Version)
+	if err != nil {
+		return e, err
+	}
+	dir := escPath + "@" + escVersion
+	entries, err := fs.ReadDir(modCache, dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return e, nil
+	}
+	if err != nil {
+		return e, err
+	}
+	for _, f := range entries {
+		if !f.IsDir() && slices.Contains(licenseFiles, f.Name()) {
+			e.Files = append(e.Files, f.Name())
+		}
+	}
+	e.License, err = classify(e.Files, func(name string) ([]byte, error) {
+		return fs.ReadFile(modCache, path.Join(dir, name))
+	})
+	return e, err
+}
+
+// classify returns the SPDX expression joining the licenses of the files.
+func classify(names []string, read func(string) ([]byte, error)) (string, error) {
+	var ids []string
+	for _, name := range names {
+		data, err := read(name)
+		if err != nil {
+			return "", err
+		}
+		id := license.Classify(data)
+		if id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return license.NoAssertion, nil
+	}
+	return strings.Join(ids, " AND "), nil
+}
+
+func writeLicenses(w io.Writer, format string, entries []licenseEntry) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if entries == nil {
+			entries = []licenseEntry{}
+		}
+		return enc.Encode(entries)
+	case "csv":
+		cw := csv.NewWriter(w)
+		err := cw.Write([]string{"module", "path", "version", "license", "files", "denied"})
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			err = cw.Write([]string{
+				e.Module, e.Path, e.Version, e.License,
+				strings.Join(e.Files, ";"), fmt.Sprint(e.Denied),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		_, err := fmt.Fprintln(w, "| Module | Path | Version | License | Files |\n| --- | --- | --- | --- | --- |")
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			lic := e.License
+			if e.Denied {
+				lic = "**" + lic + "** (denied)"
+			}
+			_, err = fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n",
+				e.Module, e.Path, e.Version, lic, strings.Join(e.Files, ", "))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// defaultModCache returns the module cache directory as the go command does.
+func defaultModCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		gopath = filepath.Join(home, "go")
+	}
+	return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+}
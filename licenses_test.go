@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+)
+
+func TestLicenses(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		context  string
+		deny     []string
+		expected map[string]string
+		denied   []string
+		errMsg   string
+	}{
+		{
+			name:    "modules and external dependencies",
+			context: "./testdata/licensed/",
+			expected: map[string]string{
+				"example.com/mono/api example.com/mono/api":   "MIT",
+				"example.com/mono/api example.com/dep":        "BSD-3-Clause",
+				"example.com/mono/api example.com/missing":    "NOASSERTION",
+				"example.com/mono/core example.com/mono/core": "Apache-2.0",
+				"example.com/mono/core example.com/Copyleft":  "AGPL-3.0-only",
+				"example.com/mono/core example.com/dep":       "BSD-3-Clause",
+				"example.com/mono/core example.com/missing":   "NOASSERTION",
+			},
+		},
+		{
+			name:    "deny list",
+			context: "./testdata/licensed/",
+			deny:    []string{"AGPL", "MIT"},
+			denied:  []string{"example.com/mono/api", "example.com/Copyleft"},
+		},
+		{
+			name:    "no modules found",
+			context: "./testdata/empty/",
+			errMsg:  "no modules found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := licenses(
+				vfs.Dir(tt.context),
+				os.DirFS("./testdata/modcache/"),
+				modules.LicenseFiles,
+				tt.deny,
+			)
+			if tt.errMsg != "" {
+				if err == nil || err.Error() != tt.errMsg {
+					t.Fatalf("expected error %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			var denied []string
+			for _, e := range actual {
+				if e.Denied {
+					denied = append(denied, e.Path)
+				}
+				if tt.expected == nil {
+					continue
+				}
+				key := e.Module + " " + e.Path
+				if tt.expected[key] != e.License {
+					t.Errorf("expected %q license %q, got %q", key, tt.expected[key], e.License)
+				}
+			}
+			if tt.expected != nil && len(actual) != len(tt.expected) {
+				t.Errorf("expected %d entries, got %+v", len(tt.expected), actual)
+			}
+			if len(denied) != len(tt.denied) {
+				t.Errorf("expected denied %v, got %v", tt.denied, denied)
+			}
+		})
+	}
+}
+
+func TestWriteLicenses(t *testing.T) {
+	t.Parallel()
+
+	entries := []licenseEntry{
+		{Module: "example.com/mono/api", Path: "example.com/mono/api", License: "MIT", Files: []string{"LICENSE"}},
+		{Module: "example.com/mono/api", Path: "example.com/dep", Version: "v1.0.0", License: "AGPL-3.0-only", Files: []string{"COPYING"}, Denied: true},
+	}
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: "markdown",
+			expected: "| Module | Path | Version | License | Files |\n" +
+				"| --- | --- | --- | --- | --- |\n" +
+				"| example.com/mono/api | example.com/mono/api |  | MIT | LICENSE |\n" +
+				"| example.com/mono/api | example.com/dep | v1.0.0 | **AGPL-3.0-only** (denied) | COPYING |\n",
+		},
+		{
+			format: "csv",
+			expected: "module,path,version,license,files,denied\n" +
+				"example.com/mono/api,example.com/mono/api,,MIT,LICENSE,false\n" +
+				"example.com/mono/api,example.com/dep,v1.0.0,AGPL-3.0-only,COPYING,true\n",
+		},
+		{
+			format: "json",
+			expected: `[
+  {
+    "module": "example.com/mono/api",
+    "path": "example.com/mono/api",
+    "license": "MIT",
+    "files": [
+      "LICENSE"
+    ]
+  },
+  {
+    "module": "example.com/mono/api",
+    "path": "example.com/dep",
+    "version": "v1.0.0",
+    "license": "AGPL-3.0-only",
+    "files": [
+      "COPYING"
+    ],
+    "denied": true
+  }
+]
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			t.Parallel()
+			out := &bytes.Buffer{}
+			err := writeLicenses(out, tt.format, entries)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("unexpected report.\nexpected:\n%s\ngot:\n%s", tt.expected, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Log formats of --log-format. text is the format of the log package, logfmt
+// and json are meant for log aggregation.
+const (
+	logText   = "text"
+	logLogfmt = "logfmt"
+	logJSON   = "json"
+)
+
+var (
+	logFormats = []string{logText, logLogfmt, logJSON}
+	logLevels  = []string{"debug", "info", "warn", "error"}
+)
+
+// setupLogging sets the default logger from the global flags. Logs are
+// written to stderr unless a log file is given. The returned function flushes
+// and closes the log file once the command is done.
+func setupLogging(g globals) (func() error, error) {
+	var w io.Writer = os.Stderr
+	closeLog := func() error { return nil }
+	if g.LogFile != "" {
+		f, err := os.OpenFile(g.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		w = f
+		closeLog = func() error {
+			return errors.Join(f.Sync(), f.Close())
+		}
+	}
+	level := g.LogLevel
+	if g.IsDebug {
+		level = slog.LevelDebug
+	}
+	h := logHandler(w, g.LogFormat, level)
+	if h == nil {
+		log.SetOutput(w)
+		slog.SetLogLoggerLevel(level)
+		return closeLog, nil
+	}
+	slog.SetDefault(slog.New(h))
+	return closeLog, nil
+}
+
+// logHandler returns the handler of the log format, nil for the text format
+// of the default logger.
+func logHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case logLogfmt:
+		return slog.NewTextHandler(w, opts)
+	case logJSON:
+		return slog.NewJSONHandler(w, opts)
+	}
+	return nil
+}
+
+type logFormatValue string
+
+func LogFormatValue(fs *flag.FlagSet, name string, value string, usage string) *logFormatValue {
+	lv := logFormatValue(value)
+	fs.Var(&lv, name, usage)
+	return &lv
+}
+
+func (s *logFormatValue) Set(val string) error {
+	if !slices.Contains(logFormats, val) {
+		return fmt.Errorf("unknown log format %q. use one of %s", val, strings.Join(logFormats, ", "))
+	}
+	*s = logFormatValue(val)
+	return nil
+}
+
+func (s *logFormatValue) Get() any { return string(*s) }
+
+func (s *logFormatValue) String() string { return string(*s) }
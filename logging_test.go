@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestLogHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: logLogfmt,
+			expected: `^time=\S+ level=WARN msg="module would be published without a license" ` +
+				`module=example.com/mono/api phase=check\n$`,
+		},
+		{
+			format: logJSON,
+			expected: `^\{"time":"\S+","level":"WARN","msg":"module would be published without a license",` +
+				`"module":"example.com/mono/api","phase":"check"\}\n$`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			t.Parallel()
+
+			out := &bytes.Buffer{}
+			logger := slog.New(logHandler(out, test.format, slog.LevelWarn))
+			logger.Info("filtered by level")
+			logger.Warn("module would be published without a license",
+				slog.String("module", "example.com/mono/api"),
+				slog.String("phase", "check"),
+			)
+			if !regexp.MustCompile(test.expected).Match(out.Bytes()) {
+				t.Errorf("expected logs matching %s, got:\n%s", test.expected, out.String())
+			}
+		})
+	}
+
+	if logHandler(&bytes.Buffer{}, logText, slog.LevelInfo) != nil {
+		t.Errorf("expected the default handler for the text format")
+	}
+}
+
+func TestSetupLoggingFile(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	logFile := filepath.Join(t.TempDir(), "mono.log")
+	closeLog, err := setupLogging(globals{LogFormat: logLogfmt, LogLevel: slog.LevelInfo, LogFile: logFile})
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	slog.Info("all modules checked", slog.String("phase", "check"))
+	err = closeLog()
+	if err != nil {
+		t.Fatalf("unexpected error closing the log file %q", err)
+	}
+	actual, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `^time=\S+ level=INFO msg="all modules checked" phase=check\n$`
+	if !regexp.MustCompile(expected).Match(actual) {
+		t.Errorf("expected logs matching %s, got:\n%s", expected, actual)
+	}
+	if closeLog() == nil {
+		t.Errorf("expected an error closing the log file twice")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"time"
 )
 
 func main() {
@@ -29,7 +30,35 @@ func main() {
 		}
 		os.Exit(1)
 	}
-	err := cmd.Run()
+	os.Exit(run(cmd))
+}
+
+// run runs the parsed command returning its exit code. It is kept apart from
+// main so the log file is closed before exiting.
+func run(cmd *Command) int {
+	closeLog, err := setupLogging(globalsOf(cmd.Flags))
+	if err != nil {
+		_, pErr := fmt.Fprintln(cmd.Flags.Output(), err)
+		if pErr != nil {
+			panic(err)
+		}
+		return 1
+	}
+	defer func() {
+		err := closeLog()
+		if err != nil {
+			_, pErr := fmt.Fprintln(cmd.Flags.Output(), err)
+			if pErr != nil {
+				panic(err)
+			}
+		}
+	}()
+	start := time.Now()
+	err = cmd.Run()
+	slog.Debug("command finished",
+		slog.String("command", cmd.Name),
+		slog.Duration("duration", time.Since(start)),
+	)
 	if err != nil {
 		if errors.Is(cmd.Error, ErrInput) {
 			_, pErr := fmt.Fprintln(cmd.Flags.Output(), cmd.Error)
@@ -41,9 +70,10 @@ func main() {
 				panic(err)
 			}
 			cmd.Flags.Usage()
-			os.Exit(2)
+			return 2
 		}
 		slog.Error(err.Error())
-		os.Exit(1)
+		return 1
 	}
+	return 0
 }
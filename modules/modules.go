@@ -3,18 +3,27 @@ package modules
 import (
 	"bytes"
 	"cmp"
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"go/version"
 	"io"
+	"io/fs"
 	"log/slog"
-	"os"
-	"path/filepath"
+	"path"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/demula/mono/gosum"
+	"github.com/demula/mono/vfs"
 	"golang.org/x/mod/modfile"
 	"golang.org/x/mod/module"
 	"golang.org/x/mod/semver"
@@ -22,15 +31,23 @@ import (
 )
 
 type Module struct {
-	Prefix      string
-	FileName    string
-	GoModHash   string
-	DirHash     string
+	// FS holds the monorepo files. Prefix, FileName and License are paths
+	// inside it.
+	FS        vfs.FS
+	Prefix    string
+	FileName  string
+	GoModHash string
+	DirHash   string
+	// License is the repository root LICENSE file. The go command adds it to
+	// the module zip when the module does not have its own LICENSE file.
 	License     string
 	File        *modfile.File
 	Deps        []*Module
 	DepsVersion []string
-	Sums        map[module.Version][]string
+	// DepsIndirect marks the interdependencies required with an
+	// "// indirect" comment.
+	DepsIndirect []bool
+	Sums         map[module.Version][]string
 }
 
 func (m *Module) Path() string {
@@ -41,9 +58,30 @@ func (m *Module) Version() string {
 	return m.File.Module.Mod.Version
 }
 
-func All(prefix string) ([]*Module, error) {
-	prefix = filepath.Clean(prefix)
-	dfs, err := os.ReadDir(prefix)
+// Deprecated returns the deprecation message of the module, empty when it is
+// not deprecated.
+func (m *Module) Deprecated() string {
+	return m.File.Module.Deprecated
+}
+
+var ErrMaxIterations = errors.New("max iteration for sorting by direct dependencies reached")
+
+// LicenseFiles are the file names recognised as license or notice files by
+// default.
+var LicenseFiles = []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "COPYING", "NOTICE"}
+
+// All returns the modules found on the prefix directory of fsys recognising
+// the default LicenseFiles. Use "." for the root of fsys.
+func All(fsys vfs.FS, prefix string) ([]*Module, error) {
+	return AllLicensed(fsys, prefix, LicenseFiles)
+}
+
+// AllLicensed works as All recognising only the licenseFiles names. The root
+// LICENSE file is added to the modules without their own one, as the go
+// command does, only when "LICENSE" is one of them.
+func AllLicensed(fsys vfs.FS, prefix string, licenseFiles []string) ([]*Module, error) {
+	prefix = path.Clean(prefix)
+	dfs, err := fs.ReadDir(fsys, prefix)
 	if err != nil {
 		return nil, err
 	}
@@ -51,52 +89,104 @@ func All(prefix string) ([]*Module, error) {
 	hasLicense := false
 	for _, f := range dfs {
 		m := &Module{
+			FS:       fsys,
 			Prefix:   prefix,
 			FileName: f.Name(),
 			Sums:     make(map[module.Version][]string),
 		}
-		if f.Name() == "LICENSE" {
-			slog.Debug("license found")
-			hasLicense = true
+		if !f.IsDir() && slices.Contains(licenseFiles, f.Name()) {
+			slog.Debug("license found", slog.String("file", path.Join(prefix, f.Name())))
+			hasLicense = hasLicense || f.Name() == "LICENSE"
 			continue
 		}
 		if !f.IsDir() || strings.HasPrefix(f.Name(), ".") {
 			continue
 		}
-		gomod := filepath.Join(prefix, f.Name(), "go.mod")
-		_, err := os.Stat(gomod)
+		gomod := path.Join(prefix, f.Name(), "go.mod")
+		contents, err := fs.ReadFile(fsys, gomod)
 		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
+			if errors.Is(err, fs.ErrNotExist) {
 				continue
 			}
 			return nil, err
 		}
-		contents, err := os.ReadFile(gomod)
-		if err != nil {
-			return nil, err
-		}
 		m.File, err = modfile.Parse(gomod, contents, nil)
 		if err != nil {
 			return nil, err
 		}
-		sum := filepath.Join(prefix, f.Name(), "go.sum")
-		err = gosum.Read(m.Sums, sum)
+		sum := path.Join(prefix, f.Name(), "go.sum")
+		contents, err = readFile(fsys, sum)
 		if err != nil {
 			return nil, err
 		}
+		gosum.Parse(m.Sums, sum, contents)
 		ms = append(ms, m)
-		debug(m, "found monorepo module at %s",
-			filepath.Join(prefix, f.Name()),
+		debug(m, "found monorepo module",
+			slog.String("dir", path.Join(prefix, f.Name())),
 		)
 	}
 	if hasLicense {
 		for _, m := range ms {
-			m.License = filepath.Join(prefix, "LICENSE")
+			_, err := fs.Stat(fsys, path.Join(m.Dir(), "LICENSE"))
+			if err == nil {
+				debug(m, "module license overrides root license")
+				continue
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			m.License = path.Join(prefix, "LICENSE")
 		}
 	}
 	return ms, nil
 }
 
+// Licenses returns the license and notice files (with one of the given names)
+// the module zip would contain. Only a root LICENSE file is added by the go
+// command, any other root file is left out of the module zip.
+func Licenses(m *Module, names []string) ([]string, error) {
+	entries, err := fs.ReadDir(m.FS, m.Dir())
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, e := range entries {
+		if !e.IsDir() && slices.Contains(names, e.Name()) {
+			found = append(found, e.Name())
+		}
+	}
+	if len(m.License) > 0 && slices.Contains(names, "LICENSE") {
+		found = append(found, "LICENSE")
+		slices.Sort(found)
+	}
+	return found, nil
+}
+
+// Dir returns the module directory inside its FS.
+func (m *Module) Dir() string {
+	return path.Join(m.Prefix, m.FileName)
+}
+
+// CheckGoSum parses strictly the module go.sum file returning a
+// gosum.ErrorList with every problem found.
+func CheckGoSum(m *Module) error {
+	sum := path.Join(m.Dir(), "go.sum")
+	contents, err := readFile(m.FS, sum)
+	if err != nil {
+		return err
+	}
+	return gosum.ParseStrict(make(map[module.Version][]string), sum, contents)
+}
+
+// readFile works as fs.ReadFile but a missing file is not an error.
+func readFile(fsys fs.FS, name string) ([]byte, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
 func FetchDirectDeps(mods []*Module) {
 	for _, m := range mods {
 		for _, require := range m.File.Require {
@@ -104,20 +194,196 @@ func FetchDirectDeps(mods []*Module) {
 				if require.Mod.Path == d.Path() {
 					m.Deps = append(m.Deps, d)
 					m.DepsVersion = append(m.DepsVersion, require.Mod.Version)
-					debug(m, "found interdependency %s@%s", d.Path(), require.Mod.Version)
+					m.DepsIndirect = append(m.DepsIndirect, require.Indirect)
+					debug(m, "found interdependency",
+						slog.String("dep", d.Path()),
+						slog.String("version", require.Mod.Version),
+					)
 				}
 			}
 		}
 	}
 }
 
+// FetchIndirectDeps adds the monorepo modules missing on the module go.mod
+// that provide packages imported, directly or through other siblings, by the
+// module packages or tests. Modules with graph pruning (go 1.17 or later) must
+// list them as indirect requirements as "go mod tidy" would do. They have no
+// previous version as they are not yet on the go.mod and go.sum files.
+//
+// Note: imports are read with every build tag but "ignore" set, as "go mod
+// tidy" does, and only followed through monorepo packages. A sibling imported
+// through an external module is not found.
+func FetchIndirectDeps(mods []*Module) {
+	missing := make(map[*Module][]*Module)
+	for _, m := range mods {
+		if m.File.Go == nil || CompareGo(m.File.Go.Version, "1.17") < 0 {
+			continue
+		}
+		imported := importedSiblings(m, mods)
+		for _, d := range mods {
+			if d != m && imported[d] && !slices.Contains(m.Deps, d) {
+				missing[m] = append(missing[m], d)
+			}
+		}
+	}
+	for m, ds := range missing {
+		for _, d := range ds {
+			m.Deps = append(m.Deps, d)
+			m.DepsVersion = append(m.DepsVersion, "")
+			m.DepsIndirect = append(m.DepsIndirect, true)
+			debug(m, "found missing indirect interdependency", slog.String("dep", d.Path()))
+		}
+	}
+}
+
+// CompareGo compares two go versions, as 1.21, 1.21rc1 or 1.21.0, the way the
+// go command orders them. It returns -1, 0 or +1 as semver.Compare.
+func CompareGo(a, b string) int {
+	return version.Compare("go"+a, "go"+b)
+}
+
+// importedSiblings returns the modules of mods providing the packages
+// imported by the packages and tests of m, following the imports of the
+// sibling packages without their tests.
+func importedSiblings(m *Module, mods []*Module) map[*Module]bool {
+	imported := make(map[*Module]bool)
+	seen := make(map[string]bool)
+	var follow func(imports []string)
+	follow = func(imports []string) {
+		for _, importPath := range imports {
+			d := moduleOf(mods, importPath)
+			if d == nil || d == m || seen[importPath] {
+				continue
+			}
+			seen[importPath] = true
+			imported[d] = true
+			dir := path.Join(d.Dir(), strings.TrimPrefix(importPath, d.Path()))
+			follow(packageImports(d.FS, dir, false))
+		}
+	}
+	_ = fs.WalkDir(m.FS, m.Dir(), func(dir string, e fs.DirEntry, err error) error {
+		if err != nil {
+			debug(m, "failed to read imports", slog.String("error", err.Error()))
+			return nil
+		}
+		if !e.IsDir() {
+			return nil
+		}
+		if dir != m.Dir() {
+			name := e.Name()
+			if name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return fs.SkipDir
+			}
+			// nested modules are not part of this one
+			if _, err := fs.Stat(m.FS, path.Join(dir, "go.mod")); err == nil {
+				return fs.SkipDir
+			}
+		}
+		follow(packageImports(m.FS, dir, true))
+		return nil
+	})
+	return imported
+}
+
+// moduleOf returns the module of mods providing the package with the import
+// path, nil when none does.
+func moduleOf(mods []*Module, importPath string) *Module {
+	var found *Module
+	for _, d := range mods {
+		if importPath != d.Path() && !strings.HasPrefix(importPath, d.Path()+"/") {
+			continue
+		}
+		if found == nil || len(d.Path()) > len(found.Path()) {
+			found = d
+		}
+	}
+	return found
+}
+
+// packageImports returns the imports of the go files in dir, with the ones of
+// the tests when isTest. Unreadable files are skipped.
+func packageImports(fsys fs.FS, dir string, isTest bool) []string {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil
+	}
+	var imports []string
+	fset := token.NewFileSet()
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || (!isTest && strings.HasSuffix(name, "_test.go")) {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, data, parser.ImportsOnly|parser.ParseComments)
+		if err != nil || isIgnored(f) {
+			continue
+		}
+		for _, spec := range f.Imports {
+			if p, err := strconv.Unquote(spec.Path.Value); err == nil && !slices.Contains(imports, p) {
+				imports = append(imports, p)
+			}
+		}
+	}
+	return imports
+}
+
+// isIgnored reports whether the build constraint of f excludes it with every
+// build tag but "ignore" set, negated ones included, as "go mod tidy" reads it.
+func isIgnored(f *ast.File) bool {
+	for _, group := range f.Comments {
+		if group.Pos() >= f.Package {
+			break
+		}
+		for _, c := range group.List {
+			if !constraint.IsGoBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err != nil {
+				return false
+			}
+			return !anyTags(expr, true)
+		}
+	}
+	return false
+}
+
+// anyTags evaluates expr with every tag set to want, but "ignore" unset.
+func anyTags(expr constraint.Expr, want bool) bool {
+	switch x := expr.(type) {
+	case *constraint.TagExpr:
+		if x.Tag == "ignore" {
+			return false
+		}
+		return want
+	case *constraint.NotExpr:
+		return !anyTags(x.X, !want)
+	case *constraint.AndExpr:
+		return anyTags(x.X, want) && anyTags(x.Y, want)
+	case *constraint.OrExpr:
+		return anyTags(x.X, want) || anyTags(x.Y, want)
+	}
+	return false
+}
+
 func UpdateVersion(mods []*Module, version string) error {
 	if !semver.IsValid(version) {
 		return fmt.Errorf("invalid version %q", version)
 	}
 	for _, m := range mods {
 		m.File.Module.Mod.Version = version
+		if slices.Contains(m.DepsVersion, "") {
+			setRequire(m, version)
+			continue
+		}
 		for _, d := range m.Deps {
+			// Existing "// indirect" comments are kept as only the version
+			// token of the line is rewritten.
 			err := m.File.AddRequire(d.Path(), version)
 			if err != nil {
 				return err
@@ -127,8 +393,33 @@ func UpdateVersion(mods []*Module, version string) error {
 	return nil
 }
 
-func UpdateGoMod(m *Module, dry bool) error {
-	path := filepath.Join(m.Prefix, m.FileName, "go.mod")
+// setRequire rewrites the module requirements adding the missing indirect
+// interdependencies into the indirect requirements block the same way "go mod
+// tidy" does.
+func setRequire(m *Module, version string) {
+	reqs := make([]*modfile.Require, 0, len(m.File.Require)+len(m.Deps))
+	for _, r := range m.File.Require {
+		reqs = append(reqs, &modfile.Require{Mod: r.Mod, Indirect: r.Indirect})
+	}
+	for i, d := range m.Deps {
+		if m.DepsVersion[i] == "" {
+			reqs = append(reqs, &modfile.Require{
+				Mod:      module.Version{Path: d.Path(), Version: version},
+				Indirect: true,
+			})
+			continue
+		}
+		for _, r := range reqs {
+			if r.Mod.Path == d.Path() {
+				r.Mod.Version = version
+			}
+		}
+	}
+	m.File.SetRequireSeparateIndirect(reqs)
+}
+
+func UpdateGoMod(m *Module) error {
+	name := path.Join(m.Dir(), "go.mod")
 	m.File.Cleanup()
 	data, _ := m.File.Format()
 	var err error
@@ -136,16 +427,67 @@ func UpdateGoMod(m *Module, dry bool) error {
 	if err != nil {
 		return err
 	}
-	if dry {
-		debug(m, "[skipped] writing file %s", path)
-		return nil
+	debug(m, "writing file", slog.String("file", name))
+	return m.FS.WriteFile(name, data, 0644)
+}
+
+// Deprecate writes message as the "// Deprecated:" paragraph of the module
+// directive comments replacing the previous one. Other comments are kept.
+func Deprecate(m *Module, message string) error {
+	line := m.File.Module.Syntax
+	isBlank := func(c modfile.Comment) bool {
+		return strings.TrimSpace(strings.TrimPrefix(c.Token, "//")) == ""
+	}
+	var before []modfile.Comment
+	inDeprecation := false
+	for _, c := range line.Comments.Before {
+		text := strings.TrimSpace(strings.TrimPrefix(c.Token, "//"))
+		switch {
+		case strings.HasPrefix(text, "Deprecated:"):
+			inDeprecation = true
+			continue
+		case isBlank(c):
+			inDeprecation = false
+			if len(before) > 0 && isBlank(before[len(before)-1]) {
+				// paragraph separators of the removed deprecation
+				continue
+			}
+		case inDeprecation:
+			continue
+		}
+		before = append(before, c)
+	}
+	for len(before) > 0 && isBlank(before[len(before)-1]) {
+		before = before[:len(before)-1]
+	}
+	if len(before) > 0 {
+		// the deprecation must be a paragraph of its own
+		before = append(before, modfile.Comment{Token: "//"})
+	}
+	prefix := "Deprecated: "
+	for _, l := range strings.Split(message, "\n") {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		before = append(before, modfile.Comment{Token: "// " + prefix + strings.TrimSpace(l)})
+		prefix = ""
+	}
+	line.Comments.Before = before
+
+	// modfile only reads the deprecation when parsing
+	name := path.Join(m.Dir(), "go.mod")
+	data, err := m.File.Format()
+	if err != nil {
+		return err
 	}
-	debug(m, "writing file %s", path)
-	return os.WriteFile(path, data, 0644)
+	m.File, err = modfile.Parse(name, data, nil)
+	if err != nil {
+		return err
+	}
+	return UpdateGoMod(m)
 }
 
-func UpdateGoSum(m *Module, dry bool) error {
-	path := filepath.Join(m.Prefix, m.FileName, "go.sum")
+func UpdateGoSum(m *Module) error {
 	for i, d := range m.Deps {
 		err := updateSum(m, d, m.DepsVersion[i], "", d.DirHash)
 		if err != nil {
@@ -156,23 +498,105 @@ func UpdateGoSum(m *Module, dry bool) error {
 			return fmt.Errorf("inconsistent dependencies. failed to update go.mod hash: %w", err)
 		}
 	}
-	data := gosum.Format(m.Sums)
-	if !dry {
-		debug(m, "writing file %s", path)
-		if len(data) > 0 { // skip writing empty go.sum
-			err := os.WriteFile(path, data, 0644)
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		debug(m, "[skipped] writing file %s", path)
+	err := WriteGoSum(m)
+	if err != nil {
+		return err
 	}
-	var err error
 	m.DirHash, err = DirHash(m)
 	return err
 }
 
+// WriteGoSum writes the module go.sum file with its current sums.
+func WriteGoSum(m *Module) error {
+	name := path.Join(m.Dir(), "go.sum")
+	data := gosum.Format(m.Sums)
+	if len(data) == 0 { // skip creating empty go.sum
+		_, err := fs.Stat(m.FS, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+	}
+	debug(m, "writing file", slog.String("file", name))
+	return m.FS.WriteFile(name, data, 0644)
+}
+
+// GoModAt returns the go.mod file of the monorepo module m at a previous
+// version, nil when the version is unknown.
+type GoModAt func(m *Module, version string) (*modfile.File, error)
+
+// PruneSums removes from the module sums every entry of a monorepo module
+// that is not required, directly or through the module graph, at that
+// version. The requirements of the siblings at the versions required are read
+// with goModAt. When it is nil or a version is unknown the current go.mod file
+// of the sibling is used instead, which only matches when it did not change
+// its requirements since. Entries of modules outside the monorepo are left
+// untouched as they are managed by the go command. It returns the removed
+// entries.
+func PruneSums(m *Module, mods []*Module, goModAt GoModAt) []module.Version {
+	siblings := make(map[string]*Module, len(mods))
+	for _, d := range mods {
+		siblings[d.Path()] = d
+	}
+	required := make(map[module.Version]bool)
+	for i, d := range m.Deps {
+		requiredDeps(d, m.DepsVersion[i], siblings, goModAt, required)
+	}
+
+	var removed []module.Version
+	for md := range m.Sums {
+		if siblings[md.Path] == nil {
+			continue
+		}
+		v := module.Version{
+			Path:    md.Path,
+			Version: strings.TrimSuffix(md.Version, "/go.mod"),
+		}
+		if required[v] {
+			continue
+		}
+		delete(m.Sums, md)
+		removed = append(removed, md)
+	}
+	module.Sort(removed)
+	for _, md := range removed {
+		debug(m, "pruned unused dep", slog.String("dep", md.Path), slog.String("version", md.Version))
+	}
+	return removed
+}
+
+// requiredDeps adds to required the sibling d at version and the siblings
+// its go.mod file requires at that version, through the module graph.
+func requiredDeps(d *Module, version string, siblings map[string]*Module, goModAt GoModAt, required map[module.Version]bool) {
+	v := module.Version{Path: d.Path(), Version: version}
+	if required[v] {
+		return
+	}
+	required[v] = true
+
+	var f *modfile.File
+	if goModAt != nil && version != "" {
+		var err error
+		f, err = goModAt(d, version)
+		if err != nil {
+			debug(d, "failed to read go.mod, using the current one",
+				slog.String("version", version),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	if f == nil {
+		for i, dd := range d.Deps {
+			requiredDeps(dd, d.DepsVersion[i], siblings, goModAt, required)
+		}
+		return
+	}
+	for _, r := range f.Require {
+		if dd, ok := siblings[r.Mod.Path]; ok {
+			requiredDeps(dd, r.Mod.Version, siblings, goModAt, required)
+		}
+	}
+}
+
 func updateSum(m *Module, d *Module, version, suffix, hash string) error {
 	md := module.Version{
 		Path:    d.Path(),
@@ -183,6 +607,14 @@ func updateSum(m *Module, d *Module, version, suffix, hash string) error {
 	}
 	m.Sums[md] = []string{hash}
 
+	if version == "" {
+		debug(m, "added missing dep",
+			slog.String("dep", d.Path()),
+			slog.String("version", md.Version),
+			slog.String("hash", hash),
+		)
+		return nil
+	}
 	if len(m.Sums) > 0 {
 		mdOld := module.Version{
 			Path:    d.Path(),
@@ -193,13 +625,26 @@ func updateSum(m *Module, d *Module, version, suffix, hash string) error {
 			return errors.New("missing go sum entry for " + mdOld.String())
 		}
 		delete(m.Sums, mdOld)
-		debug(m, "changed dep %s%s %s --> %s", d.Path(), suffix, hashOld, hash)
+		debug(m, "changed dep",
+			slog.String("dep", d.Path()),
+			slog.String("old-version", mdOld.Version),
+			slog.String("version", md.Version),
+			slog.String("old-hash", strings.Join(hashOld, " ")),
+			slog.String("hash", hash),
+		)
 	} else {
-		debug(m, "added dep to empty sums %s%s %s", d.Path(), suffix, hash)
+		debug(m, "added dep to empty sums",
+			slog.String("dep", d.Path()),
+			slog.String("version", md.Version),
+			slog.String("hash", hash),
+		)
 	}
 	return nil
 }
 
+// SortByDirectDeps orders the modules so every module comes after its
+// interdependencies. Indirect interdependencies are taken into account too as
+// their hashes are also written into the module go.sum file.
 func SortByDirectDeps(nodes []*Module, maxIter int) ([]*Module, error) {
 	if len(nodes) < 2 {
 		return nodes, nil
@@ -241,7 +686,7 @@ func SortByDirectDeps(nodes []*Module, maxIter int) ([]*Module, error) {
 		}
 		unresolved = iterUnresolved
 	}
-	return nil, errors.New("max iteration for sorting by direct dependencies reached")
+	return nil, ErrMaxIterations
 }
 
 func GoModHash(data []byte) (string, error) {
@@ -253,72 +698,127 @@ func GoModHash(data []byte) (string, error) {
 // DirHash reads directory and produces its H1 hash.
 // Note: remember to modify the go.mod file first before running this function.
 func DirHash(m *Module) (string, error) {
-	dir := filepath.Join(m.Prefix, m.FileName)
+	start := time.Now()
+	mf, err := Manifest(m)
+	if err != nil {
+		return "", err
+	}
+	h1 := ManifestHash(mf)
+	slog.Debug("module hashed",
+		slog.String("module", m.Path()),
+		slog.String("phase", "hash"),
+		slog.String("dir", m.Dir()),
+		slog.String("hash", h1),
+		slog.Int("files", len(mf)),
+		slog.Duration("duration", time.Since(start)),
+	)
+	return h1, nil
+}
+
+// FileHash is a file of the module zip, named as in the zip, and the sha256
+// of its content.
+type FileHash struct {
+	Name   string
+	SHA256 string
+}
+
+// Manifest returns the files DirHash hashes at the module version, sorted by
+// name, with their sha256.
+func Manifest(m *Module) ([]FileHash, error) {
+	dir := m.Dir()
 	prefix := m.Path() + "@" + m.Version()
-	slog.Debug("hashing module \""+m.FileName+"\"",
+	logger := slog.With(
+		slog.String("module", m.Path()),
+		slog.String("phase", "hash"),
+	)
+	logger.Debug("hashing module",
 		slog.String("dir", dir),
 		slog.String("prefix", prefix),
 	)
-	files, err := dirhash.DirFiles(dir, prefix)
+	files, err := dirFiles(m.FS, dir, prefix)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if len(m.License) > 0 {
-		licenseModulePath := filepath.Join(prefix, "LICENSE")
-		files = append(files, filepath.ToSlash(licenseModulePath))
-	}
-	for _, f := range files {
-		slog.Debug("... " + f)
+		files = append(files, path.Join(prefix, "LICENSE"))
 	}
-	osOpen := func(name string) (io.ReadCloser, error) {
+	fsOpen := func(name string) (io.ReadCloser, error) {
 		f := strings.TrimPrefix(name, prefix)
 		if f == "/LICENSE" && len(m.License) > 0 {
-			return os.Open(m.License)
+			return m.FS.Open(m.License)
 		}
-		return os.Open(filepath.Join(dir, f))
+		return m.FS.Open(path.Join(dir, f))
 	}
-	return hash1(files, osOpen)
-	// return dirhash.HashDir(dir, prefix, dirhash.DefaultHash)
+	return hashFiles(logger, files, fsOpen)
 }
 
-func debug(m *Module, format string, a ...any) {
-	msg := fmt.Sprintf(format, a...)
-	slog.Debug(msg, slog.String("module", m.Path()))
+// ManifestHash returns the h1 hash of the manifest as dirhash.Hash1 does:
+// the sha256 of its "sha256  name" lines.
+func ManifestHash(files []FileHash) string {
+	h := sha256.New()
+	for _, f := range files {
+		_, _ = fmt.Fprintf(h, "%s  %s\n", f.SHA256, f.Name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
 
-func hash1(files []string, open func(string) (io.ReadCloser, error)) (string, error) {
-	h := sha256.New()
+// dirFiles works as dirhash.DirFiles but on the directory dir of fsys.
+func dirFiles(fsys fs.FS, dir, prefix string) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(fsys, dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		} else if file == dir {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		rel := file
+		if dir != "." {
+			rel = file[len(dir)+1:]
+		}
+		files = append(files, path.Join(prefix, rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// debug logs msg with the module path and the given attributes.
+func debug(m *Module, msg string, attrs ...slog.Attr) {
+	attrs = append([]slog.Attr{slog.String("module", m.Path())}, attrs...)
+	slog.LogAttrs(context.Background(), slog.LevelDebug, msg, attrs...)
+}
+
+// hashFiles returns the sorted manifest of files logging the hash of every
+// file.
+func hashFiles(logger *slog.Logger, files []string, open func(string) (io.ReadCloser, error)) ([]FileHash, error) {
 	files = append([]string(nil), files...)
-	sb := &bytes.Buffer{}
 	slices.Sort(files)
+	mf := make([]FileHash, 0, len(files))
 	for _, file := range files {
 		if strings.Contains(file, "\n") {
-			return "", errors.New("dirhash: filenames with newlines are not supported")
+			return nil, errors.New("dirhash: filenames with newlines are not supported")
 		}
 		r, err := open(file)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		hf := sha256.New()
 		_, err = io.Copy(hf, r)
 		_ = r.Close()
 		if err != nil {
-			return "", err
-		}
-		hh := hf.Sum(nil)
-		_, err = fmt.Fprintf(h, "%x  %s\n", hh, file)
-		if err != nil {
-			return "", err
-		}
-		_, err = fmt.Fprintf(sb, "%x  %s\n", hh, file)
-		if err != nil {
-			return "", err
+			return nil, err
 		}
+		f := FileHash{Name: file, SHA256: fmt.Sprintf("%x", hf.Sum(nil))}
+		logger.Debug("file hashed",
+			slog.String("file", f.Name),
+			slog.String("sha256", f.SHA256),
+		)
+		mf = append(mf, f)
 	}
-	ph := h.Sum(nil)
-	h1 := "h1:" + base64.StdEncoding.EncodeToString(ph)
-	slog.Debug("file:\n\n" + sb.String() + "\n")
-	slog.Debug("hashed "+h1,
-		slog.String("sha256", fmt.Sprintf("%x", ph)))
-	return h1, nil
+	return mf, nil
 }
@@ -1,12 +1,21 @@
 package modules_test
 
 import (
-	"os"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
 	"testing"
+	"testing/fstest"
 
 	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
 	"golang.org/x/mod/modfile"
 	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
 )
 
 func TestDirHash(t *testing.T) {
@@ -43,17 +52,14 @@ func TestDirHash(t *testing.T) {
 			name = "without "
 		}
 		t.Run(name+"license/"+tt.version, func(t *testing.T) {
-			err := os.Chdir("../testdata/")
-			if err != nil {
-				t.Fatal(err)
-			}
-			prefix := "./golden/"
+			prefix := "golden"
 			license := ""
 			if tt.license {
-				prefix = "./golden-license/"
-				license = "./golden-license/LICENSE"
+				prefix = "golden-license"
+				license = "golden-license/LICENSE"
 			}
 			m := &modules.Module{
+				FS:       vfs.Dir("../testdata"),
 				Prefix:   prefix,
 				FileName: "api",
 				License:  license,
@@ -81,3 +87,564 @@ func TestDirHash(t *testing.T) {
 		})
 	}
 }
+
+func TestLicenses(t *testing.T) {
+	gomod := func(name string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte("module example.com/mono/" + name + "\n")}
+	}
+	tests := []struct {
+		name         string
+		files        fstest.MapFS
+		licenseFiles []string
+		expected     map[string][]string
+	}{
+		{
+			name: "module license overrides root license",
+			files: fstest.MapFS{
+				"LICENSE":      {Data: []byte("root license\n")},
+				"NOTICE":       {Data: []byte("root notice\n")},
+				"api/go.mod":   gomod("api"),
+				"api/LICENSE":  {Data: []byte("api license\n")},
+				"core/go.mod":  gomod("core"),
+				"core/COPYING": {Data: []byte("core copying\n")},
+				"cli/go.mod":   gomod("cli"),
+			},
+			expected: map[string][]string{
+				"api":  {"LICENSE"},
+				"core": {"COPYING", "LICENSE"},
+				"cli":  {"LICENSE"},
+			},
+		},
+		{
+			name: "root notice is not part of module zips",
+			files: fstest.MapFS{
+				"NOTICE":        {Data: []byte("root notice\n")},
+				"api/go.mod":    gomod("api"),
+				"api/NOTICE.md": {Data: []byte("api notice\n")},
+				"cli/go.mod":    gomod("cli"),
+			},
+			expected: map[string][]string{
+				"api": nil,
+				"cli": nil,
+			},
+		},
+		{
+			name: "root license not recognised",
+			files: fstest.MapFS{
+				"LICENSE":      {Data: []byte("root license\n")},
+				"core/go.mod":  gomod("core"),
+				"core/COPYING": {Data: []byte("core copying\n")},
+				"cli/go.mod":   gomod("cli"),
+			},
+			licenseFiles: []string{"COPYING"},
+			expected: map[string][]string{
+				"core": {"COPYING"},
+				"cli":  nil,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			licenseFiles := tt.licenseFiles
+			if licenseFiles == nil {
+				licenseFiles = modules.LicenseFiles
+			}
+			ms, err := modules.AllLicensed(vfs.NewOverlay(tt.files), ".", licenseFiles)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			for _, m := range ms {
+				// Licenses is given every name so only the discovery of
+				// AllLicensed is tested.
+				actual, err := modules.Licenses(m, append([]string{"LICENSE"}, licenseFiles...))
+				if err != nil {
+					t.Fatalf("unexpected error %q", err)
+				}
+				if !slices.Equal(actual, tt.expected[m.FileName]) {
+					t.Errorf("expected %s licenses %v, got %v", m.FileName, tt.expected[m.FileName], actual)
+				}
+			}
+		})
+	}
+}
+
+func TestDirHashWithModuleLicense(t *testing.T) {
+	files := fstest.MapFS{
+		"LICENSE":     {Data: []byte("root license\n")},
+		"api/go.mod":  {Data: []byte("module example.com/mono/api\n")},
+		"api/LICENSE": {Data: []byte("api license\n")},
+	}
+	ms, err := modules.All(vfs.NewOverlay(files), ".")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	ms[0].File.Module.Mod.Version = "v1.0.0"
+	actual, err := modules.DirHash(ms[0])
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	// module zip only holds the module own files
+	expected, err := dirhash.Hash1(
+		[]string{"example.com/mono/api@v1.0.0/LICENSE", "example.com/mono/api@v1.0.0/go.mod"},
+		func(name string) (io.ReadCloser, error) {
+			return files.Open("api/" + path.Base(name))
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != expected {
+		t.Errorf("hashes do not match. expected: %s, got: %s", expected, actual)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	files := fstest.MapFS{
+		"LICENSE":    {Data: []byte("root license\n")},
+		"api/go.mod": {Data: []byte("module example.com/mono/api\n")},
+		"api/api.go": {Data: []byte("package api\n")},
+	}
+	ms, err := modules.All(vfs.NewOverlay(files), ".")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	ms[0].File.Module.Mod.Version = "v1.0.0"
+	mf, err := modules.Manifest(ms[0])
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	var names []string
+	for _, f := range mf {
+		names = append(names, f.Name)
+	}
+	expected := []string{
+		"example.com/mono/api@v1.0.0/LICENSE",
+		"example.com/mono/api@v1.0.0/api.go",
+		"example.com/mono/api@v1.0.0/go.mod",
+	}
+	if !slices.Equal(names, expected) {
+		t.Errorf("expected files %v, got %v", expected, names)
+	}
+	// sha256 of "package api\n"
+	if mf[1].SHA256 != "f3c61ca506361937d4fe8c5e231ff4d5edec3bdc8c29a1e476c4858fc2b52d7a" {
+		t.Errorf("unexpected sha256 %q", mf[1].SHA256)
+	}
+	actual, err := modules.DirHash(ms[0])
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if modules.ManifestHash(mf) != actual {
+		t.Errorf("expected the manifest hash %s to be the dir hash %s", modules.ManifestHash(mf), actual)
+	}
+}
+
+func TestDirHashLogs(t *testing.T) {
+	files := fstest.MapFS{
+		"api/go.mod": {Data: []byte("module example.com/mono/api\n")},
+		"api/api.go": {Data: []byte("package api\n")},
+	}
+	ms, err := modules.All(vfs.NewOverlay(files), ".")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	ms[0].File.Module.Mod.Version = "v1.0.0"
+
+	logs := &bytes.Buffer{}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	_, err = modules.DirHash(ms[0])
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	// every hashed file is a record of its own
+	var hashed []string
+	dec := json.NewDecoder(logs)
+	for dec.More() {
+		var record struct {
+			Msg    string `json:"msg"`
+			Module string `json:"module"`
+			Phase  string `json:"phase"`
+			File   string `json:"file"`
+			SHA256 string `json:"sha256"`
+		}
+		err = dec.Decode(&record)
+		if err != nil {
+			t.Fatalf("unexpected error %q", err)
+		}
+		if record.Module != "example.com/mono/api" || record.Phase != "hash" {
+			t.Errorf("expected module and phase attributes, got %+v", record)
+		}
+		if record.Msg == "file hashed" {
+			if len(record.SHA256) != 64 {
+				t.Errorf("expected the file sha256, got %q", record.SHA256)
+			}
+			hashed = append(hashed, record.File)
+		}
+	}
+	expected := []string{"example.com/mono/api@v1.0.0/api.go", "example.com/mono/api@v1.0.0/go.mod"}
+	if !slices.Equal(hashed, expected) {
+		t.Errorf("expected hashed files %v, got %v", expected, hashed)
+	}
+}
+
+func TestPruneSums(t *testing.T) {
+	newModule := func(path string) *modules.Module {
+		return &modules.Module{
+			File: &modfile.File{
+				Module: &modfile.Module{
+					Mod: module.Version{Path: path},
+				},
+			},
+			Sums: make(map[module.Version][]string),
+		}
+	}
+	api := newModule("example.com/mono/api")
+	core := newModule("example.com/mono/core")
+	cli := newModule("example.com/mono/cli")
+	server := newModule("example.com/mono/server")
+	mods := []*modules.Module{api, core, cli, server}
+
+	core.Deps = []*modules.Module{api}
+	core.DepsVersion = []string{"v1.0.0"}
+	cli.Deps = []*modules.Module{core}
+	cli.DepsVersion = []string{"v1.0.0"}
+	cli.Sums = map[module.Version][]string{
+		{Path: "example.com/mono/api", Version: "v1.0.0/go.mod"}:    {"h1:api-gomod"},
+		{Path: "example.com/mono/api", Version: "v0.9.0"}:           {"h1:api-old"},
+		{Path: "example.com/mono/api", Version: "v0.9.0/go.mod"}:    {"h1:api-old-gomod"},
+		{Path: "example.com/mono/core", Version: "v1.0.0"}:          {"h1:core"},
+		{Path: "example.com/mono/core", Version: "v1.0.0/go.mod"}:   {"h1:core-gomod"},
+		{Path: "example.com/mono/server", Version: "v1.0.0"}:        {"h1:server"},
+		{Path: "example.com/mono/server", Version: "v1.0.0/go.mod"}: {"h1:server-gomod"},
+		{Path: "golang.org/x/mod", Version: "v0.27.0"}:              {"h1:mod"},
+		{Path: "golang.org/x/mod", Version: "v0.26.0/go.mod"}:       {"h1:mod-old-gomod"},
+	}
+
+	removed := modules.PruneSums(cli, mods, nil)
+
+	expectedRemoved := []module.Version{
+		{Path: "example.com/mono/api", Version: "v0.9.0"},
+		{Path: "example.com/mono/api", Version: "v0.9.0/go.mod"},
+		{Path: "example.com/mono/server", Version: "v1.0.0"},
+		{Path: "example.com/mono/server", Version: "v1.0.0/go.mod"},
+	}
+	if len(removed) != len(expectedRemoved) {
+		t.Fatalf("expected %d removed entries, got %v", len(expectedRemoved), removed)
+	}
+	for i, r := range removed {
+		if r != expectedRemoved[i] {
+			t.Errorf("removed entry %d differs. expected: %s, got: %s", i, expectedRemoved[i], r)
+		}
+	}
+	if len(cli.Sums) != 5 {
+		t.Errorf("expected required and external entries to be kept, got %v", cli.Sums)
+	}
+}
+
+func TestPruneSumsAtRequiredVersions(t *testing.T) {
+	newModule := func(path string) *modules.Module {
+		return &modules.Module{
+			File: &modfile.File{
+				Module: &modfile.Module{
+					Mod: module.Version{Path: path},
+				},
+			},
+			Sums: make(map[module.Version][]string),
+		}
+	}
+	sums := func() map[module.Version][]string {
+		return map[module.Version][]string{
+			{Path: "example.com/mono/api", Version: "v0.8.0/go.mod"}:  {"h1:api-old-gomod"},
+			{Path: "example.com/mono/api", Version: "v1.0.0"}:         {"h1:api"},
+			{Path: "example.com/mono/api", Version: "v1.0.0/go.mod"}:  {"h1:api-gomod"},
+			{Path: "example.com/mono/core", Version: "v0.9.0"}:        {"h1:core"},
+			{Path: "example.com/mono/core", Version: "v0.9.0/go.mod"}: {"h1:core-gomod"},
+		}
+	}
+	// core requires api v1.0.0 now but v0.8.0 at the v0.9.0 cli requires
+	api := newModule("example.com/mono/api")
+	core := newModule("example.com/mono/core")
+	cli := newModule("example.com/mono/cli")
+	mods := []*modules.Module{api, core, cli}
+	core.Deps = []*modules.Module{api}
+	core.DepsVersion = []string{"v1.0.0"}
+	cli.Deps = []*modules.Module{core}
+	cli.DepsVersion = []string{"v0.9.0"}
+	goModAt := func(m *modules.Module, version string) (*modfile.File, error) {
+		if m != core || version != "v0.9.0" {
+			return nil, nil
+		}
+		return modfile.Parse("core/go.mod", []byte("module example.com/mono/core\n\nrequire example.com/mono/api v0.8.0\n"), nil)
+	}
+
+	tests := []struct {
+		name     string
+		goModAt  modules.GoModAt
+		expected []module.Version
+	}{
+		{
+			name:    "go.mod at the required version",
+			goModAt: goModAt,
+			expected: []module.Version{
+				{Path: "example.com/mono/api", Version: "v1.0.0"},
+				{Path: "example.com/mono/api", Version: "v1.0.0/go.mod"},
+			},
+		},
+		{
+			name:     "current go.mod",
+			expected: []module.Version{{Path: "example.com/mono/api", Version: "v0.8.0/go.mod"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli.Sums = sums()
+			removed := modules.PruneSums(cli, mods, tt.goModAt)
+			if !slices.Equal(removed, tt.expected) {
+				t.Errorf("expected removed entries %v, got %v", tt.expected, removed)
+			}
+		})
+	}
+}
+
+func TestUpdateVersion(t *testing.T) {
+	tests := []struct {
+		name  string
+		gomod string
+		// coreGo is the core package source, importing api by default.
+		coreGo   string
+		expected string
+	}{
+		{
+			name: "keeps indirect comments in blocks",
+			gomod: `module example.com/mono/cli
+
+go 1.24.6
+
+require (
+	example.com/mono/core v0.1.0
+	example.com/mono/api v0.1.0 // indirect
+)
+`,
+			expected: `module example.com/mono/cli
+
+go 1.24.6
+
+require (
+	example.com/mono/core v1.0.0
+	example.com/mono/api v1.0.0 // indirect
+)
+`,
+		},
+		{
+			name: "adds missing indirect requirements",
+			gomod: `module example.com/mono/cli
+
+go 1.24.6
+
+require (
+	example.com/mono/core v0.1.0
+	golang.org/x/mod v0.27.0
+)
+`,
+			expected: `module example.com/mono/cli
+
+go 1.24.6
+
+require (
+	example.com/mono/core v1.0.0
+	golang.org/x/mod v0.27.0
+)
+
+require example.com/mono/api v1.0.0 // indirect
+`,
+		},
+		{
+			name: "skips modules without graph pruning",
+			gomod: `module example.com/mono/cli
+
+go 1.16
+
+require example.com/mono/core v0.1.0
+`,
+			expected: `module example.com/mono/cli
+
+go 1.16
+
+require example.com/mono/core v1.0.0
+`,
+		},
+		{
+			name: "compares go versions as the go command",
+			gomod: `module example.com/mono/cli
+
+go 1.21rc1
+
+require example.com/mono/core v0.1.0
+`,
+			expected: `module example.com/mono/cli
+
+go 1.21rc1
+
+require example.com/mono/core v1.0.0
+
+require example.com/mono/api v1.0.0 // indirect
+`,
+		},
+		{
+			name: "skips siblings whose packages are not imported",
+			gomod: `module example.com/mono/cli
+
+go 1.24.6
+
+require example.com/mono/core v0.1.0
+`,
+			coreGo: "//go:build ignore\n\npackage core\n\nimport _ \"example.com/mono/api/hello\"\n",
+			expected: `module example.com/mono/cli
+
+go 1.24.6
+
+require example.com/mono/core v1.0.0
+`,
+		},
+		{
+			name: "reads imports with every build tag",
+			gomod: `module example.com/mono/cli
+
+go 1.24.6
+
+require example.com/mono/core v0.1.0
+`,
+			coreGo: "//go:build linux && !windows\n\npackage core\n\nimport _ \"example.com/mono/api/hello\"\n",
+			expected: `module example.com/mono/cli
+
+go 1.24.6
+
+require example.com/mono/core v1.0.0
+
+require example.com/mono/api v1.0.0 // indirect
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coreGo := tt.coreGo
+			if coreGo == "" {
+				coreGo = "package core\n\nimport _ \"example.com/mono/api/hello\"\n"
+			}
+			fsys := vfs.NewOverlay(fstest.MapFS{
+				"api/hello/hello.go": {Data: []byte("package hello\n")},
+				"core/core.go":       {Data: []byte(coreGo)},
+				"cli/cli.go":         {Data: []byte("package cli\n\nimport _ \"example.com/mono/core\"\n")},
+			})
+			parse := func(dir, data string) *modules.Module {
+				f, err := modfile.Parse(dir+"/go.mod", []byte(data), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return &modules.Module{FS: fsys, FileName: dir, File: f}
+			}
+			api := parse("api", "module example.com/mono/api\n\ngo 1.24.6\n")
+			core := parse("core", "module example.com/mono/core\n\ngo 1.24.6\n\nrequire example.com/mono/api v0.1.0\n")
+			cli := parse("cli", tt.gomod)
+			mods := []*modules.Module{api, core, cli}
+
+			modules.FetchDirectDeps(mods)
+			modules.FetchIndirectDeps(mods)
+			err := modules.UpdateVersion(mods, "v1.0.0")
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+
+			cli.File.Cleanup()
+			actual, err := cli.File.Format()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(actual) != tt.expected {
+				t.Errorf("go.mod differs.\nexpected:\n%s\ngot:\n%s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCompareGo(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "1.21", b: "1.17", expected: 1},
+		{a: "1.21rc1", b: "1.21.0", expected: -1},
+		{a: "1.21rc1", b: "1.21", expected: 1},
+		{a: "1.9", b: "1.17", expected: -1},
+		{a: "1.25.0", b: "1.25.0", expected: 0},
+	}
+	for _, tt := range tests {
+		actual := modules.CompareGo(tt.a, tt.b)
+		if actual != tt.expected {
+			t.Errorf("expected %s compared to %s to be %d, got %d", tt.a, tt.b, tt.expected, actual)
+		}
+	}
+}
+
+func TestDeprecate(t *testing.T) {
+	tests := []struct {
+		name     string
+		gomod    string
+		message  string
+		expected string
+	}{
+		{
+			name:    "not deprecated",
+			gomod:   "module example.com/mono/client\n\ngo 1.24.6\n",
+			message: "use example.com/mono/client/v2",
+			expected: "// Deprecated: use example.com/mono/client/v2\n" +
+				"module example.com/mono/client\n\ngo 1.24.6\n",
+		},
+		{
+			name: "keeps other comments",
+			gomod: "// Package client talks to the server.\n" +
+				"module example.com/mono/client\n\ngo 1.24.6\n",
+			message: "use example.com/mono/client/v2\nand its new options",
+			expected: "// Package client talks to the server.\n//\n" +
+				"// Deprecated: use example.com/mono/client/v2\n// and its new options\n" +
+				"module example.com/mono/client\n\ngo 1.24.6\n",
+		},
+		{
+			name: "replaces previous deprecation",
+			gomod: "// Package client talks to the server.\n//\n" +
+				"// Deprecated: use example.com/mono/sdk\n// instead.\n//\n// Thanks.\n" +
+				"module example.com/mono/client\n\ngo 1.24.6\n",
+			message: "use example.com/mono/client/v2",
+			expected: "// Package client talks to the server.\n//\n// Thanks.\n//\n" +
+				"// Deprecated: use example.com/mono/client/v2\n" +
+				"module example.com/mono/client\n\ngo 1.24.6\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := modfile.Parse("client/go.mod", []byte(tt.gomod), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fsys := vfs.NewOverlay(fstest.MapFS{})
+			m := &modules.Module{FS: fsys, Prefix: ".", FileName: "client", File: f}
+			err = modules.Deprecate(m, tt.message)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if m.Deprecated() != tt.message {
+				t.Errorf("expected deprecation %q, got %q", tt.message, m.Deprecated())
+			}
+			actual, err := fs.ReadFile(fsys, "client/go.mod")
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if string(actual) != tt.expected {
+				t.Errorf("go.mod differs.\nexpected:\n%s\ngot:\n%s", tt.expected, actual)
+			}
+		})
+	}
+}
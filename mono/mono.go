@@ -0,0 +1,413 @@
+// Package mono releases all the Go modules of a monorepo at once.
+//
+// It is the library behind the mono command. A release is done in three
+// steps:
+//
+//	ws, err := mono.LoadDir("./monorepo", nil)
+//	...
+//	plan, err := ws.Plan("v1.2.0")
+//	...
+//	res, err := ws.Apply(plan)
+//
+// and the result can be checked afterwards with Verify. Workspaces are read
+// from and written to a vfs.FS so a release can be calculated in memory (see
+// vfs.Overlay) before writing anything to disk.
+package mono
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+var (
+	ErrNoModules      = errors.New("no modules found")
+	ErrInvalidVersion = errors.New("invalid version")
+	ErrCycle          = modules.ErrMaxIterations
+	ErrPlanMismatch   = errors.New("plan does not belong to workspace")
+	ErrNoFixedPoint   = errors.New("go.sum hashes did not settle")
+)
+
+// Options configures a Workspace. The zero value is ready to use.
+type Options struct {
+	// Logger receives the progress of the release. Defaults to
+	// slog.Default().
+	Logger *slog.Logger
+	// GoModAt reads the go.mod files of the modules at previous versions to
+	// prune the go.sum entries through the module graph at the versions
+	// required. Defaults to the current go.mod files.
+	GoModAt modules.GoModAt
+}
+
+// Workspace is a monorepo with its modules sorted by interdependencies.
+type Workspace struct {
+	FS      vfs.FS
+	Modules []*modules.Module
+
+	logger  *slog.Logger
+	goModAt modules.GoModAt
+	plan    *Plan
+}
+
+// LoadDir works as Load on the operating system directory dir.
+func LoadDir(dir string, opts *Options) (*Workspace, error) {
+	return Load(vfs.Dir(dir), opts)
+}
+
+// Load finds the modules at the root of fsys and their interdependencies.
+func Load(fsys vfs.FS, opts *Options) (*Workspace, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	ws := &Workspace{
+		FS:      fsys,
+		logger:  opts.Logger,
+		goModAt: opts.GoModAt,
+	}
+	if ws.logger == nil {
+		ws.logger = slog.Default()
+	}
+	start := time.Now()
+	ms, err := modules.All(ws.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, ErrNoModules
+	}
+	modules.FetchDirectDeps(ms)
+	modules.FetchIndirectDeps(ms)
+	ws.Modules, err = modules.SortByDirectDeps(ms, len(ms))
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate monorepo interdependencies: %w", err)
+	}
+	ws.logger.Debug("workspace loaded",
+		slog.String("phase", "load"),
+		slog.Int("modules", len(ws.Modules)),
+		slog.Duration("duration", time.Since(start)),
+	)
+	return ws, nil
+}
+
+// Module returns the workspace module with the given module path or
+// directory name.
+func (ws *Workspace) Module(name string) *modules.Module {
+	for _, m := range ws.Modules {
+		if m.Path() == name || m.FileName == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// Plan is the set of changes a release applies to the workspace.
+type Plan struct {
+	Version string
+	// Modules in the order they are released.
+	Modules []ModulePlan
+}
+
+// ModulePlan holds the changes of a single module.
+type ModulePlan struct {
+	Path     string
+	Dir      string
+	Requires []Requirement
+	// Pruned go.sum entries of monorepo modules no longer required.
+	Pruned []module.Version
+}
+
+// Requirement is an interdependency version change.
+type Requirement struct {
+	Path string
+	// From is empty when the requirement is missing and gets added.
+	From     string
+	To       string
+	Indirect bool
+}
+
+// Plan computes the changes to release all modules at version. The
+// workspace is left untouched until the plan is applied so a plan can be
+// dropped and a new one computed.
+func (ws *Workspace) Plan(version string) (*Plan, error) {
+	if !semver.IsValid(version) {
+		return nil, fmt.Errorf("failed to update modules to new version: %w %q", ErrInvalidVersion, version)
+	}
+	p := &Plan{Version: version}
+	for _, m := range ws.Modules {
+		// Sums are pruned on a copy and only removed when applying.
+		pruned := *m
+		pruned.Sums = maps.Clone(m.Sums)
+		mp := ModulePlan{
+			Path:   m.Path(),
+			Dir:    m.FileName,
+			Pruned: modules.PruneSums(&pruned, ws.Modules, ws.goModAt),
+		}
+		for i, d := range m.Deps {
+			mp.Requires = append(mp.Requires, Requirement{
+				Path:     d.Path(),
+				From:     m.DepsVersion[i],
+				To:       version,
+				Indirect: m.DepsIndirect[i],
+			})
+		}
+		p.Modules = append(p.Modules, mp)
+	}
+	ws.logger.Debug("release planned",
+		slog.String("phase", "plan"),
+		slog.String("version", version),
+		slog.Int("modules", len(p.Modules)),
+	)
+	ws.plan = p
+	return p, nil
+}
+
+// Result holds the hashes of the released modules.
+type Result struct {
+	Version string
+	Modules []ModuleResult
+}
+
+// ModuleResult holds the new hashes of a released module.
+type ModuleResult struct {
+	Path      string
+	Dir       string
+	GoModHash string
+	DirHash   string
+	// Deprecated is the module deprecation message, if any.
+	Deprecated string
+}
+
+// UpdateError is returned when a module file could not be updated.
+type UpdateError struct {
+	Module string
+	Dir    string
+	File   string
+	Err    error
+}
+
+func (e *UpdateError) Error() string {
+	return fmt.Sprintf("failed to update %q %s: %v", e.Dir, e.File, e.Err)
+}
+
+func (e *UpdateError) Unwrap() error { return e.Err }
+
+// Apply writes the go.mod and go.sum files of every module in the plan
+// calculating the new hashes on the way. A plan can only be applied once.
+func (ws *Workspace) Apply(p *Plan) (*Result, error) {
+	if p == nil || p != ws.plan {
+		return nil, ErrPlanMismatch
+	}
+	start := time.Now()
+	for i, m := range ws.Modules {
+		for _, md := range p.Modules[i].Pruned {
+			delete(m.Sums, md)
+		}
+	}
+	err := modules.UpdateVersion(ws.Modules, p.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update modules to new version: %w", err)
+	}
+	res := &Result{Version: p.Version}
+	for _, m := range ws.Modules {
+		moduleStart := time.Now()
+		err := modules.UpdateGoMod(m)
+		if err != nil {
+			return nil, &UpdateError{Module: m.Path(), Dir: m.Dir(), File: "go.mod", Err: err}
+		}
+		err = modules.UpdateGoSum(m)
+		if err != nil {
+			return nil, &UpdateError{Module: m.Path(), Dir: m.Dir(), File: "go.sum", Err: err}
+		}
+		ws.logger.Info("module updated",
+			slog.String("module", m.Path()),
+			slog.String("phase", "apply"),
+			slog.String("gomod-hash", m.GoModHash),
+			slog.String("dir-hash", m.DirHash),
+			slog.Duration("duration", time.Since(moduleStart)),
+		)
+		if m.Deprecated() != "" {
+			ws.logger.Warn("releasing deprecated module",
+				slog.String("module", m.Path()),
+				slog.String("phase", "apply"),
+				slog.String("deprecated", m.Deprecated()),
+			)
+		}
+		res.Modules = append(res.Modules, ModuleResult{
+			Path:       m.Path(),
+			Dir:        m.FileName,
+			GoModHash:  m.GoModHash,
+			DirHash:    m.DirHash,
+			Deprecated: m.Deprecated(),
+		})
+	}
+	ws.plan = nil
+	ws.logger.Info("all modules updated",
+		slog.String("phase", "apply"),
+		slog.String("version", p.Version),
+		slog.Duration("duration", time.Since(start)),
+	)
+	return res, nil
+}
+
+// Mismatch is a go.sum entry of a monorepo module that does not match the
+// hash of the module current tree.
+type Mismatch struct {
+	// Module holding the go.sum file.
+	Module string
+	// Entry of the go.sum file. Its version ends with "/go.mod" for go.mod
+	// hashes.
+	Entry    module.Version
+	Expected string
+	Actual   string
+}
+
+// VerifyError lists the go.sum entries not matching the workspace.
+type VerifyError struct {
+	Mismatches []Mismatch
+}
+
+func (e *VerifyError) Error() string {
+	msg := fmt.Sprintf("%d go.sum entries do not match the monorepo modules", len(e.Mismatches))
+	for _, m := range e.Mismatches {
+		msg += fmt.Sprintf("\n\t%s: %s %s (expected %s)", m.Module, m.Entry, m.Actual, m.Expected)
+	}
+	return msg
+}
+
+// Verify reads the workspace again from its FS and checks that the go.sum
+// entries of every interdependency match the hashes of the required module.
+// It returns a *VerifyError listing the entries that do not.
+func (ws *Workspace) Verify() error {
+	fresh, err := Load(ws.FS, &Options{Logger: ws.logger})
+	if err != nil {
+		return err
+	}
+	ms, err := mismatches(fresh.Modules)
+	if err != nil {
+		return err
+	}
+	if len(ms) > 0 {
+		return &VerifyError{Mismatches: ms}
+	}
+	return nil
+}
+
+// Finalize hashes the interdependencies again against the workspace files and
+// writes the go.sum entries that do not match. As fixing a go.sum file changes
+// the hash of its own module, it repeats until no entry changes. It returns
+// every entry changed, Expected holding the original hash and Actual the
+// final one.
+func (ws *Workspace) Finalize() ([]Mismatch, error) {
+	var changed []Mismatch
+	for range len(ws.Modules) + 1 {
+		fresh, err := Load(ws.FS, &Options{Logger: ws.logger})
+		if err != nil {
+			return nil, err
+		}
+		ms, err := mismatches(fresh.Modules)
+		if err != nil {
+			return nil, err
+		}
+		if len(ms) == 0 {
+			ws.Modules = fresh.Modules
+			return changed, nil
+		}
+		var fixed []*modules.Module
+		for _, mm := range ms {
+			m := fresh.Module(mm.Module)
+			m.Sums[mm.Entry] = []string{mm.Actual}
+			if !slices.Contains(fixed, m) {
+				fixed = append(fixed, m)
+			}
+			i := slices.IndexFunc(changed, func(c Mismatch) bool {
+				return c.Module == mm.Module && c.Entry == mm.Entry
+			})
+			if i < 0 {
+				changed = append(changed, mm)
+			} else {
+				changed[i].Actual = mm.Actual
+			}
+		}
+		for _, m := range fixed {
+			err = modules.WriteGoSum(m)
+			if err != nil {
+				return nil, &UpdateError{Module: m.Path(), Dir: m.Dir(), File: "go.sum", Err: err}
+			}
+			ws.logger.Info("module go.sum finalized",
+				slog.String("module", m.Path()),
+				slog.String("phase", "finalize"),
+				slog.String("file", path.Join(m.Dir(), "go.sum")),
+			)
+		}
+	}
+	return changed, ErrNoFixedPoint
+}
+
+// mismatches returns the go.sum entries of mods interdependencies that do
+// not match the required module tree.
+func mismatches(mods []*modules.Module) ([]Mismatch, error) {
+	var ms []Mismatch
+	for _, m := range mods {
+		for i, d := range m.Deps {
+			version := m.DepsVersion[i]
+			if version == "" {
+				continue
+			}
+			gomodHash, dirHash, err := hashAt(d, version)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash %s@%s: %w", d.Path(), version, err)
+			}
+			entries := []struct {
+				v    module.Version
+				hash string
+			}{
+				{module.Version{Path: d.Path(), Version: version}, dirHash},
+				{module.Version{Path: d.Path(), Version: version + "/go.mod"}, gomodHash},
+			}
+			for _, e := range entries {
+				sums, ok := m.Sums[e.v]
+				if !ok || slices.Contains(sums, e.hash) {
+					continue
+				}
+				ms = append(ms, Mismatch{
+					Module:   m.Path(),
+					Entry:    e.v,
+					Expected: sums[0],
+					Actual:   e.hash,
+				})
+			}
+		}
+	}
+	return ms, nil
+}
+
+// hashAt returns the go.mod and directory hashes of the module current tree
+// as if it was tagged with version.
+func hashAt(m *modules.Module, version string) (string, string, error) {
+	data, err := fs.ReadFile(m.FS, path.Join(m.Dir(), "go.mod"))
+	if err != nil {
+		return "", "", err
+	}
+	gomodHash, err := modules.GoModHash(data)
+	if err != nil {
+		return "", "", err
+	}
+	previous := m.Version()
+	m.File.Module.Mod.Version = version
+	defer func() { m.File.Module.Mod.Version = previous }()
+	dirHash, err := modules.DirHash(m)
+	if err != nil {
+		return "", "", err
+	}
+	return gomodHash, dirHash, nil
+}
@@ -0,0 +1,257 @@
+package mono_test
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/mono"
+	"github.com/demula/mono/vfs"
+)
+
+func TestWorkspace(t *testing.T) {
+	const version = "v1.0.0-rc.1"
+	opts := &mono.Options{Logger: slog.New(slog.DiscardHandler)}
+
+	ws, err := mono.Load(vfs.NewOverlay(os.DirFS("../testdata/prev-release/")), opts)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	plan, err := ws.Plan(version)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if len(plan.Modules) != 4 || plan.Modules[0].Dir != "api" {
+		t.Fatalf("unexpected plan order %+v", plan.Modules)
+	}
+	for _, mp := range plan.Modules {
+		for _, r := range mp.Requires {
+			if r.From != "v0.10.2-alpha.2" || r.To != version {
+				t.Errorf("unexpected %s requirement %+v", mp.Dir, r)
+			}
+		}
+	}
+
+	res, err := ws.Apply(plan)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if len(res.Modules) != 4 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	err = ws.Verify()
+	if err != nil {
+		t.Errorf("unexpected verify error %q", err)
+	}
+
+	_, err = ws.Apply(plan)
+	if !errors.Is(err, mono.ErrPlanMismatch) {
+		t.Errorf("expected plan mismatch error applying twice, got %v", err)
+	}
+}
+
+func TestPlanDropped(t *testing.T) {
+	fsys := vfs.NewOverlay(os.DirFS("../testdata/prev-release/"))
+	ws, err := mono.Load(fsys, &mono.Options{Logger: slog.New(slog.DiscardHandler)})
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	dropped, err := ws.Plan("v1.0.0-rc.1")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	plan, err := ws.Plan("v1.0.0")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	for i, mp := range plan.Modules {
+		if !slices.Equal(mp.Pruned, dropped.Modules[i].Pruned) {
+			t.Errorf("expected %s pruned %v, got %v", mp.Dir, dropped.Modules[i].Pruned, mp.Pruned)
+		}
+		for _, r := range mp.Requires {
+			if r.From != "v0.10.2-alpha.2" || r.To != "v1.0.0" {
+				t.Errorf("unexpected %s requirement %+v", mp.Dir, r)
+			}
+		}
+	}
+	if len(fsys.Changes()) != 0 {
+		t.Errorf("unexpected changes planning %v", fsys.Changes())
+	}
+
+	_, err = ws.Apply(dropped)
+	if !errors.Is(err, mono.ErrPlanMismatch) {
+		t.Errorf("expected plan mismatch error applying a dropped plan, got %v", err)
+	}
+	_, err = ws.Apply(plan)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	err = ws.Verify()
+	if err != nil {
+		t.Errorf("unexpected verify error %q", err)
+	}
+}
+
+func TestApplyDeprecated(t *testing.T) {
+	opts := &mono.Options{Logger: slog.New(slog.DiscardHandler)}
+	fsys := vfs.NewOverlay(os.DirFS("../testdata/prev-release/"))
+
+	ws, err := mono.Load(fsys, opts)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	err = modules.Deprecate(ws.Module("cli"), "use the server client")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	ws, err = mono.Load(fsys, opts)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	plan, err := ws.Plan("v1.0.0")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	res, err := ws.Apply(plan)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	for _, mr := range res.Modules {
+		expected := ""
+		if mr.Dir == "cli" {
+			expected = "use the server client"
+		}
+		if mr.Deprecated != expected {
+			t.Errorf("expected %s deprecation %q, got %q", mr.Dir, expected, mr.Deprecated)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		dir      string
+		expected error
+	}{
+		{
+			name:     "no modules found",
+			dir:      "../testdata/empty/",
+			expected: mono.ErrNoModules,
+		},
+		{
+			name:     "wrong interdependencies",
+			dir:      "../testdata/wrong-interdeps/",
+			expected: mono.ErrCycle,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mono.LoadDir(tt.dir, nil)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestPlanInvalidVersion(t *testing.T) {
+	ws, err := mono.LoadDir("../testdata/golden/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	_, err = ws.Plan("not#valid")
+	if !errors.Is(err, mono.ErrInvalidVersion) {
+		t.Errorf("expected invalid version error, got %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	fsys := vfs.NewOverlay(os.DirFS("../testdata/prev-release/"))
+	ws, err := mono.Load(fsys, &mono.Options{Logger: slog.New(slog.DiscardHandler)})
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	plan, err := ws.Plan("v1.0.0-rc.1")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	_, err = ws.Apply(plan)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	err = ws.Verify()
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	err = fsys.WriteFile("api/new.go", []byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ws.Verify()
+	var verr *mono.VerifyError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected verify error, got %v", err)
+	}
+	// core, cli and server go.sum hold api zip hash
+	if len(verr.Mismatches) != 3 {
+		t.Errorf("expected 3 mismatches, got %s", verr)
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	fsys := vfs.NewOverlay(os.DirFS("../testdata/prev-release/"))
+	ws, err := mono.Load(fsys, &mono.Options{Logger: slog.New(slog.DiscardHandler)})
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	plan, err := ws.Plan("v1.0.0-rc.1")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	_, err = ws.Apply(plan)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	changed, err := ws.Finalize()
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("expected no changes after release, got %v", changed)
+	}
+
+	// a file changed after the release alters api hash and in turn the hash
+	// of every module holding it in its go.sum
+	err = fsys.WriteFile("api/new.go", []byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err = ws.Finalize()
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	modified := map[string]bool{}
+	for _, c := range changed {
+		modified[c.Module+" "+c.Entry.Path] = true
+		if c.Expected == c.Actual {
+			t.Errorf("unchanged entry reported %+v", c)
+		}
+	}
+	for _, e := range []string{
+		"github.com/demula/mono-example/core github.com/demula/mono-example/api",
+		"github.com/demula/mono-example/cli github.com/demula/mono-example/core",
+		"github.com/demula/mono-example/server github.com/demula/mono-example/core",
+	} {
+		if !modified[e] {
+			t.Errorf("expected %q entry to be finalized, got %v", e, changed)
+		}
+	}
+	err = ws.Verify()
+	if err != nil {
+		t.Errorf("unexpected verify error after finalize %q", err)
+	}
+}
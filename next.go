@@ -0,0 +1,420 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/demula/mono/apidiff"
+	"github.com/demula/mono/git"
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+const nextUsage = "" +
+	`Running on the root of your monorepo to suggest the next version of every
+module from its last tag, the API changes and the files changed since then:
+	mono next
+
+Specify the root of your monorepo when not in current directory :
+	mono next --context="./testdata"
+
+Module tags are expected as the go command does ("api/v0.1.0" for the module
+in the "api" directory). Plain "v0.1.0" tags are used when a module has none.
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+// Version bumps, initial is used for modules without a previous release.
+const (
+	bumpNone    = "none"
+	bumpPatch   = "patch"
+	bumpMinor   = "minor"
+	bumpMajor   = "major"
+	bumpInitial = "initial"
+)
+
+var (
+	// bumps are ordered from the smallest to the largest.
+	bumps = []string{bumpNone, bumpPatch, bumpMinor, bumpMajor}
+	// initialVersion is suggested to modules never released.
+	initialVersion = "v0.1.0"
+)
+
+// history gives access to the previous releases of the monorepo. Tags and
+// revisions are relative to the monorepo root.
+type history struct {
+	Tags    []string
+	Archive func(rev string) (fs.FS, error)
+	// Changed returns the files of dir that changed since rev.
+	Changed func(rev, dir string) ([]string, error)
+	// Commits counts the commits touching dir since rev, all of them when
+	// rev is empty.
+	Commits func(rev, dir string) (int, error)
+}
+
+// suggestion is the next version of a module and the reasons behind it.
+type suggestion struct {
+	Module   string
+	Previous string
+	Version  string
+	Bump     string
+	Reasons  []string
+}
+
+var nextCommand = &subcommand{
+	Name:    "next",
+	Summary: "suggest the next version of every module",
+	Usage:   nextUsage,
+	Flags: noFlags(func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+		return NextCmd(g.ContextDir, g.IsDebug, flags, args), nil
+	}),
+}
+
+func NextCmd(
+	contextDir string,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "next",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			h, err := gitHistory(contextDir)
+			if err != nil {
+				return err
+			}
+			ss, err := next(vfs.Dir(contextDir), h)
+			if err != nil {
+				if errors.Is(err, ErrNoModulesFound) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			return writeSuggestions(os.Stdout, ss)
+		},
+	}
+}
+
+// gitHistory returns the history of the monorepo at contextDir from its git
+// repository.
+func gitHistory(contextDir string) (history, error) {
+	prefix, err := git.Prefix(contextDir)
+	if err != nil {
+		return history{}, err
+	}
+	tags, err := git.Tags(contextDir)
+	if err != nil {
+		return history{}, err
+	}
+	h := history{
+		Archive: func(rev string) (fs.FS, error) {
+			return git.Archive(contextDir, prefix+rev)
+		},
+		Changed: func(rev, dir string) ([]string, error) {
+			return git.Changed(contextDir, prefix+rev, dir)
+		},
+		Commits: func(rev, dir string) (int, error) {
+			if rev != "" {
+				rev = prefix + rev
+			}
+			return git.Commits(contextDir, rev, dir)
+		},
+	}
+	for _, t := range tags {
+		if strings.HasPrefix(t, prefix) {
+			h.Tags = append(h.Tags, strings.TrimPrefix(t, prefix))
+		}
+	}
+	return h, nil
+}
+
+// next suggests the minimal correct version bump of every module in fsys:
+// major for incompatible API changes, minor for additions and patch for any
+// other change, including the requirement of a sibling that gets a new
+// version.
+func next(fsys vfs.FS, h history) ([]*suggestion, error) {
+	ms, err := modules.All(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, ErrNoModulesFound
+	}
+	roots := make(map[string]string)
+	for _, m := range ms {
+		roots[m.Path()] = m.Dir()
+	}
+	newLoader := apidiff.NewLoader(fsys, roots)
+
+	type release struct {
+		roots  map[string]string
+		loader *apidiff.Loader
+	}
+	releases := make(map[string]*release)
+	load := func(tag string) (*release, error) {
+		if r, ok := releases[tag]; ok {
+			return r, nil
+		}
+		old, err := h.Archive(tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read monorepo at %q: %w", tag, err)
+		}
+		oldMods, err := modules.All(vfs.NewOverlay(old), ".")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch monorepo modules at %q: %w", tag, err)
+		}
+		r := &release{roots: make(map[string]string)}
+		for _, m := range oldMods {
+			r.roots[m.Path()] = m.Dir()
+		}
+		r.loader = apidiff.NewLoader(old, r.roots)
+		releases[tag] = r
+		return r, nil
+	}
+
+	ss := make(map[string]*suggestion)
+	for _, m := range ms {
+		s := &suggestion{Module: m.Path(), Bump: bumpInitial}
+		ss[m.Path()] = s
+		s.Previous = lastTag(h.Tags, m.FileName)
+		if s.Previous == "" {
+			s.Reasons = append(s.Reasons, "no previous release tag")
+			continue
+		}
+		r, err := load(s.Previous)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := r.roots[m.Path()]; !ok {
+			s.Reasons = append(s.Reasons, "not found at "+s.Previous)
+			continue
+		}
+		oldPkgs, err := r.loader.Packages(m.Path())
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %q API at %q: %w", m.Dir(), s.Previous, err)
+		}
+		newPkgs, err := newLoader.Packages(m.Path())
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %q API: %w", m.Dir(), err)
+		}
+		report := apidiff.Diff(oldPkgs, newPkgs)
+		changed, err := h.Changed(s.Previous, m.Dir())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %q changes since %q: %w", m.Dir(), s.Previous, err)
+		}
+
+		s.Bump = bumpNone
+		for _, c := range report.Changes {
+			if !c.Compatible {
+				s.raise(bumpMajor, fmt.Sprintf("incompatible change in %s: %s", c.Package, c))
+			}
+		}
+		for _, c := range report.Changes {
+			if c.Compatible {
+				s.raise(bumpMinor, fmt.Sprintf("compatible change in %s: %s", c.Package, c))
+			}
+		}
+		if len(changed) > 0 {
+			s.raise(bumpPatch, fmt.Sprintf("%d files changed since %s", len(changed), s.Previous))
+		}
+		if s.Bump == bumpMajor && semver.Major(tagVersion(s.Previous)) == "v0" {
+			s.Bump = bumpMinor
+			s.Reasons = append(s.Reasons, "v0 makes no compatibility promises so incompatible changes bump the minor version")
+		}
+		if len(s.Reasons) == 0 {
+			s.Reasons = append(s.Reasons, "no changes since "+s.Previous)
+		}
+	}
+
+	// dependents need a new version to require the new one of their siblings
+	for range ms {
+		for _, m := range ms {
+			s := ss[m.Path()]
+			if s.Bump == bumpInitial {
+				continue
+			}
+			for _, r := range m.File.Require {
+				d, ok := ss[r.Mod.Path]
+				if !ok || d.Bump == bumpNone {
+					continue
+				}
+				reason := "requires " + d.Module + " which gets a new version"
+				if !slices.Contains(s.Reasons, reason) {
+					s.raise(bumpPatch, reason)
+				}
+			}
+		}
+	}
+
+	out := make([]*suggestion, 0, len(ms))
+	for _, m := range ms {
+		s := ss[m.Path()]
+		s.Version = nextVersion(tagVersion(s.Previous), s.Bump)
+		if p := majorPath(m.Path(), s.Version); p != m.Path() {
+			// the go command refuses the version on the current module path
+			s.Reasons = append(s.Reasons, fmt.Sprintf("%s versions require changing the module path to %s",
+				semver.Major(s.Version), p))
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// raise bumps the suggestion to at least b because of reason.
+func (s *suggestion) raise(b, reason string) {
+	s.Reasons = append(s.Reasons, reason)
+	if slices.Index(bumps, b) > slices.Index(bumps, s.Bump) {
+		s.Bump = b
+	}
+}
+
+// lastTag returns the highest version tag of the module in dir, falling back
+// to the plain version tags.
+func lastTag(tags []string, dir string) string {
+	last := ""
+	for _, prefix := range []string{dir + "/", ""} {
+		for _, t := range tags {
+			v, ok := strings.CutPrefix(t, prefix)
+			if !ok || !semver.IsValid(v) || semver.Canonical(v) != v {
+				// shorthands (v1 or v1.2) and build metadata are not module versions
+				continue
+			}
+			if last == "" || semver.Compare(v, tagVersion(last)) > 0 {
+				last = t
+			}
+		}
+		if last != "" {
+			return last
+		}
+	}
+	return ""
+}
+
+// majorPath returns the module path the go command expects for version: the
+// path with its major version suffix, as in example.com/mono/api/v2.
+func majorPath(modPath, version string) string {
+	prefix, pathMajor, ok := module.SplitPathVersion(modPath)
+	if !ok || module.CheckPathMajor(version, pathMajor) == nil {
+		return modPath
+	}
+	major := semver.Major(version)
+	switch {
+	case strings.HasPrefix(modPath, "gopkg.in/"):
+		return prefix + "." + major
+	case major == "v0" || major == "v1":
+		return prefix
+	}
+	return prefix + "/" + major
+}
+
+// versionTag returns the tag of module m at version, falling back to the
+// plain version tag. It is empty when the version is not tagged.
+func versionTag(tags []string, m *modules.Module, version string) string {
+	for _, t := range []string{m.FileName + "/" + version, version} {
+		if slices.Contains(tags, t) {
+			return t
+		}
+	}
+	return ""
+}
+
+// goMods returns the go.mod files of the modules at their tagged versions.
+// The monorepo is read once per tag.
+func (h history) goMods() modules.GoModAt {
+	archives := make(map[string]fs.FS)
+	return func(m *modules.Module, version string) (*modfile.File, error) {
+		tag := versionTag(h.Tags, m, version)
+		if tag == "" {
+			return nil, nil
+		}
+		old, ok := archives[tag]
+		if !ok {
+			var err error
+			old, err = h.Archive(tag)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read monorepo at %q: %w", tag, err)
+			}
+			archives[tag] = old
+		}
+		name := path.Join(m.FileName, "go.mod")
+		data, err := fs.ReadFile(old, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return modfile.ParseLax(name, data, nil)
+	}
+}
+
+// tagVersion returns the version part of a tag.
+func tagVersion(tag string) string {
+	return tag[strings.LastIndex(tag, "/")+1:]
+}
+
+// nextVersion applies the bump b to the version v. A prerelease becomes its
+// release when that is already enough for the bump.
+func nextVersion(v, b string) string {
+	if b == bumpInitial {
+		return initialVersion
+	}
+	if b == bumpNone {
+		return v
+	}
+	var n [3]int
+	for i, p := range strings.Split(strings.TrimPrefix(strings.TrimSuffix(v, semver.Prerelease(v)), "v"), ".") {
+		n[i], _ = strconv.Atoi(p)
+	}
+	if semver.Prerelease(v) != "" {
+		switch {
+		case b == bumpPatch,
+			b == bumpMinor && n[2] == 0,
+			b == bumpMajor && n[1] == 0 && n[2] == 0:
+			return fmt.Sprintf("v%d.%d.%d", n[0], n[1], n[2])
+		}
+	}
+	switch b {
+	case bumpMajor:
+		return fmt.Sprintf("v%d.0.0", n[0]+1)
+	case bumpMinor:
+		return fmt.Sprintf("v%d.%d.0", n[0], n[1]+1)
+	default:
+		return fmt.Sprintf("v%d.%d.%d", n[0], n[1], n[2]+1)
+	}
+}
+
+func writeSuggestions(w io.Writer, ss []*suggestion) error {
+	for _, s := range ss {
+		previous := s.Previous
+		if previous == "" {
+			previous = "(none)"
+		}
+		_, err := fmt.Fprintf(w, "%s: %s -> %s (%s)\n", s.Module, previous, s.Version, s.Bump)
+		if err != nil {
+			return err
+		}
+		for _, r := range s.Reasons {
+			_, err = fmt.Fprintf(w, "\t%s\n", r)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+)
+
+func TestNext(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		tags     []string
+		old      string
+		changed  map[string][]string
+		expected string
+	}{
+		{
+			name:    "incompatible and compatible changes",
+			tags:    []string{"api/v1.0.0", "api/v1.1.0-rc.1", "core/v1.2.0", "core/v1.10.0", "v0.9.0"},
+			old:     "./testdata/apicheck/old/",
+			changed: map[string][]string{"api": {"api/api.go"}, "core": {"core/core.go"}},
+			expected: `example.com/mono/api: api/v1.1.0-rc.1 -> v2.0.0 (major)
+	incompatible change in example.com/mono/api: Greeter.Close: added
+	incompatible change in example.com/mono/api: Hello.Lang: removed
+	incompatible change in example.com/mono/api: Removed: removed
+	incompatible change in example.com/mono/api: Say: changed from func(h Hello) string to func(h Hello, lang string) string
+	incompatible change in example.com/mono/api: Version: value changed from 1 to 2
+	compatible change in example.com/mono/api: Client.Close: added
+	compatible change in example.com/mono/api: Hello.Age: added
+	compatible change in example.com/mono/api/extra: package added
+	1 files changed since api/v1.1.0-rc.1
+	v2 versions require changing the module path to example.com/mono/api/v2
+example.com/mono/core: core/v1.10.0 -> v1.11.0 (minor)
+	compatible change in example.com/mono/core: Sayer.Say: added
+	1 files changed since core/v1.10.0
+	requires example.com/mono/api which gets a new version
+`,
+		},
+		{
+			name:    "v0 incompatible changes",
+			tags:    []string{"v0.3.0"},
+			old:     "./testdata/apicheck/old/",
+			changed: map[string][]string{"api": {"api/api.go"}},
+			expected: `example.com/mono/api: v0.3.0 -> v0.4.0 (minor)
+	incompatible change in example.com/mono/api: Greeter.Close: added
+	incompatible change in example.com/mono/api: Hello.Lang: removed
+	incompatible change in example.com/mono/api: Removed: removed
+	incompatible change in example.com/mono/api: Say: changed from func(h Hello) string to func(h Hello, lang string) string
+	incompatible change in example.com/mono/api: Version: value changed from 1 to 2
+	compatible change in example.com/mono/api: Client.Close: added
+	compatible change in example.com/mono/api: Hello.Age: added
+	compatible change in example.com/mono/api/extra: package added
+	1 files changed since v0.3.0
+	v0 makes no compatibility promises so incompatible changes bump the minor version
+example.com/mono/core: v0.3.0 -> v0.4.0 (minor)
+	compatible change in example.com/mono/core: Sayer.Say: added
+	requires example.com/mono/api which gets a new version
+`,
+		},
+		{
+			name:    "dependents of patched modules",
+			tags:    []string{"api/v1.0.0", "core/v1.0.0-rc.2"},
+			old:     "./testdata/apicheck/new/",
+			changed: map[string][]string{"api": {"api/README.md", "api/api.go"}},
+			expected: `example.com/mono/api: api/v1.0.0 -> v1.0.1 (patch)
+	2 files changed since api/v1.0.0
+example.com/mono/core: core/v1.0.0-rc.2 -> v1.0.0 (patch)
+	no changes since core/v1.0.0-rc.2
+	requires example.com/mono/api which gets a new version
+`,
+		},
+		{
+			name:    "no changes",
+			tags:    []string{"v1.0.0"},
+			old:     "./testdata/apicheck/new/",
+			changed: map[string][]string{},
+			expected: `example.com/mono/api: v1.0.0 -> v1.0.0 (none)
+	no changes since v1.0.0
+example.com/mono/core: v1.0.0 -> v1.0.0 (none)
+	no changes since v1.0.0
+`,
+		},
+		{
+			name: "no previous tags",
+			tags: []string{"api/latest", "v1"},
+			expected: `example.com/mono/api: (none) -> v0.1.0 (initial)
+	no previous release tag
+example.com/mono/core: (none) -> v0.1.0 (initial)
+	no previous release tag
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := history{
+				Tags: tt.tags,
+				Archive: func(rev string) (fs.FS, error) {
+					return os.DirFS(tt.old), nil
+				},
+				Changed: func(rev, dir string) ([]string, error) {
+					return tt.changed[dir], nil
+				},
+			}
+			ss, err := next(vfs.Dir("./testdata/apicheck/new/"), h)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			out := &bytes.Buffer{}
+			err = writeSuggestions(out, ss)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("unexpected suggestions.\nexpected:\n%s\ngot:\n%s", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestNextVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		version  string
+		bump     string
+		expected string
+	}{
+		{version: "v1.2.3", bump: bumpMajor, expected: "v2.0.0"},
+		{version: "v1.2.3", bump: bumpMinor, expected: "v1.3.0"},
+		{version: "v1.2.3", bump: bumpPatch, expected: "v1.2.4"},
+		{version: "v1.2.3", bump: bumpNone, expected: "v1.2.3"},
+		{version: "", bump: bumpInitial, expected: "v0.1.0"},
+		{version: "v2.0.0-rc.1", bump: bumpMajor, expected: "v2.0.0"},
+		{version: "v2.1.0-rc.1", bump: bumpMajor, expected: "v3.0.0"},
+		{version: "v2.1.0-rc.1", bump: bumpMinor, expected: "v2.1.0"},
+		{version: "v2.1.1-rc.1", bump: bumpMinor, expected: "v2.2.0"},
+		{version: "v2.1.1-rc.1", bump: bumpPatch, expected: "v2.1.1"},
+	}
+	for _, tt := range tests {
+		actual := nextVersion(tt.version, tt.bump)
+		if actual != tt.expected {
+			t.Errorf("expected %s %s bump to be %s, got %s", tt.version, tt.bump, tt.expected, actual)
+		}
+	}
+}
+
+func TestMajorPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path     string
+		version  string
+		expected string
+	}{
+		{path: "example.com/mono/api", version: "v1.2.0", expected: "example.com/mono/api"},
+		{path: "example.com/mono/api", version: "v2.0.0", expected: "example.com/mono/api/v2"},
+		{path: "example.com/mono/api/v2", version: "v2.1.0", expected: "example.com/mono/api/v2"},
+		{path: "example.com/mono/api/v2", version: "v3.0.0", expected: "example.com/mono/api/v3"},
+		{path: "example.com/mono/api/v2", version: "v1.0.1", expected: "example.com/mono/api"},
+		{path: "gopkg.in/yaml.v2", version: "v3.0.0", expected: "gopkg.in/yaml.v3"},
+	}
+	for _, tt := range tests {
+		actual := majorPath(tt.path, tt.version)
+		if actual != tt.expected {
+			t.Errorf("expected %s at %s to be %s, got %s", tt.path, tt.version, tt.expected, actual)
+		}
+	}
+}
+
+func TestGoMods(t *testing.T) {
+	t.Parallel()
+
+	ms, err := modules.All(vfs.Dir("./testdata/prev-release/"), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived := 0
+	h := history{
+		Tags: []string{"core/v0.10.2-alpha.2", "v0.9.0"},
+		Archive: func(rev string) (fs.FS, error) {
+			archived++
+			return os.DirFS("./testdata/prev-release/"), nil
+		},
+	}
+	goModAt := h.goMods()
+	var core *modules.Module
+	for _, m := range ms {
+		if m.FileName == "core" {
+			core = m
+		}
+	}
+	for _, version := range []string{"v0.10.2-alpha.2", "v0.9.0"} {
+		f, err := goModAt(core, version)
+		if err != nil {
+			t.Fatalf("unexpected error %q", err)
+		}
+		if f == nil || len(f.Require) != 1 || f.Require[0].Mod.Path != "github.com/demula/mono-example/api" {
+			t.Errorf("expected core go.mod at %s, got %+v", version, f)
+		}
+	}
+	f, err := goModAt(core, "v0.10.1")
+	if err != nil || f != nil {
+		t.Errorf("expected no go.mod for untagged versions, got %+v, %v", f, err)
+	}
+	if archived != 2 {
+		t.Errorf("expected one archive per tag, got %d", archived)
+	}
+}
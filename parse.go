@@ -4,27 +4,109 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
-
-	"golang.org/x/mod/semver"
+	"text/tabwriter"
 )
 
 var ErrInput = errors.New("input error")
 
-const baseUsage = "" +
-	`Usage of 'mono':
-Running on the root of your monorepo 'mono {{subcommand}} {{arguments}}:
+// subcommands are listed in this order in the usage.
+var subcommands = []*subcommand{
+	releaseCommand,
+	checkCommand,
+	tidySumsCommand,
+	licensesCommand,
+	sbomCommand,
+	apicheckCommand,
+	nextCommand,
+	retractCommand,
+	deprecateCommand,
+	statusCommand,
+	explainHashCommand,
+	verifySumsCommand,
+	doctorCommand,
+	completionCommand,
+}
+
+// globals are the flags every subcommand inherits, parsed.
+type globals struct {
+	ContextDir string
+	IsDebug    bool
+	LogFormat  string
+	LogLevel   slog.Level
+	LogFile    string
+}
+
+// builder creates the command once its flags and arguments are parsed.
+// flags holds both the local and the global flags.
+type builder func(g globals, flags *flag.FlagSet, args []string) (*Command, error)
+
+// subcommand declares a mono subcommand. Global flags are inherited so they
+// can be given before or after the subcommand name, and flags can follow the
+// positional arguments (until a "--").
+type subcommand struct {
+	Name string
+	// Args names the positional arguments in the usage, i.e. "<version>".
+	Args string
+	// Summary describes the subcommand in the list of the base usage.
+	Summary string
+	// Usage is the help text printed before the flags.
+	Usage string
+	// MinArgs and MaxArgs bound the positional arguments, a negative
+	// MaxArgs allows any number of them.
+	MinArgs int
+	MaxArgs int
+	// MissingArgs is the error when there are less than MinArgs arguments.
+	MissingArgs string
+	// Flags registers the local flags and returns the builder reading them.
+	Flags func(fs *flag.FlagSet) builder
+	// ArgsComplete completes the positional arguments in order, and
+	// FlagsComplete the values of the local flags, for shell completion.
+	ArgsComplete  []completer
+	FlagsComplete map[string]completer
+}
+
+// lookup returns the subcommand with the given name, nil when unknown.
+func lookup(name string) *subcommand {
+	for _, s := range subcommands {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// baseUsage lists every subcommand with its summary.
+func baseUsage() string {
+	sb := &strings.Builder{}
+	sb.WriteString(`Usage of 'mono':
+	mono [global flags] <subcommand> [flags] [arguments]
+
+Running on the root of your monorepo:
 	mono release --only-go-mod-sum "v0.1.0-alpha.1"
 
-Global flags are allowed before subcommand:
+Subcommands:
+`)
+	tw := tabwriter.NewWriter(sb, 0, 8, 2, ' ', 0)
+	for _, s := range subcommands {
+		_, _ = fmt.Fprintf(tw, "\t%s\t%s\n", s.Name, s.Summary)
+	}
+	_, _ = fmt.Fprintf(tw, "\t%s\t%s\n", "help", "print the usage of a subcommand")
+	_ = tw.Flush()
+	sb.WriteString(`
+Global flags are allowed before and after the subcommand:
 	mono --debug release "v0.1.0-alpha.1"
+	mono release "v0.1.0-alpha.1" --debug
 
-See https://github.com/demula/mono for
-examples on how to use it.
-`
+Run 'mono help <subcommand>' for the usage of a subcommand. See
+https://github.com/demula/mono for examples on how to use it.
+`)
+	return sb.String()
+}
 
 func usage(fs *flag.FlagSet, msg string) func() {
 	return func() {
@@ -44,6 +126,41 @@ func usage(fs *flag.FlagSet, msg string) func() {
 	}
 }
 
+// usage prints the synopsis of the subcommand, its help text and its local
+// and global flags apart.
+func (s *subcommand) usage(out io.Writer, local, global *flag.FlagSet) func() {
+	return func() {
+		synopsis := "mono [global flags] " + s.Name
+		if hasFlags(local) {
+			synopsis += " [flags]"
+		}
+		if s.Args != "" {
+			synopsis += " " + s.Args
+		}
+		_, err := fmt.Fprintf(out, "Usage of 'mono %s':\n\t%s\n\n%s", s.Name, synopsis, s.Usage)
+		if err == nil && hasFlags(local) {
+			_, err = fmt.Fprintln(out, "\nFlags:")
+			local.SetOutput(out)
+			local.PrintDefaults()
+		}
+		if err == nil {
+			_, err = fmt.Fprintln(out, "\nGlobal flags:")
+			global.PrintDefaults()
+		}
+		if err != nil {
+			slog.Error("could not use given output for printing usage",
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
 func version(isDebug bool, fs *flag.FlagSet, args []string) func() error {
 	return func() error {
 		debug(isDebug, fs, args)
@@ -69,18 +186,14 @@ func parse(baseFS *flag.FlagSet, arguments []string) *Command {
 		Flags: baseFS,
 		Run:   func() error { return nil },
 	}
-	baseFS.Usage = usage(baseFS, baseUsage)
-
-	isDebug := baseFS.Bool("debug", false, "print debug messages")
-	getHelp := baseFS.Bool("help", false, "print help information")
-	getVersion := baseFS.Bool("version", false, "print version and build information")
+	baseFS.Usage = usage(baseFS, baseUsage())
 
 	defaultDir, err := os.Getwd()
 	if err != nil {
 		cmd.Error = errors.New("failed to get current directory")
 		return cmd
 	}
-	contextDir := DirValue(baseFS, "context", defaultDir, "specify starting monorepo folder to look for modules")
+	isDebug, getHelp, getVersion := globalFlags(baseFS, defaultDir)
 
 	err = baseFS.Parse(arguments)
 	if err != nil {
@@ -108,94 +221,174 @@ func parse(baseFS *flag.FlagSet, arguments []string) *Command {
 		cmd.Error = fmt.Errorf("%w. missing subcommand", ErrInput)
 		return cmd
 	}
-	cmdName := args[0]
-	if len(args) > 1 {
-		args = args[1:]
-	} else {
-		args = nil
-	}
-	switch cmdName {
-	case "release":
-		cmd.Name = "release"
-		relFS := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
-		relFS.SetOutput(baseFS.Output()) // inherit
-		relFS.Usage = usage(relFS, releaseUsage)
-		cmd.Flags = relFS
+	cmdName, args := args[0], args[1:]
+	if cmdName == completeName {
+		cmd.Name = completeName
+		cmd.Args = args
 		cmd.Run = func() error {
-			debug(*isDebug, relFS, args)
-			relFS.Usage()
-			return nil
-		}
-
-		// Register global flags
-		baseFS.VisitAll(func(f *flag.Flag) {
-			relFS.Var(f.Value, f.Name, f.Usage)
-		})
-		// Reset global flags (easier to test setup using cmd.String())
-		var resetErr error
-		baseFS.Visit(func(f *flag.Flag) {
-			if resetErr != nil {
-				return
-			}
-			err := relFS.Set(f.Name, f.Value.String())
-			if err != nil {
-				resetErr = fmt.Errorf("could not reset flag %q to %q: %w",
-					f.Name, f.Value.String(), err)
+			for _, c := range complete(defaultDir, args) {
+				_, err := fmt.Fprintln(os.Stdout, c)
+				if err != nil {
+					return err
+				}
 			}
-		})
-		if resetErr != nil {
-			cmd.Error = resetErr
-			return cmd
-		}
-		// Register local flags
-		var (
-			isDryRun   = relFS.Bool("dry-run", false, "skip writing to files")
-			isOnlyMode = relFS.Bool("only-go-mod-sum", false, "only change go.mod and go.sum files")
-		)
-		err := relFS.Parse(args)
-		if err != nil {
-			cmd.Error = fmt.Errorf("%w. %w", ErrInput, err)
-			return cmd
+			return nil
 		}
-		args = relFS.Args()
+		return cmd
+	}
+	isHelp := false
+	if cmdName == "help" {
 		if len(args) == 0 {
-			if *getHelp {
-				return cmd
-			}
-			if *getVersion {
-				cmd.Run = version(*isDebug, baseFS, args)
-			}
-			cmd.Error = fmt.Errorf("%w. missing version argument", ErrInput)
 			return cmd
 		}
 		if len(args) > 1 {
 			cmd.Error = fmt.Errorf("%w. too many arguments", ErrInput)
 			return cmd
 		}
+		cmdName, args, isHelp = args[0], nil, true
+	}
+	s := lookup(cmdName)
+	if s == nil {
+		cmd.Error = fmt.Errorf("%w. unknown subcommand %q", ErrInput, cmdName)
+		return cmd
+	}
+	return s.parse(baseFS, args, isHelp)
+}
 
-		if !*isOnlyMode {
-			cmd.Error = fmt.Errorf("%w. only \"--only-go-mod-sum\" mode is supported", ErrInput)
-			return cmd
-		}
+// globalFlags registers the flags every subcommand inherits.
+func globalFlags(fs *flag.FlagSet, defaultDir string) (isDebug, getHelp, getVersion *bool) {
+	isDebug = fs.Bool("debug", false, "print debug messages")
+	getHelp = fs.Bool("help", false, "print help information")
+	getVersion = fs.Bool("version", false, "print version and build information")
+	DirValue(fs, "context", defaultDir, "specify starting monorepo folder to look for modules")
+	LogFormatValue(fs, "log-format", logText, "log format: "+strings.Join(logFormats, ", "))
+	fs.TextVar(new(slog.Level), "log-level", slog.LevelInfo,
+		"minimum level logged: "+strings.Join(logLevels, ", ")+" (--debug sets debug)")
+	fs.String("log-file", "", "write the logs to the given file instead of stderr")
+	return isDebug, getHelp, getVersion
+}
 
-		version := args[0]
-		if version == "" || !semver.IsValid(version) {
-			cmd.Error = fmt.Errorf("%w. invalid version provided", ErrInput)
-			return cmd
+// parse reads the subcommand flags and arguments. The command returned prints
+// the usage when help is requested or the input is wrong.
+func (s *subcommand) parse(baseFS *flag.FlagSet, arguments []string, isHelp bool) *Command {
+	subFS := flag.NewFlagSet(s.Name, flag.ContinueOnError)
+	subFS.SetOutput(baseFS.Output()) // inherit
+	local := flag.NewFlagSet(s.Name, flag.ContinueOnError)
+	build := s.Flags(local)
+	subFS.Usage = s.usage(subFS.Output(), local, baseFS)
+	cmd := &Command{
+		Name:  s.Name,
+		Flags: subFS,
+	}
+	cmd.Run = func() error {
+		debug(globalsOf(subFS).IsDebug, subFS, arguments)
+		subFS.Usage()
+		return nil
+	}
+
+	// Register local and global flags
+	local.VisitAll(func(f *flag.Flag) {
+		subFS.Var(f.Value, f.Name, f.Usage)
+	})
+	baseFS.VisitAll(func(f *flag.Flag) {
+		subFS.Var(f.Value, f.Name, f.Usage)
+	})
+	// Reset global flags (easier to test setup using cmd.String())
+	var resetErr error
+	baseFS.Visit(func(f *flag.Flag) {
+		if resetErr != nil {
+			return
 		}
-		cmd = ReleaseCmd(string(*contextDir), version, *isDryRun, *isDebug, relFS, args)
-	default:
-		cmd.Error = fmt.Errorf("%w. unknown subcommand %q", ErrInput, cmdName)
+		err := subFS.Set(f.Name, f.Value.String())
+		if err != nil {
+			resetErr = fmt.Errorf("could not reset flag %q to %q: %w",
+				f.Name, f.Value.String(), err)
+		}
+	})
+	if resetErr != nil {
+		cmd.Error = resetErr
+		return cmd
+	}
+	args, err := parseInterspersed(subFS, arguments)
+	if err != nil {
+		cmd.Error = fmt.Errorf("%w. %w", ErrInput, err)
+		return cmd
+	}
+	if isHelp || subFS.Lookup("help").Value.String() == "true" {
 		return cmd
 	}
-	return cmd
+	if len(args) < s.MinArgs {
+		cmd.Error = fmt.Errorf("%w. %s", ErrInput, s.MissingArgs)
+		return cmd
+	}
+	if s.MaxArgs >= 0 && len(args) > s.MaxArgs {
+		cmd.Error = fmt.Errorf("%w. too many arguments", ErrInput)
+		return cmd
+	}
+	built, err := build(globalsOf(subFS), subFS, args)
+	if err != nil {
+		cmd.Error = err
+		return cmd
+	}
+	return built
+}
+
+// globalsOf reads the global flags inherited by fs.
+func globalsOf(fs *flag.FlagSet) globals {
+	g := globals{
+		ContextDir: fs.Lookup("context").Value.String(),
+		IsDebug:    fs.Lookup("debug").Value.String() == "true",
+		LogFormat:  fs.Lookup("log-format").Value.String(),
+		LogFile:    fs.Lookup("log-file").Value.String(),
+	}
+	// already validated when parsed
+	_ = g.LogLevel.UnmarshalText([]byte(fs.Lookup("log-level").Value.String()))
+	return g
+}
+
+// parseInterspersed parses the flags of fs found anywhere among arguments
+// and returns the positional ones. Everything after "--" is positional.
+func parseInterspersed(fs *flag.FlagSet, arguments []string) ([]string, error) {
+	args := []string{}
+	for {
+		err := fs.Parse(arguments)
+		if err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return args, nil
+		}
+		if n := len(arguments) - len(rest); n > 0 && arguments[n-1] == "--" {
+			return append(args, rest...), nil
+		}
+		args = append(args, rest[0])
+		arguments = rest[1:]
+	}
+}
+
+// noFlags is the Flags of subcommands without local flags.
+func noFlags(build builder) func(*flag.FlagSet) builder {
+	return func(*flag.FlagSet) builder { return build }
+}
+
+// parseDryRun returns how to preview the changes, nil when they are written.
+func parseDryRun(isDryRun bool, style, patchOut string) (*dryRun, error) {
+	if style != diffUnified && style != diffSideBySide {
+		return nil, fmt.Errorf("%w. unknown diff style %q", ErrInput, style)
+	}
+	if !isDryRun {
+		if style != diffUnified || patchOut != "" {
+			return nil, fmt.Errorf("%w. \"--diff\" and \"--patch-out\" require \"--dry-run\"", ErrInput)
+		}
+		return nil, nil
+	}
+	return &dryRun{Style: style, PatchOut: patchOut}, nil
 }
 
 func debug(isDebug bool, fs *flag.FlagSet, args []string) {
 	if isDebug {
-		slog.SetLogLoggerLevel(slog.LevelDebug)
-
-		var attrs []any
+		attrs := []any{slog.String("command", fs.Name())}
 		fs.VisitAll(func(f *flag.Flag) {
 			attrs = append(attrs, slog.String(
 				f.Name, f.Value.String(),
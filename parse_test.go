@@ -99,76 +99,882 @@ func TestParse(t *testing.T) {
 			},
 		},
 		{
-			name:      "flags after arguments are recognized as arguments",
+			name:      "unknown flags after arguments",
 			arguments: []string{"release", "v0.1.0", "--unknown"},
 			expected: &TestCommand{
 				Name:  "release",
+				Error: "input error. flag provided but not defined: -unknown",
+			},
+		},
+		{
+			name:      "flags after arguments",
+			arguments: []string{"release", "v0.1.0", "--only-go-mod-sum", "--debug"},
+			expected: &TestCommand{
+				Name: "release",
+				Args: []string{
+					"v0.1.0",
+				},
+				Flags: []string{
+					"--debug=true",
+					"--only-go-mod-sum=true",
+				},
+			},
+		},
+		{
+			name:      "flags after terminator are arguments",
+			arguments: []string{"release", "--only-go-mod-sum", "--", "--dry-run"},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--only-go-mod-sum=true",
+				},
+				Error: "input error. invalid version provided",
+			},
+		},
+		{
+			name:      "global flags after subcommand",
+			arguments: []string{"status", "--context=./testdata/"},
+			expected: &TestCommand{
+				Name: "status",
+				Flags: []string{
+					"--context=testdata",
+				},
+			},
+		},
+		{
+			name: "log flags",
+			arguments: []string{
+				"--log-format=json",
+				"status",
+				"--log-level=warn",
+				"--log-file=mono.log",
+			},
+			expected: &TestCommand{
+				Name: "status",
+				Flags: []string{
+					"--log-file=mono.log",
+					"--log-format=json",
+					"--log-level=WARN",
+				},
+			},
+		},
+		{
+			name:      "unknown log format",
+			arguments: []string{"status", "--log-format=yaml"},
+			expected: &TestCommand{
+				Name:  "status",
+				Error: `input error. invalid value "yaml" for flag -log-format: unknown log format "yaml". use one of text, logfmt, json`,
+			},
+		},
+		{
+			name:      "invalid log level",
+			arguments: []string{"--log-level=loud", "status"},
+			expected: &TestCommand{
+				Name:  "base",
+				Error: `input error. invalid value "loud" for flag -log-level: slog: level string "loud": unknown name`,
+			},
+		},
+		{
+			name:      "help subcommand",
+			arguments: []string{"help", "release"},
+			expected: &TestCommand{
+				Name: "release",
+			},
+		},
+		{
+			name:      "help without subcommand",
+			arguments: []string{"help"},
+			expected: &TestCommand{
+				Name: "base",
+			},
+		},
+		{
+			name:      "help unknown subcommand",
+			arguments: []string{"help", "non-existing"},
+			expected: &TestCommand{
+				Name:  "base",
+				Error: "input error. unknown subcommand \"non-existing\"",
+			},
+		},
+		{
+			name:      "help too many arguments",
+			arguments: []string{"help", "release", "check"},
+			expected: &TestCommand{
+				Name:  "base",
 				Error: "input error. too many arguments",
 			},
 		},
 		{
-			name: "release invalid version",
+			name: "release invalid version",
+			arguments: []string{
+				"release",
+				"--only-go-mod-sum",
+				"non-valid",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--only-go-mod-sum=true",
+				},
+				Error: "input error. invalid version provided",
+			},
+		},
+		{
+			name: "release missing version argument",
+			arguments: []string{
+				"release",
+				"--only-go-mod-sum",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--only-go-mod-sum=true",
+				},
+				Error: "input error. missing version argument",
+			},
+		},
+		{
+			name: "release missing 'only-go-mod-sum' mode",
+			arguments: []string{
+				"release",
+				"v0.3.0",
+			},
+			expected: &TestCommand{
+				Name:  "release",
+				Error: `input error. only "--only-go-mod-sum" mode is supported`,
+			},
+		},
+		{
+			name: "release with all flags",
+			arguments: []string{
+				"--context=./testdata/",
+				"--debug",
+				"release",
+				"--dry-run",
+				"--only-go-mod-sum",
+				"v0.0.0-20170915032832-14c0d48ead0c",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Args: []string{
+					"v0.0.0-20170915032832-14c0d48ead0c",
+				},
+				Flags: []string{
+					"--context=testdata",
+					"--debug=true",
+					"--dry-run=true",
+					"--only-go-mod-sum=true",
+				},
+			},
+		},
+		{
+			name: "release from git",
+			arguments: []string{
+				"release",
+				"--from-git=HEAD",
+				"--only-go-mod-sum",
+				"v0.1.0",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Args: []string{
+					"v0.1.0",
+				},
+				Flags: []string{
+					"--from-git=HEAD",
+					"--only-go-mod-sum=true",
+				},
+			},
+		},
+		{
+			name: "release from git with all files",
+			arguments: []string{
+				"release",
+				"--all-files",
+				"--from-git=HEAD",
+				"--only-go-mod-sum",
+				"v0.1.0",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--all-files=true",
+					"--from-git=HEAD",
+					"--only-go-mod-sum=true",
+				},
+				Error: "input error. \"--from-git\" and \"--all-files\" cannot be used together",
+			},
+		},
+		{
+			name: "release checking the proxy",
+			arguments: []string{
+				"release",
+				"--check-proxy",
+				"--only-go-mod-sum",
+				"v0.1.0",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Args: []string{
+					"v0.1.0",
+				},
+				Flags: []string{
+					"--check-proxy=true",
+					"--only-go-mod-sum=true",
+				},
+			},
+		},
+		{
+			name: "release forced while checking the proxy",
+			arguments: []string{
+				"release",
+				"--check-proxy",
+				"--force",
+				"--only-go-mod-sum",
+				"v0.1.0",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--check-proxy=true",
+					"--force=true",
+					"--only-go-mod-sum=true",
+				},
+				Error: "input error. \"--check-proxy\" cannot be used with \"--force\"",
+			},
+		},
+		{
+			name: "release with commit",
+			arguments: []string{
+				"release",
+				"--commit",
+				"--message-template=release {{.Version}}",
+				"--sign",
+				"--only-go-mod-sum",
+				"v0.1.0",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Args: []string{
+					"v0.1.0",
+				},
+				Flags: []string{
+					"--commit=true",
+					"--message-template=release {{.Version}}",
+					"--only-go-mod-sum=true",
+					"--sign=true",
+				},
+			},
+		},
+		{
+			name: "release sign without commit",
+			arguments: []string{
+				"release",
+				"--sign",
+				"--only-go-mod-sum",
+				"v0.1.0",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--only-go-mod-sum=true",
+					"--sign=true",
+				},
+				Error: "input error. \"--sign\" and \"--message-template\" require \"--commit\"",
+			},
+		},
+		{
+			name: "release invalid message template",
+			arguments: []string{
+				"release",
+				"--commit",
+				"--message-template={{.Version",
+				"--only-go-mod-sum",
+				"v0.1.0",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--commit=true",
+					"--message-template={{.Version",
+					"--only-go-mod-sum=true",
+				},
+				Error: "input error. invalid message template: " +
+					"template: message:1: unclosed action",
+			},
+		},
+		{
+			name: "release finalize",
+			arguments: []string{
+				"release",
+				"--finalize",
+				"--only-go-mod-sum",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--finalize=true",
+					"--only-go-mod-sum=true",
+				},
+			},
+		},
+		{
+			name:      "release interactive",
+			arguments: []string{"release", "-i"},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--i=true",
+				},
+			},
+		},
+		{
+			name:      "release interactive with version",
+			arguments: []string{"release", "--interactive", "--diff=side-by-side", "v0.2.0"},
+			expected: &TestCommand{
+				Name: "release",
+				Args: []string{"v0.2.0"},
+				Flags: []string{
+					"--diff=side-by-side",
+					"--interactive=true",
+				},
+			},
+		},
+		{
+			name:      "release interactive finalize",
+			arguments: []string{"release", "-i", "--finalize"},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--finalize=true",
+					"--i=true",
+				},
+				Error: `input error. "--interactive" cannot be used with "--finalize"`,
+			},
+		},
+		{
+			name: "release finalize with version",
+			arguments: []string{
+				"release",
+				"--finalize",
+				"--only-go-mod-sum",
+				"v0.1.0",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--finalize=true",
+					"--only-go-mod-sum=true",
+				},
+				Error: "input error. too many arguments",
+			},
+		},
+		{
+			name: "release finalize with commit",
+			arguments: []string{
+				"release",
+				"--commit",
+				"--finalize",
+				"--only-go-mod-sum",
+			},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--commit=true",
+					"--finalize=true",
+					"--only-go-mod-sum=true",
+				},
+				Error: "input error. \"--finalize\" cannot be used with \"--all-files\" or \"--commit\"",
+			},
+		},
+		{
+			name:      "check help",
+			arguments: []string{"check", "--help"},
+			expected: &TestCommand{
+				Name: "check",
+				Flags: []string{
+					"--help=true",
+				},
+			},
+		},
+		{
+			name:      "check too many arguments",
+			arguments: []string{"check", "v0.1.0"},
+			expected: &TestCommand{
+				Name:  "check",
+				Error: "input error. too many arguments",
+			},
+		},
+		{
+			name: "tidy-sums with all flags",
+			arguments: []string{
+				"--context=./testdata/",
+				"tidy-sums",
+				"--dry-run",
+			},
+			expected: &TestCommand{
+				Name: "tidy-sums",
+				Flags: []string{
+					"--context=testdata",
+					"--dry-run=true",
+				},
+			},
+		},
+		{
+			name: "tidy-sums dry-run diff",
+			arguments: []string{
+				"tidy-sums",
+				"--dry-run",
+				"--diff=side-by-side",
+				"--patch-out=tidy.patch",
+			},
+			expected: &TestCommand{
+				Name: "tidy-sums",
+				Flags: []string{
+					"--diff=side-by-side",
+					"--dry-run=true",
+					"--patch-out=tidy.patch",
+				},
+			},
+		},
+		{
+			name:      "tidy-sums unknown diff style",
+			arguments: []string{"tidy-sums", "--dry-run", "--diff=context"},
+			expected: &TestCommand{
+				Name: "tidy-sums",
+				Flags: []string{
+					"--diff=context",
+					"--dry-run=true",
+				},
+				Error: `input error. unknown diff style "context"`,
+			},
+		},
+		{
+			name:      "release patch without dry-run",
+			arguments: []string{"release", "--only-go-mod-sum", "--patch-out=release.patch", "v0.1.0"},
+			expected: &TestCommand{
+				Name: "release",
+				Flags: []string{
+					"--only-go-mod-sum=true",
+					"--patch-out=release.patch",
+				},
+				Error: `input error. "--diff" and "--patch-out" require "--dry-run"`,
+			},
+		},
+		{
+			name: "check with all flags",
+			arguments: []string{
+				"--context=./testdata/",
+				"--debug",
+				"check",
+				"--license-files=LICENSE,COPYING",
+			},
+			expected: &TestCommand{
+				Name: "check",
+				Flags: []string{
+					"--context=testdata",
+					"--debug=true",
+					"--license-files=LICENSE,COPYING",
+				},
+			},
+		},
+		{
+			name: "licenses with all flags",
+			arguments: []string{
+				"--context=./testdata/licensed/",
+				"licenses",
+				"--deny=AGPL",
+				"--format=json",
+				"--license-files=LICENSE",
+				"--modcache=./testdata/modcache/",
+			},
+			expected: &TestCommand{
+				Name: "licenses",
+				Flags: []string{
+					"--context=testdata/licensed",
+					"--deny=AGPL",
+					"--format=json",
+					"--license-files=LICENSE",
+					"--modcache=./testdata/modcache/",
+				},
+			},
+		},
+		{
+			name:      "licenses unknown format",
+			arguments: []string{"licenses", "--format=xml"},
+			expected: &TestCommand{
+				Name: "licenses",
+				Flags: []string{
+					"--format=xml",
+				},
+				Error: "input error. unknown format \"xml\"",
+			},
+		},
+		{
+			name: "sbom with all flags",
+			arguments: []string{
+				"--context=./testdata/licensed/",
+				"sbom",
+				"--format=spdx-json",
+				"--modcache=./testdata/modcache/",
+				"--output-dir=./dist/sbom/",
+				"v0.2.0",
+			},
+			expected: &TestCommand{
+				Name: "sbom",
+				Args: []string{
+					"v0.2.0",
+				},
+				Flags: []string{
+					"--context=testdata/licensed",
+					"--format=spdx-json",
+					"--modcache=./testdata/modcache/",
+					"--output-dir=./dist/sbom/",
+				},
+			},
+		},
+		{
+			name:      "sbom missing version argument",
+			arguments: []string{"sbom"},
+			expected: &TestCommand{
+				Name:  "sbom",
+				Error: "input error. missing version argument",
+			},
+		},
+		{
+			name:      "sbom invalid version",
+			arguments: []string{"sbom", "0.2.0"},
+			expected: &TestCommand{
+				Name:  "sbom",
+				Error: "input error. invalid version provided",
+			},
+		},
+		{
+			name:      "sbom unknown format",
+			arguments: []string{"sbom", "--format=cyclonedx-xml", "v0.2.0"},
+			expected: &TestCommand{
+				Name: "sbom",
+				Flags: []string{
+					"--format=cyclonedx-xml",
+				},
+				Error: "input error. unknown format \"cyclonedx-xml\"",
+			},
+		},
+		{
+			name: "apicheck with version",
 			arguments: []string{
-				"release",
-				"--only-go-mod-sum",
-				"non-valid",
+				"apicheck",
+				"--since=api/v0.1.0",
+				"v0.2.0",
 			},
 			expected: &TestCommand{
-				Name: "release",
+				Name: "apicheck",
+				Args: []string{
+					"v0.2.0",
+				},
 				Flags: []string{
-					"--only-go-mod-sum=true",
+					"--since=api/v0.1.0",
+				},
+			},
+		},
+		{
+			name:      "apicheck missing since",
+			arguments: []string{"apicheck"},
+			expected: &TestCommand{
+				Name:  "apicheck",
+				Error: "input error. missing --since flag",
+			},
+		},
+		{
+			name:      "apicheck invalid version",
+			arguments: []string{"apicheck", "--since=v0.1.0", "0.2.0"},
+			expected: &TestCommand{
+				Name: "apicheck",
+				Flags: []string{
+					"--since=v0.1.0",
 				},
 				Error: "input error. invalid version provided",
 			},
 		},
 		{
-			name: "release missing version argument",
+			name:      "next",
+			arguments: []string{"--context=./testdata/apicheck/new/", "next"},
+			expected: &TestCommand{
+				Name: "next",
+				Flags: []string{
+					"--context=testdata/apicheck/new",
+				},
+			},
+		},
+		{
+			name:      "next too many arguments",
+			arguments: []string{"next", "v0.2.0"},
+			expected: &TestCommand{
+				Name:  "next",
+				Error: "input error. too many arguments",
+			},
+		},
+		{
+			name: "retract with all flags",
 			arguments: []string{
-				"release",
-				"--only-go-mod-sum",
+				"retract",
+				"--dry-run",
+				"--rationale=broken API",
+				"--release=v0.1.3",
+				"all",
+				"[v0.1.0,v0.1.2]",
 			},
 			expected: &TestCommand{
-				Name: "release",
+				Name: "retract",
+				Args: []string{
+					"all",
+					"[v0.1.0,v0.1.2]",
+				},
 				Flags: []string{
-					"--only-go-mod-sum=true",
+					"--dry-run=true",
+					"--rationale=broken API",
+					"--release=v0.1.3",
 				},
-				Error: "input error. missing version argument",
 			},
 		},
 		{
-			name: "release missing 'only-go-mod-sum' mode",
+			name:      "retract missing version",
+			arguments: []string{"retract", "--rationale=broken API", "api"},
+			expected: &TestCommand{
+				Name: "retract",
+				Flags: []string{
+					"--rationale=broken API",
+				},
+				Error: "input error. missing module and version arguments",
+			},
+		},
+		{
+			name:      "retract missing rationale",
+			arguments: []string{"retract", "api", "v0.1.1"},
+			expected: &TestCommand{
+				Name:  "retract",
+				Error: "input error. missing --rationale flag",
+			},
+		},
+		{
+			name:      "retract invalid range",
+			arguments: []string{"retract", "--rationale=broken API", "api", "[v0.1.1]"},
+			expected: &TestCommand{
+				Name: "retract",
+				Flags: []string{
+					"--rationale=broken API",
+				},
+				Error: "input error. invalid version range \"[v0.1.1]\"",
+			},
+		},
+		{
+			name:      "retract releasing a lower version",
+			arguments: []string{"retract", "--rationale=broken API", "--release=v0.1.1", "api", "v0.1.1"},
+			expected: &TestCommand{
+				Name: "retract",
+				Flags: []string{
+					"--rationale=broken API",
+					"--release=v0.1.1",
+				},
+				Error: "input error. release version must be higher than the retracted ones",
+			},
+		},
+		{
+			name:      "retract forced without release",
+			arguments: []string{"retract", "--rationale=broken API", "--force", "api", "v0.1.1"},
+			expected: &TestCommand{
+				Name: "retract",
+				Flags: []string{
+					"--force=true",
+					"--rationale=broken API",
+				},
+				Error: "input error. \"--force\" requires \"--release\"",
+			},
+		},
+		{
+			name: "deprecate with all flags",
 			arguments: []string{
-				"release",
-				"v0.3.0",
+				"deprecate",
+				"--dry-run",
+				"--message=use example.com/mono/client/v2",
+				"client",
 			},
 			expected: &TestCommand{
-				Name:  "release",
-				Error: `input error. only "--only-go-mod-sum" mode is supported`,
+				Name: "deprecate",
+				Args: []string{
+					"client",
+				},
+				Flags: []string{
+					"--dry-run=true",
+					"--message=use example.com/mono/client/v2",
+				},
 			},
 		},
 		{
-			name: "release with all flags",
+			name:      "deprecate missing module",
+			arguments: []string{"deprecate", "--message=use sdk"},
+			expected: &TestCommand{
+				Name: "deprecate",
+				Flags: []string{
+					"--message=use sdk",
+				},
+				Error: "input error. missing module argument",
+			},
+		},
+		{
+			name:      "deprecate missing message",
+			arguments: []string{"deprecate", "client"},
+			expected: &TestCommand{
+				Name:  "deprecate",
+				Error: "input error. missing --message flag",
+			},
+		},
+		{
+			name: "status with all flags",
 			arguments: []string{
 				"--context=./testdata/",
-				"--debug",
-				"release",
-				"--dry-run",
-				"--only-go-mod-sum",
-				"v0.0.0-20170915032832-14c0d48ead0c",
+				"status",
+				"--output=json",
 			},
 			expected: &TestCommand{
-				Name: "release",
+				Name: "status",
+				Flags: []string{
+					"--context=testdata",
+					"--output=json",
+				},
+			},
+		},
+		{
+			name:      "status unknown output",
+			arguments: []string{"status", "--output=yaml"},
+			expected: &TestCommand{
+				Name: "status",
+				Flags: []string{
+					"--output=yaml",
+				},
+				Error: `input error. unknown output "yaml"`,
+			},
+		},
+		{
+			name:      "status too many arguments",
+			arguments: []string{"status", "api"},
+			expected: &TestCommand{
+				Name:  "status",
+				Error: "input error. too many arguments",
+			},
+		},
+		{
+			name: "explain-hash with all flags",
+			arguments: []string{
+				"explain-hash",
+				"--at=v0.2.0",
+				"--against=api/v0.1.0",
+				"api",
+			},
+			expected: &TestCommand{
+				Name: "explain-hash",
 				Args: []string{
-					"v0.0.0-20170915032832-14c0d48ead0c",
+					"api",
+				},
+				Flags: []string{
+					"--against=api/v0.1.0",
+					"--at=v0.2.0",
+				},
+			},
+		},
+		{
+			name:      "explain-hash missing module",
+			arguments: []string{"explain-hash"},
+			expected: &TestCommand{
+				Name:  "explain-hash",
+				Error: "input error. missing module argument",
+			},
+		},
+		{
+			name:      "explain-hash invalid version",
+			arguments: []string{"explain-hash", "--at=0.2", "api"},
+			expected: &TestCommand{
+				Name: "explain-hash",
+				Flags: []string{
+					"--at=0.2",
+				},
+				Error: "input error. invalid version provided",
+			},
+		},
+		{
+			name: "verify-sums with all flags",
+			arguments: []string{
+				"verify-sums",
+				"--sumdb=sum.golang.org",
+			},
+			expected: &TestCommand{
+				Name: "verify-sums",
+				Flags: []string{
+					"--sumdb=sum.golang.org",
 				},
+			},
+		},
+		{
+			name:      "verify-sums unknown checksum database",
+			arguments: []string{"verify-sums", "--sumdb=sum.example.com"},
+			expected: &TestCommand{
+				Name: "verify-sums",
+				Flags: []string{
+					"--sumdb=sum.example.com",
+				},
+				Error: `input error. unknown checksum database "sum.example.com", give its key`,
+			},
+		},
+		{
+			name:      "doctor",
+			arguments: []string{"doctor", "--context=./testdata/"},
+			expected: &TestCommand{
+				Name: "doctor",
 				Flags: []string{
 					"--context=testdata",
-					"--debug=true",
-					"--dry-run=true",
-					"--only-go-mod-sum=true",
 				},
 			},
 		},
+		{
+			name:      "doctor too many arguments",
+			arguments: []string{"doctor", "api"},
+			expected: &TestCommand{
+				Name:  "doctor",
+				Error: "input error. too many arguments",
+			},
+		},
+		{
+			name:      "completion",
+			arguments: []string{"completion", "zsh"},
+			expected: &TestCommand{
+				Name: "completion",
+				Args: []string{"zsh"},
+			},
+		},
+		{
+			name:      "completion missing shell",
+			arguments: []string{"completion"},
+			expected: &TestCommand{
+				Name:  "completion",
+				Error: "input error. missing shell argument",
+			},
+		},
+		{
+			name:      "completion unknown shell",
+			arguments: []string{"completion", "tcsh"},
+			expected: &TestCommand{
+				Name:  "completion",
+				Error: `input error. unknown shell "tcsh"`,
+			},
+		},
+		{
+			name:      "hidden complete",
+			arguments: []string{"__complete", "release", "--dry-run", ""},
+			expected: &TestCommand{
+				Name: "__complete",
+				Args: []string{"release", "--dry-run", ""},
+			},
+		},
 	}
 	slog.SetLogLoggerLevel(slog.LevelError)
 	t.Parallel()
@@ -192,13 +998,83 @@ func TestParseUsageSet(t *testing.T) {
 		{
 			name:      "base",
 			arguments: []string{"--help"},
-			expected:  baseUsage,
+			expected:  baseUsage(),
 		},
 		{
 			name:      "release",
 			arguments: []string{"release", "--help"},
 			expected:  releaseUsage,
 		},
+		{
+			name:      "help release",
+			arguments: []string{"help", "release"},
+			expected:  releaseUsage,
+		},
+		{
+			name:      "check",
+			arguments: []string{"check", "--help"},
+			expected:  checkUsage,
+		},
+		{
+			name:      "tidy-sums",
+			arguments: []string{"tidy-sums", "--help"},
+			expected:  tidySumsUsage,
+		},
+		{
+			name:      "licenses",
+			arguments: []string{"licenses", "--help"},
+			expected:  licensesUsage,
+		},
+		{
+			name:      "sbom",
+			arguments: []string{"sbom", "--help"},
+			expected:  sbomUsage,
+		},
+		{
+			name:      "apicheck",
+			arguments: []string{"apicheck", "--help"},
+			expected:  apicheckUsage,
+		},
+		{
+			name:      "next",
+			arguments: []string{"next", "--help"},
+			expected:  nextUsage,
+		},
+		{
+			name:      "retract",
+			arguments: []string{"retract", "--help"},
+			expected:  retractUsage,
+		},
+		{
+			name:      "deprecate",
+			arguments: []string{"deprecate", "--help"},
+			expected:  deprecateUsage,
+		},
+		{
+			name:      "status",
+			arguments: []string{"status", "--help"},
+			expected:  statusUsage,
+		},
+		{
+			name:      "explain-hash",
+			arguments: []string{"explain-hash", "--help"},
+			expected:  explainHashUsage,
+		},
+		{
+			name:      "verify-sums",
+			arguments: []string{"verify-sums", "--help"},
+			expected:  verifySumsUsage,
+		},
+		{
+			name:      "doctor",
+			arguments: []string{"doctor", "--help"},
+			expected:  doctorUsage,
+		},
+		{
+			name:      "completion",
+			arguments: []string{"completion", "--help"},
+			expected:  completionUsage,
+		},
 	}
 
 	slog.SetLogLoggerLevel(slog.LevelError)
@@ -230,6 +1106,57 @@ func TestParseUsageSet(t *testing.T) {
 	}
 }
 
+func TestSubcommandUsage(t *testing.T) {
+	t.Parallel()
+
+	base := baseUsage()
+	for _, s := range subcommands {
+		if !strings.Contains(base, s.Name+"  ") || !strings.Contains(base, s.Summary) {
+			t.Errorf("subcommand %q missing from the base usage:\n%s", s.Name, base)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		expected []string
+		missing  []string
+	}{
+		{
+			name:     "release",
+			expected: []string{"\tmono [global flags] release [flags] <version>\n", "\nFlags:\n  -all-files", "\nGlobal flags:\n  -context"},
+		},
+		{
+			name:     "next",
+			expected: []string{"\tmono [global flags] next\n", "\nGlobal flags:\n  -context"},
+			missing:  []string{"\nFlags:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+			rs := flag.NewFlagSet("root", flag.ContinueOnError)
+			rs.SetOutput(buf)
+			cmd := parse(rs, []string{"help", tt.name})
+			err := cmd.Run()
+			if err != nil {
+				t.Fatalf("unexpected error %q", err.Error())
+			}
+			for _, e := range tt.expected {
+				if !strings.Contains(buf.String(), e) {
+					t.Errorf("expected %q in usage:\n%s", e, buf.String())
+				}
+			}
+			for _, m := range tt.missing {
+				if strings.Contains(buf.String(), m) {
+					t.Errorf("unexpected %q in usage:\n%s", m, buf.String())
+				}
+			}
+		})
+	}
+}
+
 func TestParseCheckRun(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -250,6 +1177,14 @@ func TestParseCheckRun(t *testing.T) {
 				"v0.0.0-20170915032832-14c0d48ead0c",
 			},
 		},
+		{
+			name: "check",
+			arguments: []string{
+				"--context=./testdata/golden/",
+				"--debug",
+				"check",
+			},
+		},
 	}
 
 	t.Parallel()
@@ -4,14 +4,22 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
 
+	"github.com/demula/mono/git"
 	"github.com/demula/mono/modules"
+	"github.com/demula/mono/mono"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/semver"
 )
 
 const releaseUsage = "" +
-	`Usage of 'mono release':
-Running on the root of your monorepo and set the new version:
+	`Running on the root of your monorepo and set the new version:
 	mono release --only-go-mod-sum "v0.1.0-alpha.1"
 
 Specify the root of your monorepo when not in current directory :
@@ -23,16 +31,217 @@ To see debug information:
 You can skip writing any files by using --dry-run:
 	mono release --dry-run --only-go-mod-sum "v0.1.0-alpha.1"
 
+The changes are printed as a unified diff instead, or side by side with
+--diff=side-by-side. Save them as a patch for "git apply" with:
+	mono release --dry-run --only-go-mod-sum --patch-out="release.patch" "v0.1.0-alpha.1"
+
+Only files tracked by git are hashed. To compute the release from a commit
+instead of the working tree (the result is still written to the working tree):
+	mono release --only-go-mod-sum --from-git="main" "v0.1.0-alpha.1"
+
+To hash every file on disk, including untracked and ignored ones:
+	mono release --only-go-mod-sum --all-files "v0.1.0-alpha.1"
+
+To commit the changed files (tracked files must not have uncommitted changes):
+	mono release --only-go-mod-sum --commit "v0.1.0-alpha.1"
+
+The commit message is a text/template with the fields .Version, .Files and
+.Deprecated (the deprecated modules with their .Path and .Message):
+	mono release --only-go-mod-sum --commit --sign \
+		--message-template="chore(release): {{.Version}}" "v0.1.0-alpha.1"
+
+To choose the modules and the version with a wizard showing the suggested
+versions and the diff before committing and tagging the release:
+	mono release -i
+
+The answers are read line by line, so they can be piped through stdin.
+
+Versions already tagged for a module, or lower than its latest tag, are
+refused and the next free version is suggested. Look for the versions served
+by GOPROXY too, or release anyway, with:
+	mono release --only-go-mod-sum --check-proxy "v0.1.0-alpha.1"
+	mono release --only-go-mod-sum --force "v0.1.0-alpha.1"
+
+After other tools changed files (i.e. changelog), check that the staged files
+still match the go.sum hashes. Updated go.sum files are written on failure:
+	mono release --only-go-mod-sum --finalize
+
 See https://github.com/demula/mono for
 examples on how to use it.
 `
 
-var ErrNoModulesFound = errors.New("no modules found")
+var (
+	ErrNoModulesFound = errors.New("no modules found")
+	ErrDirtyTree      = errors.New("uncommitted changes")
+)
+
+// defaultMessageTemplate lists the deprecated modules as commit trailers so
+// changelog tools pick them up.
+const defaultMessageTemplate = "chore(release): {{.Version}}" +
+	"{{if .Deprecated}}\n{{range .Deprecated}}\nDeprecated: {{.Path}}: {{.Message}}{{end}}{{end}}"
+
+// releaseGuard configures how the released versions are looked up to refuse
+// releasing them again.
+type releaseGuard struct {
+	IsCheckProxy bool
+}
+
+// released returns the released versions of ms from the git tags of
+// contextDir and, if checked, the module proxy.
+func (g *releaseGuard) released(contextDir string, ms []*modules.Module) (map[string][]string, error) {
+	h, err := gitHistory(contextDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list released versions, use --force to release anyway: %w", err)
+	}
+	var list versionLister
+	if g.IsCheckProxy {
+		vars, err := localEnvironment(contextDir).GoEnv("GOPROXY", "GONOPROXY")
+		if err != nil {
+			return nil, err
+		}
+		list = proxyLister(vars["GOPROXY"], vars["GONOPROXY"], http.DefaultClient)
+	}
+	return releasedVersions(ms, h.Tags, list)
+}
+
+// releaseCommit configures how the release changes are committed.
+type releaseCommit struct {
+	Message *template.Template
+	IsSign  bool
+}
+
+var releaseCommand = &subcommand{
+	Name:         "release",
+	Args:         "<version>",
+	Summary:      "set the version of every module and update their go.mod and go.sum files",
+	Usage:        releaseUsage,
+	MaxArgs:      1,
+	ArgsComplete: []completer{completeVersions},
+	FlagsComplete: map[string]completer{
+		"diff":     completeValues(diffUnified, diffSideBySide),
+		"from-git": completeTags,
+	},
+	Flags: func(fs *flag.FlagSet) builder {
+		var (
+			isDryRun   = fs.Bool("dry-run", false, "skip writing to files")
+			diffStyle  = fs.String("diff", diffUnified, "diff style of --dry-run: unified or side-by-side")
+			patchOut   = fs.String("patch-out", "", "write the --dry-run changes as a git patch to the given file")
+			isOnlyMode = fs.Bool("only-go-mod-sum", false, "only change go.mod and go.sum files")
+			fromGit    = fs.String("from-git", "", "calculate the release from the given git revision")
+			isAllFiles = fs.Bool("all-files", false, "hash untracked and ignored files too")
+			isCommit   = fs.Bool("commit", false, "commit the changed files")
+			msgTmpl    = fs.String("message-template", defaultMessageTemplate, "commit message template")
+			isSign     = fs.Bool("sign", false, "sign the release commit")
+			isFinalize = fs.Bool("finalize", false, "rehash the staged files and fail if any go.sum changes")
+			isWizard   = fs.Bool("interactive", false, "choose the modules and version, then apply, commit and tag")
+			isForce    = fs.Bool("force", false, "release versions already released or lower than the latest")
+			isProxy    = fs.Bool("check-proxy", false, "look for released versions in GOPROXY too")
+		)
+		fs.BoolVar(isWizard, "i", false, "shorthand for --interactive")
+		return func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+			var guard *releaseGuard
+			if !*isForce {
+				guard = &releaseGuard{IsCheckProxy: *isProxy}
+			} else if *isProxy {
+				return nil, fmt.Errorf("%w. \"--check-proxy\" cannot be used with \"--force\"", ErrInput)
+			}
+			if *isWizard {
+				return releaseWizard(g, flags, args, *isDryRun, *diffStyle, *patchOut, *isFinalize,
+					*fromGit, *isAllFiles, *msgTmpl, *isSign, guard)
+			}
+			dryRun, err := parseDryRun(*isDryRun, *diffStyle, *patchOut)
+			if err != nil {
+				return nil, err
+			}
+			if *isFinalize {
+				if len(args) > 0 {
+					return nil, fmt.Errorf("%w. too many arguments", ErrInput)
+				}
+				if !*isOnlyMode {
+					return nil, fmt.Errorf("%w. only \"--only-go-mod-sum\" mode is supported", ErrInput)
+				}
+				if *isAllFiles || *isCommit {
+					return nil, fmt.Errorf("%w. \"--finalize\" cannot be used with \"--all-files\" or \"--commit\"", ErrInput)
+				}
+				return FinalizeCmd(g.ContextDir, *fromGit, dryRun, g.IsDebug, flags, args), nil
+			}
+			if len(args) == 0 {
+				return nil, fmt.Errorf("%w. missing version argument", ErrInput)
+			}
+			if !*isOnlyMode {
+				return nil, fmt.Errorf("%w. only \"--only-go-mod-sum\" mode is supported", ErrInput)
+			}
+			if *fromGit != "" && *isAllFiles {
+				return nil, fmt.Errorf("%w. \"--from-git\" and \"--all-files\" cannot be used together", ErrInput)
+			}
+			var commit *releaseCommit
+			if *isCommit {
+				msg, err := template.New("message").Parse(*msgTmpl)
+				if err != nil {
+					return nil, fmt.Errorf("%w. invalid message template: %w", ErrInput, err)
+				}
+				commit = &releaseCommit{Message: msg, IsSign: *isSign}
+			} else if *isSign || *msgTmpl != defaultMessageTemplate {
+				return nil, fmt.Errorf("%w. \"--sign\" and \"--message-template\" require \"--commit\"", ErrInput)
+			}
+			version := args[0]
+			if version == "" || !semver.IsValid(version) {
+				return nil, fmt.Errorf("%w. invalid version provided", ErrInput)
+			}
+			return ReleaseCmd(g.ContextDir, version, *fromGit, *isAllFiles, commit, dryRun, guard, g.IsDebug, flags, args), nil
+		}
+	},
+}
+
+// releaseWizard builds the interactive release. It always commits, so
+// --commit is implied, and --dry-run stops right after the diff preview.
+func releaseWizard(
+	g globals,
+	flags *flag.FlagSet,
+	args []string,
+	isDryRun bool,
+	diffStyle, patchOut string,
+	isFinalize bool,
+	fromGit string,
+	isAllFiles bool,
+	msgTmpl string,
+	isSign bool,
+	guard *releaseGuard,
+) (*Command, error) {
+	if isFinalize {
+		return nil, fmt.Errorf("%w. \"--interactive\" cannot be used with \"--finalize\"", ErrInput)
+	}
+	if fromGit != "" && isAllFiles {
+		return nil, fmt.Errorf("%w. \"--from-git\" and \"--all-files\" cannot be used together", ErrInput)
+	}
+	preview, err := parseDryRun(true, diffStyle, patchOut)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := template.New("message").Parse(msgTmpl)
+	if err != nil {
+		return nil, fmt.Errorf("%w. invalid message template: %w", ErrInput, err)
+	}
+	version := ""
+	if len(args) > 0 {
+		version = args[0]
+		if !semver.IsValid(version) {
+			return nil, fmt.Errorf("%w. invalid version provided", ErrInput)
+		}
+	}
+	commit := &releaseCommit{Message: msg, IsSign: isSign}
+	return ReleaseWizardCmd(g.ContextDir, version, fromGit, isAllFiles, commit, preview, isDryRun, guard,
+		os.Stdin, os.Stdout, g.IsDebug, flags, args), nil
+}
 
 func ReleaseCmd(
 	contextDir string,
 	version string,
-	isDryRun bool,
+	fromGit string,
+	isAllFiles bool,
+	commit *releaseCommit,
+	dryRun *dryRun,
+	guard *releaseGuard,
 	isDebug bool,
 	flags *flag.FlagSet,
 	args []string,
@@ -43,50 +252,185 @@ func ReleaseCmd(
 		Args:  args,
 		Run: func() error {
 			debug(isDebug, flags, args)
-			err := release(contextDir, version, isDryRun)
+			base, err := releaseBase(contextDir, fromGit, isAllFiles)
+			if err != nil {
+				return err
+			}
+			if guard != nil {
+				ms, err := modules.All(vfs.NewOverlay(base), ".")
+				if err != nil {
+					return fmt.Errorf("failed to fetch monorepo modules: %w", err)
+				}
+				released, err := guard.released(contextDir, ms)
+				if err != nil {
+					return err
+				}
+				err = checkVersion(ms, released, version)
+				if err != nil {
+					return err
+				}
+			}
+			// changes are only written once all of them are calculated
+			fsys := vfs.NewOverlay(base)
+			err = releaseWith(fsys, version, siblingGoMods(contextDir), false)
 			if err != nil {
 				if errors.Is(err, ErrNoModulesFound) {
 					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
 				}
 				return err
 			}
-			return nil
+			if dryRun != nil {
+				return dryRun.preview(contextDir, fsys, os.Stdout)
+			}
+			if commit != nil {
+				err = checkClean(contextDir)
+				if err != nil {
+					return err
+				}
+			}
+			err = fsys.Commit(vfs.Dir(contextDir))
+			if err != nil {
+				return err
+			}
+			if commit == nil {
+				return nil
+			}
+			return commitRelease(contextDir, version, fsys.Changes(), commit)
 		},
 	}
 }
 
-func release(ctxDir, version string, isDryRun bool) error {
-	ms, err := modules.All(ctxDir)
+// checkClean fails when tracked files are dirty as they would end up in the
+// release commit or be missing from it. It must run before the release is
+// written, so the go.mod and go.sum files it rewrites are checked too.
+func checkClean(contextDir string) error {
+	dirty, err := git.Dirty(contextDir)
+	if err != nil {
+		return fmt.Errorf("failed to check for uncommitted changes: %w", err)
+	}
+	if len(dirty) > 0 {
+		return fmt.Errorf("%w on %s. commit or stash them before releasing",
+			ErrDirtyTree, strings.Join(dirty, ", "))
+	}
+	return nil
+}
+
+// deprecation is a deprecated module of the release.
+type deprecation struct {
+	Path    string
+	Message string
+}
+
+func commitRelease(contextDir, version string, changes []string, commit *releaseCommit) error {
+	ms, err := modules.All(vfs.Dir(contextDir), ".")
 	if err != nil {
 		return fmt.Errorf("failed to fetch monorepo modules: %w", err)
 	}
-	if len(ms) == 0 {
-		return ErrNoModulesFound
+	var deprecated []deprecation
+	for _, m := range ms {
+		if m.Deprecated() != "" {
+			deprecated = append(deprecated, deprecation{Path: m.Path(), Message: m.Deprecated()})
+		}
 	}
-	modules.FetchDirectDeps(ms)
-	ms, err = modules.SortByDirectDeps(ms, len(ms))
+	msg := &strings.Builder{}
+	err = commit.Message.Execute(msg, struct {
+		Version    string
+		Files      []string
+		Deprecated []deprecation
+	}{
+		Version:    version,
+		Files:      changes,
+		Deprecated: deprecated,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to calculate monorepo interdependencies: %w", err)
+		return fmt.Errorf("failed to create commit message: %w", err)
+	}
+	err = git.Commit(contextDir, changes, msg.String(), commit.IsSign)
+	if errors.Is(err, git.ErrNothingToCommit) {
+		slog.Warn("release did not change any file, nothing to commit")
+		return nil
 	}
-	err = modules.UpdateVersion(ms, version)
 	if err != nil {
-		return fmt.Errorf("failed to update modules to new version: %w", err)
+		return fmt.Errorf("failed to commit release: %w", err)
 	}
-	for _, m := range ms {
-		err = modules.UpdateGoMod(m, isDryRun)
+	slog.Info("release committed", slog.String("message", msg.String()))
+	return nil
+}
+
+// siblingGoMods returns the go.mod files of the siblings at their tagged
+// versions. It is nil, so the current ones are used, when the git history
+// can not be read.
+func siblingGoMods(contextDir string) modules.GoModAt {
+	h, err := gitHistory(contextDir)
+	if err != nil {
+		slog.Debug("could not read git history, pruning go.sum entries with the current go.mod files",
+			slog.String("error", err.Error()),
+		)
+		return nil
+	}
+	return h.goMods()
+}
+
+// releaseBase returns the monorepo files the release is calculated from.
+func releaseBase(contextDir, fromGit string, isAllFiles bool) (fs.FS, error) {
+	if fromGit != "" {
+		base, err := git.Archive(contextDir, fromGit)
 		if err != nil {
-			return fmt.Errorf("failed to update \"%s/%s\" go.mod: %w", m.Prefix, m.FileName, err)
+			return nil, fmt.Errorf("failed to read monorepo at %q: %w", fromGit, err)
 		}
-		err = modules.UpdateGoSum(m, isDryRun)
-		if err != nil {
-			return fmt.Errorf("failed to update \"%s/%s\" go.sum: %w", m.Prefix, m.FileName, err)
+		return base, nil
+	}
+	if isAllFiles {
+		return os.DirFS(contextDir), nil
+	}
+	base, err := git.Tracked(contextDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list git tracked files, use --all-files to hash every file: %w", err)
+	}
+	return base, nil
+}
+
+func release(fsys vfs.FS, version string, isDryRun bool) error {
+	return releaseModules(fsys, version, nil, nil, isDryRun)
+}
+
+// releaseWith works as release pruning the go.sum entries with the go.mod
+// files of the siblings at the versions required read with goMods, the
+// current ones when nil.
+func releaseWith(fsys vfs.FS, version string, goMods modules.GoModAt, isDryRun bool) error {
+	return releaseModules(fsys, version, nil, goMods, isDryRun)
+}
+
+// releaseModules works as releaseWith on the modules with the given directory
+// names and the siblings they require, leaving the other modules untouched.
+// Every module is released when names is empty.
+func releaseModules(fsys vfs.FS, version string, names []string, goMods modules.GoModAt, isDryRun bool) error {
+	if isDryRun {
+		// changes are calculated in memory and never written
+		fsys = vfs.NewOverlay(fsys)
+	}
+	ws, err := mono.Load(fsys, &mono.Options{GoModAt: goMods})
+	if err != nil {
+		if errors.Is(err, mono.ErrNoModules) {
+			return ErrNoModulesFound
 		}
-		slog.Info("module updated",
-			slog.String("module", m.Path()),
-			slog.String("gomod-hash", m.GoModHash),
-			slog.String("dir-hash", m.DirHash),
-		)
+		return err
 	}
-	slog.Info("all modules updated")
-	return nil
+	if len(names) > 0 {
+		var selected []*modules.Module
+		for _, name := range names {
+			m := pickModule(ws.Modules, name)
+			if m == nil {
+				return fmt.Errorf("%w. unknown module %q", ErrInput, name)
+			}
+			selected = append(selected, m)
+		}
+		ws.Modules = requiredModules(ws.Modules, selected)
+	}
+	plan, err := ws.Plan(version)
+	if err != nil {
+		return err
+	}
+	_, err = ws.Apply(plan)
+	return err
 }
@@ -2,12 +2,22 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
+	"io"
 	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"text/template"
+
+	"github.com/demula/mono/git"
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/mono"
+	"github.com/demula/mono/vfs"
 )
 
 func TestRelease(t *testing.T) {
@@ -30,6 +40,14 @@ func TestRelease(t *testing.T) {
 			name:    "from development",
 			context: "./testdata/dev-commits/",
 		},
+		{
+			name:    "with stale sibling sums",
+			context: "./testdata/stale-sums/",
+		},
+		{
+			name:    "with missing indirect requirement",
+			context: "./testdata/missing-indirect/",
+		},
 		{
 			name:    "invalid version",
 			context: "./testdata/dev-commits/",
@@ -134,18 +152,189 @@ func TestReleaseWithLicense(t *testing.T) {
 	}
 }
 
+func TestReleaseFromGit(t *testing.T) {
+	t.Parallel()
+	const context = "./testdata/prev-release/"
+	const golden = "./testdata/golden/"
+	const goldenVersion = "v1.0.0-rc.1"
+
+	tests := []struct {
+		name    string
+		fromGit string
+	}{
+		{
+			name: "tracked files",
+		},
+		{
+			name:    "from revision",
+			fromGit: "HEAD",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := git.Tracked(context)
+			if errors.Is(err, git.ErrNotRepository) || errors.Is(err, exec.ErrNotFound) {
+				t.Skip("not running from a git repository")
+			}
+			base, err := releaseBase(context, tt.fromGit, false)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			actual := vfs.NewOverlay(base)
+			err = release(actual, goldenVersion, false)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			assertAgainstGoldenTemplate(t, actual, golden)
+		})
+	}
+}
+
+func TestReleaseBaseOutsideGit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.CopyFS(dir, os.DirFS("./testdata/prev-release/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = releaseBase(dir, "", false)
+	if !errors.Is(err, git.ErrNotRepository) && !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("expected the tracked files error, got %v", err)
+	}
+	base, err := releaseBase(dir, "", true)
+	if err != nil {
+		t.Fatalf("unexpected error %q with --all-files", err)
+	}
+	_, err = fs.Stat(base, "api/go.mod")
+	if err != nil {
+		t.Errorf("expected every file on disk, got %v", err)
+	}
+}
+
+func TestReleaseCommit(t *testing.T) {
+	t.Parallel()
+	const goldenVersion = "v1.0.0-rc.1"
+
+	tests := []struct {
+		name       string
+		dirty      string
+		deprecated string
+		expected   string
+		errMsg     string
+	}{
+		{
+			name:     "clean tree",
+			expected: "chore(release): v1.0.0-rc.1",
+		},
+		{
+			name:       "deprecated module",
+			deprecated: "cli",
+			expected: "chore(release): v1.0.0-rc.1\n\n" +
+				"Deprecated: github.com/demula/mono-example/cli: use the server client",
+		},
+		{
+			name:   "other files dirty",
+			dirty:  "api/main.go",
+			errMsg: "uncommitted changes on api/main.go",
+		},
+		{
+			name:   "release files dirty",
+			dirty:  "core/go.mod",
+			errMsg: "uncommitted changes on core/go.mod",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := exec.LookPath("git"); err != nil {
+				t.Skip("git not installed")
+			}
+			dir := t.TempDir()
+			err := os.CopyFS(dir, os.DirFS("./testdata/prev-release/"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.deprecated != "" {
+				ws, err := mono.LoadDir(dir, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = modules.Deprecate(ws.Module(tt.deprecated), "use the server client")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			gitRun(t, dir, "init", "--quiet")
+			gitRun(t, dir, "config", "user.name", "mono")
+			gitRun(t, dir, "config", "user.email", "mono@example.com")
+			gitRun(t, dir, "add", "--all")
+			gitRun(t, dir, "commit", "--quiet", "--no-gpg-sign", "--message=init")
+			if tt.dirty != "" {
+				f, err := os.OpenFile(filepath.Join(dir, tt.dirty), os.O_APPEND|os.O_WRONLY, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = f.WriteString("// uncommitted\n")
+				f.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			commit := &releaseCommit{
+				Message: template.Must(template.New("message").Parse(defaultMessageTemplate)),
+			}
+			flags := flag.NewFlagSet("release", flag.ContinueOnError)
+			cmd := ReleaseCmd(dir, goldenVersion, "", false, commit, nil, &releaseGuard{}, false, flags, nil)
+			err = cmd.Run()
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("expected error %q, got %v", tt.errMsg, err)
+				}
+				if status := gitRun(t, dir, "status", "--porcelain"); status != " M "+tt.dirty+"\n" {
+					t.Errorf("release files written on error:\n%s", status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if tt.deprecated == "" {
+				assertAgainstGoldenTemplate(t, os.DirFS(dir), "./testdata/golden/")
+			}
+			if msg := gitRun(t, dir, "log", "-1", "--format=%B"); strings.TrimSpace(msg) != tt.expected {
+				t.Errorf("expected commit message %q, got %q", tt.expected, msg)
+			}
+			if status := gitRun(t, dir, "status", "--porcelain"); status != "" {
+				t.Errorf("release files left uncommitted:\n%s", status)
+			}
+		})
+	}
+}
+
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %s: %s", args, err, out)
+	}
+	return string(out)
+}
+
 func testAgainstGoldenTemplate(context, version string, isDryRun bool, golden, errMsg string) func(*testing.T) {
 	return func(t *testing.T) {
 		t.Parallel()
 
-		actualPath := t.TempDir()
-		tmpfs := os.DirFS(context)
-		err := os.CopyFS(actualPath, tmpfs)
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		err = release(actualPath, version, isDryRun)
+		actual := vfs.NewOverlay(os.DirFS(context))
+		err := release(actual, version, isDryRun)
 		if errMsg != "" {
 			if err == nil {
 				t.Fatalf("expected error %q", errMsg)
@@ -158,17 +347,15 @@ func testAgainstGoldenTemplate(context, version string, isDryRun bool, golden, e
 		if err != nil {
 			t.Fatalf("unexpected error %q", err)
 		}
-
-		expectedPath := golden
-		if context == golden {
-			expectedPath = actualPath
+		if isDryRun && len(actual.Changes()) > 0 {
+			t.Errorf("files written on dry run: %v", actual.Changes())
 		}
 
-		assertAgainstGoldenTemplate(t, actualPath, expectedPath)
+		assertAgainstGoldenTemplate(t, actual, golden)
 	}
 }
 
-func assertAgainstGoldenTemplate(t *testing.T, actualPath, expectedPath string) {
+func assertAgainstGoldenTemplate(t *testing.T, actual fs.FS, expectedPath string) {
 	err := filepath.WalkDir(expectedPath, func(path string, expected fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -188,9 +375,9 @@ func assertAgainstGoldenTemplate(t *testing.T, actualPath, expectedPath string)
 			t.Errorf("failed to make base for %q with root %q", path, expectedPath)
 			return err
 		}
-		aPath := filepath.Join(actualPath, rel)
+		aPath := filepath.ToSlash(rel)
 		ePath := filepath.Join(expectedPath, rel)
-		actual, err := os.Stat(aPath)
+		info, err := fs.Stat(actual, aPath)
 		if err != nil {
 			t.Errorf("failed to access %q file", aPath)
 			return err
@@ -199,12 +386,12 @@ func assertAgainstGoldenTemplate(t *testing.T, actualPath, expectedPath string)
 		if expected.IsDir() {
 			return nil
 		}
-		if actual.IsDir() {
+		if info.IsDir() {
 			t.Errorf("%q file should not be a directory", aPath)
 			return err
 		}
 
-		af, err := os.Open(aPath)
+		af, err := actual.Open(aPath)
 		if err != nil {
 			t.Errorf("could not compare %q. error opening %q: %s",
 				expected.Name(), aPath, err.Error(),
@@ -228,10 +415,10 @@ func assertAgainstGoldenTemplate(t *testing.T, actualPath, expectedPath string)
 		defer func() {
 			err := ef.Close()
 			if err != nil {
-				t.Errorf("could not close file %q: %s", aPath, err.Error())
+				t.Errorf("could not close file %q: %s", ePath, err.Error())
 			}
 		}()
-		assertEqualFile(t, ef, af)
+		assertEqualFile(t, aPath, ef, af)
 		return nil
 	})
 	if err != nil {
@@ -241,24 +428,24 @@ func assertAgainstGoldenTemplate(t *testing.T, actualPath, expectedPath string)
 	}
 }
 
-func assertEqualFile(t *testing.T, expected, actual *os.File) {
+func assertEqualFile(t *testing.T, name string, expected, actual io.Reader) {
 	expectedLines, err := readLines(expected)
 	if err != nil {
 		t.Errorf("could not read lines from  %q. error : %s",
-			actual.Name(), err.Error(),
+			name, err.Error(),
 		)
 		return
 	}
 	actualLines, err := readLines(actual)
 	if err != nil {
 		t.Errorf("could not read lines from  %q. error : %s",
-			actual.Name(), err.Error(),
+			name, err.Error(),
 		)
 		return
 	}
 	if len(actualLines) != len(expectedLines) {
 		t.Errorf("%q content size %d does not match %d.\nexpected:\n%s\ngot:\n%s\n",
-			actual.Name(),
+			name,
 			len(expectedLines),
 			len(actualLines),
 			printLines(expectedLines, -1),
@@ -269,7 +456,7 @@ func assertEqualFile(t *testing.T, expected, actual *os.File) {
 	for i := range expectedLines {
 		if actualLines[i] != expectedLines[i] {
 			t.Errorf("%q content differs on line %d.\nexpected:\n%s\ngot:\n%s\n",
-				actual.Name(),
+				name,
 				i,
 				printLines(expectedLines, i),
 				printLines(actualLines, i),
@@ -279,8 +466,8 @@ func assertEqualFile(t *testing.T, expected, actual *os.File) {
 	}
 }
 
-func readLines(f *os.File) ([]string, error) {
-	actualScanner := bufio.NewScanner(f)
+func readLines(r io.Reader) ([]string, error) {
+	actualScanner := bufio.NewScanner(r)
 	var out []string
 	for actualScanner.Scan() {
 		out = append(out, actualScanner.Text())
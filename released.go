@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/demula/mono/modules"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+var ErrVersionReleased = errors.New("version already released")
+
+// versionLister lists the versions of a module path published elsewhere
+// than the git tags, i.e. a module proxy.
+type versionLister func(modPath string) ([]string, error)
+
+// releasedVersions returns the released versions of every module in ms: the
+// tags of its directory, the plain version tags and the versions listed, if
+// a lister is given. Tags go ignores, as v2 tags of a module path without
+// the /v2 suffix, are left out.
+func releasedVersions(ms []*modules.Module, tags []string, list versionLister) (map[string][]string, error) {
+	released := make(map[string][]string, len(ms))
+	for _, m := range ms {
+		_, pathMajor, _ := module.SplitPathVersion(m.Path())
+		var vs []string
+		for _, t := range tags {
+			v, ok := strings.CutPrefix(t, m.FileName+"/")
+			if !ok && !strings.Contains(t, "/") {
+				v, ok = t, true
+			}
+			if ok && semver.IsValid(v) && semver.Canonical(v) == v && module.CheckPathMajor(v, pathMajor) == nil {
+				vs = append(vs, v)
+			}
+		}
+		if list != nil {
+			listed, err := list(m.Path())
+			if err != nil {
+				return nil, fmt.Errorf("failed to list %q versions: %w", m.Path(), err)
+			}
+			for _, v := range listed {
+				if semver.IsValid(v) {
+					vs = append(vs, v)
+				}
+			}
+		}
+		semver.Sort(vs)
+		released[m.Path()] = slices.Compact(vs)
+	}
+	return released, nil
+}
+
+// checkVersion fails when version is already released for a module of ms
+// or lower than its latest release, suggesting the next free version.
+func checkVersion(ms []*modules.Module, released map[string][]string, version string) error {
+	var problems []string
+	latest := ""
+	for _, m := range ms {
+		vs := released[m.Path()]
+		if len(vs) == 0 {
+			continue
+		}
+		last := vs[len(vs)-1]
+		if semver.Compare(last, latest) > 0 {
+			latest = last
+		}
+		switch {
+		case slices.Contains(vs, version):
+			problems = append(problems, fmt.Sprintf("%s has %s", m.FileName, version))
+		case semver.Compare(last, version) > 0:
+			problems = append(problems, fmt.Sprintf("%s has the higher %s", m.FileName, last))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s. release %s instead or use --force",
+			ErrVersionReleased, strings.Join(problems, ", "), nextFreeVersion(latest))
+	}
+	return nil
+}
+
+// nextFreeVersion returns the patch release following latest.
+func nextFreeVersion(latest string) string {
+	return nextVersion(latest, bumpPatch)
+}
+
+// proxyLister lists the versions of the first module proxy of goproxy, as
+// in GOPROXY, serving the module. Modules matching the noProxy patterns are
+// not listed.
+func proxyLister(goproxy, noProxy string, client *http.Client) versionLister {
+	var proxies []string
+	for _, p := range strings.FieldsFunc(goproxy, func(r rune) bool { return r == ',' || r == '|' }) {
+		if p != "direct" && p != "off" {
+			proxies = append(proxies, strings.TrimSuffix(p, "/"))
+		}
+	}
+	return func(modPath string) ([]string, error) {
+		if module.MatchPrefixPatterns(noProxy, modPath) {
+			return nil, nil
+		}
+		epath, err := module.EscapePath(modPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range proxies {
+			resp, err := client.Get(p + "/" + epath + "/@v/list")
+			if err != nil {
+				return nil, err
+			}
+			data, err := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			switch resp.StatusCode {
+			case http.StatusOK:
+				return strings.Fields(string(data)), nil
+			case http.StatusNotFound, http.StatusGone:
+				continue
+			}
+			return nil, fmt.Errorf("%s/%s/@v/list: %s", p, epath, resp.Status)
+		}
+		return nil, nil
+	}
+}
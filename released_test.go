@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+)
+
+func TestCheckVersion(t *testing.T) {
+	t.Parallel()
+
+	ms, err := modules.All(vfs.Dir("./testdata/prev-release/"), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		tags    []string
+		listed  map[string][]string
+		version string
+		errMsg  string
+	}{
+		{
+			name:    "never released",
+			tags:    []string{"nightly", "web/v2.0.0", "api/v2.0.0"},
+			version: "v0.1.0",
+		},
+		{
+			name:    "higher version",
+			tags:    []string{"api/v1.2.0", "core/v1.1.0", "v1.0.0"},
+			version: "v1.2.1-rc.1",
+		},
+		{
+			name:    "tagged version",
+			tags:    []string{"api/v1.1.0", "core/v1.2.0", "cli/v1.2"},
+			version: "v1.2.0",
+			errMsg:  "version already released: core has v1.2.0. release v1.2.1 instead or use --force",
+		},
+		{
+			name:    "lower version",
+			tags:    []string{"api/v1.2.0-rc.1", "core/v1.3.0"},
+			version: "v1.2.0-beta.1",
+			errMsg: "version already released: api has the higher v1.2.0-rc.1, core has the higher v1.3.0. " +
+				"release v1.3.1 instead or use --force",
+		},
+		{
+			name:    "plain tags are every module version",
+			tags:    []string{"v0.2.0"},
+			version: "v0.2.0",
+			errMsg: "version already released: api has v0.2.0, cli has v0.2.0, core has v0.2.0, server has v0.2.0. " +
+				"release v0.2.1 instead or use --force",
+		},
+		{
+			name:    "listed by the proxy",
+			tags:    []string{"api/v0.1.0"},
+			listed:  map[string][]string{"github.com/demula/mono-example/server": {"v0.1.0", "v0.2.0-rc.1", "bad"}},
+			version: "v0.2.0-alpha.1",
+			errMsg: "version already released: server has the higher v0.2.0-rc.1. " +
+				"release v0.2.0 instead or use --force",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var list versionLister
+			if tt.listed != nil {
+				list = func(modPath string) ([]string, error) { return tt.listed[modPath], nil }
+			}
+			released, err := releasedVersions(ms, tt.tags, list)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			err = checkVersion(ms, released, tt.version)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %q", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.errMsg {
+				t.Fatalf("expected error %q, got %v", tt.errMsg, err)
+			}
+			if !errors.Is(err, ErrVersionReleased) {
+				t.Errorf("expected %v, got %v", ErrVersionReleased, err)
+			}
+		})
+	}
+}
+
+func TestProxyLister(t *testing.T) {
+	t.Parallel()
+
+	empty := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(empty.Close)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/example.com/mono/api/@v/list":
+			_, _ = w.Write([]byte("v0.1.0\nv0.2.0\n"))
+		case "/example.com/mono/!core/@v/list":
+			_, _ = w.Write([]byte("v1.0.0\n"))
+		case "/example.com/mono/broken/@v/list":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(proxy.Close)
+
+	list := proxyLister(empty.URL+","+proxy.URL+"/|direct", "example.com/mono/private", proxy.Client())
+	tests := []struct {
+		modPath  string
+		expected []string
+		isErr    bool
+	}{
+		{modPath: "example.com/mono/api", expected: []string{"v0.1.0", "v0.2.0"}},
+		{modPath: "example.com/mono/Core", expected: []string{"v1.0.0"}},
+		{modPath: "example.com/mono/unpublished"},
+		{modPath: "example.com/mono/private"},
+		{modPath: "example.com/mono/broken", isErr: true},
+	}
+	for _, tt := range tests {
+		actual, err := list(tt.modPath)
+		if tt.isErr != (err != nil) {
+			t.Fatalf("%s: unexpected error %v", tt.modPath, err)
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.modPath, tt.expected, actual)
+		}
+	}
+}
+
+func TestReleaseCmdReleased(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	err := os.CopyFS(dir, os.DirFS("./testdata/prev-release/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, dir, "init", "--quiet")
+	gitRun(t, dir, "config", "user.name", "mono")
+	gitRun(t, dir, "config", "user.email", "mono@example.com")
+	gitRun(t, dir, "add", "--all")
+	gitRun(t, dir, "commit", "--quiet", "--no-gpg-sign", "--message=init")
+	gitRun(t, dir, "tag", "core/v0.10.2-alpha.2")
+
+	flags := flag.NewFlagSet("release", flag.ContinueOnError)
+	err = ReleaseCmd(dir, "v0.10.2-alpha.1", "", false, nil, nil, &releaseGuard{}, false, flags, nil).Run()
+	expected := "version already released: core has the higher v0.10.2-alpha.2. release v0.10.2 instead or use --force"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+	if status := gitRun(t, dir, "status", "--porcelain"); status != "" {
+		t.Errorf("release files written on error:\n%s", status)
+	}
+
+	// --force
+	err = ReleaseCmd(dir, "v0.10.2-alpha.1", "", false, nil, nil, nil, false, flags, nil).Run()
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if status := gitRun(t, dir, "status", "--porcelain"); status == "" {
+		t.Errorf("expected the forced release to be written")
+	}
+}
+
+func TestReleaseCmdReleasedOutsideGit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.CopyFS(dir, os.DirFS("./testdata/prev-release/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags := flag.NewFlagSet("release", flag.ContinueOnError)
+	err = ReleaseCmd(dir, "v0.10.2", "", true, nil, nil, &releaseGuard{}, false, flags, nil).Run()
+	if err == nil || !strings.Contains(err.Error(), "use --force to release anyway") {
+		t.Fatalf("expected the released versions error, got %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "cli", "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "v0.10.2\n") {
+		t.Errorf("release files written on error:\n%s", data)
+	}
+
+	// --force
+	err = ReleaseCmd(dir, "v0.10.2", "", true, nil, nil, nil, false, flags, nil).Run()
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/demula/mono/git"
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+const retractUsage = "" +
+	`Running on the root of your monorepo to retract a version of a module (by
+directory or module path) or of all of them:
+	mono retract --rationale="breaks the API" api "v0.1.1"
+	mono retract --rationale="corrupt go.sum" all "[v0.1.0,v0.1.2]"
+
+Specify the root of your monorepo when not in current directory :
+	mono retract --context="./testdata" --rationale="..." api "v0.1.1"
+
+Retracted versions must be tagged. Retractions only reach the proxy with a
+newer release, to release right after retracting:
+	mono retract --rationale="breaks the API" --release="v0.1.2" api "v0.1.1"
+
+As on release, versions already released or lower than the latest release are
+refused unless --force is given.
+
+You can skip writing any files by using --dry-run:
+	mono retract --dry-run --rationale="breaks the API" api "v0.1.1"
+
+The changes are printed as a unified diff instead, or side by side with
+--diff=side-by-side. Save them as a patch for "git apply" with:
+	mono retract --dry-run --patch-out="retract.patch" --rationale="..." api "v0.1.1"
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+var ErrUntaggedVersion = errors.New("untagged version")
+
+var retractCommand = &subcommand{
+	Name:         "retract",
+	Args:         "<module|all> <version|[low,high]>",
+	Summary:      "retract released versions of a module",
+	Usage:        retractUsage,
+	MinArgs:      2,
+	MaxArgs:      2,
+	MissingArgs:  "missing module and version arguments",
+	ArgsComplete: []completer{completeModules("all"), completeVersions},
+	FlagsComplete: map[string]completer{
+		"diff":    completeValues(diffUnified, diffSideBySide),
+		"release": completeVersions,
+	},
+	Flags: func(fs *flag.FlagSet) builder {
+		var (
+			rationale      = fs.String("rationale", "", "reason of the retraction, added as comment")
+			releaseVersion = fs.String("release", "", "release the given version right after retracting")
+			isDryRun       = fs.Bool("dry-run", false, "skip writing to files")
+			diffStyle      = fs.String("diff", diffUnified, "diff style of --dry-run: unified or side-by-side")
+			patchOut       = fs.String("patch-out", "", "write the --dry-run changes as a git patch to the given file")
+			isForce        = fs.Bool("force", false, "release versions already released or lower than the latest")
+		)
+		return func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+			interval, err := parseInterval(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("%w. %w", ErrInput, err)
+			}
+			if *rationale == "" {
+				return nil, fmt.Errorf("%w. missing --rationale flag", ErrInput)
+			}
+			if *releaseVersion != "" && !semver.IsValid(*releaseVersion) {
+				return nil, fmt.Errorf("%w. invalid release version provided", ErrInput)
+			}
+			if *releaseVersion != "" && semver.Compare(*releaseVersion, interval.High) <= 0 {
+				return nil, fmt.Errorf("%w. release version must be higher than the retracted ones", ErrInput)
+			}
+			var guard *releaseGuard
+			if !*isForce {
+				guard = &releaseGuard{}
+			} else if *releaseVersion == "" {
+				return nil, fmt.Errorf("%w. \"--force\" requires \"--release\"", ErrInput)
+			}
+			dryRun, err := parseDryRun(*isDryRun, *diffStyle, *patchOut)
+			if err != nil {
+				return nil, err
+			}
+			return RetractCmd(
+				g.ContextDir,
+				args[0],
+				interval,
+				*rationale,
+				*releaseVersion,
+				dryRun,
+				guard,
+				g.IsDebug,
+				flags,
+				args,
+			), nil
+		}
+	},
+}
+
+func RetractCmd(
+	contextDir string,
+	target string,
+	interval modfile.VersionInterval,
+	rationale string,
+	releaseVersion string,
+	dryRun *dryRun,
+	guard *releaseGuard,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "retract",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			prefix, err := git.Prefix(contextDir)
+			if err != nil {
+				return err
+			}
+			all, err := git.Tags(contextDir)
+			if err != nil {
+				return err
+			}
+			var tags []string
+			for _, t := range all {
+				if strings.HasPrefix(t, prefix) {
+					tags = append(tags, strings.TrimPrefix(t, prefix))
+				}
+			}
+			var base fs.FS = os.DirFS(contextDir)
+			if releaseVersion != "" {
+				base, err = releaseBase(contextDir, "", false)
+				if err != nil {
+					return err
+				}
+			}
+			// changes are only written once all of them are calculated
+			fsys := vfs.NewOverlay(base)
+			err = retract(fsys, tags, target, interval, rationale)
+			if err != nil {
+				if errors.Is(err, ErrNoModulesFound) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			if releaseVersion != "" && guard != nil {
+				ms, err := modules.All(fsys, ".")
+				if err != nil {
+					return fmt.Errorf("failed to fetch monorepo modules: %w", err)
+				}
+				released, err := guard.released(contextDir, ms)
+				if err != nil {
+					return err
+				}
+				err = checkVersion(ms, released, releaseVersion)
+				if err != nil {
+					return err
+				}
+			}
+			if releaseVersion != "" {
+				err = releaseWith(fsys, releaseVersion, siblingGoMods(contextDir), false)
+				if err != nil {
+					return err
+				}
+			}
+			if dryRun != nil {
+				return dryRun.preview(contextDir, fsys, os.Stdout)
+			}
+			return fsys.Commit(vfs.Dir(contextDir))
+		},
+	}
+}
+
+// retract adds the retract directive for interval to the go.mod file of the
+// target module ("all" for every module). tags are the repository tags the
+// retracted versions are checked against.
+func retract(fsys vfs.FS, tags []string, target string, interval modfile.VersionInterval, rationale string) error {
+	ms, err := modules.All(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return ErrNoModulesFound
+	}
+	if target != "all" {
+		ms = slices.DeleteFunc(ms, func(m *modules.Module) bool {
+			return m.FileName != target && m.Path() != target
+		})
+		if len(ms) == 0 {
+			return fmt.Errorf("%w. unknown module %q", ErrInput, target)
+		}
+	}
+	for _, m := range ms {
+		for _, v := range []string{interval.Low, interval.High} {
+			if !slices.Contains(tags, m.FileName+"/"+v) && !slices.Contains(tags, v) {
+				return fmt.Errorf("%w %s of %s. only tagged versions can be retracted",
+					ErrUntaggedVersion, v, m.Path())
+			}
+		}
+		if slices.ContainsFunc(m.File.Retract, func(r *modfile.Retract) bool {
+			return r.VersionInterval == interval
+		}) {
+			slog.Info("version already retracted", slog.String("module", m.Path()))
+			continue
+		}
+		err = m.File.AddRetract(interval, rationale)
+		if err != nil {
+			return fmt.Errorf("%w. %w", ErrInput, err)
+		}
+		// AddRetract only updates the syntax tree, parsing it back keeps the
+		// retractions in sync and validates the result
+		name := path.Join(m.Dir(), "go.mod")
+		data, err := m.File.Format()
+		if err != nil {
+			return err
+		}
+		m.File, err = modfile.Parse(name, data, nil)
+		if err != nil {
+			return fmt.Errorf("retracting produced an invalid %q: %w", name, err)
+		}
+		err = modules.UpdateGoMod(m)
+		if err != nil {
+			return err
+		}
+		slog.Info("version retracted",
+			slog.String("module", m.Path()),
+			slog.String("file", name),
+			slog.String("low", interval.Low),
+			slog.String("high", interval.High),
+		)
+	}
+	return nil
+}
+
+// parseInterval reads a single version or a "[low,high]" range.
+func parseInterval(s string) (modfile.VersionInterval, error) {
+	var vi modfile.VersionInterval
+	if inner, ok := strings.CutPrefix(s, "["); ok {
+		inner, ok = strings.CutSuffix(inner, "]")
+		low, high, found := strings.Cut(inner, ",")
+		if !ok || !found {
+			return vi, fmt.Errorf("invalid version range %q", s)
+		}
+		vi.Low, vi.High = strings.TrimSpace(low), strings.TrimSpace(high)
+	} else {
+		vi.Low, vi.High = s, s
+	}
+	for _, v := range []string{vi.Low, vi.High} {
+		if !semver.IsValid(v) || semver.Canonical(v) != v {
+			return vi, fmt.Errorf("invalid version %q", v)
+		}
+	}
+	if semver.Compare(vi.Low, vi.High) > 0 {
+		return vi, fmt.Errorf("invalid version range %q, low is higher than high", s)
+	}
+	return vi, nil
+}
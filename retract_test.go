@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/modfile"
+)
+
+func TestRetract(t *testing.T) {
+	t.Parallel()
+
+	tags := []string{"api/v0.1.0", "api/v0.1.1", "v0.1.0", "v0.1.2", "v2.0.0"}
+	tests := []struct {
+		name     string
+		target   string
+		interval modfile.VersionInterval
+		expected map[string]string
+		errMsg   string
+	}{
+		{
+			name:     "module by directory",
+			target:   "api",
+			interval: modfile.VersionInterval{Low: "v0.1.1", High: "v0.1.1"},
+			expected: map[string]string{
+				"api/go.mod": "module github.com/demula/mono-example/api\n\ngo 1.24.6\n\n" +
+					"// broken API\nretract v0.1.1\n",
+			},
+		},
+		{
+			name:     "module by path",
+			target:   "github.com/demula/mono-example/core",
+			interval: modfile.VersionInterval{Low: "v0.1.0", High: "v0.1.2"},
+			expected: map[string]string{
+				"core/go.mod": "module github.com/demula/mono-example/core\n\ngo 1.24.6\n\n" +
+					"require github.com/demula/mono-example/api v1.0.0-rc.1\n\n" +
+					"// broken API\nretract [v0.1.0, v0.1.2]\n",
+			},
+		},
+		{
+			name:     "all modules",
+			target:   "all",
+			interval: modfile.VersionInterval{Low: "v0.1.0", High: "v0.1.0"},
+			expected: map[string]string{
+				"api/go.mod":    "// broken API\nretract v0.1.0\n",
+				"cli/go.mod":    "// broken API\nretract v0.1.0\n",
+				"core/go.mod":   "// broken API\nretract v0.1.0\n",
+				"server/go.mod": "// broken API\nretract v0.1.0\n",
+			},
+		},
+		{
+			name:     "untagged version",
+			target:   "core",
+			interval: modfile.VersionInterval{Low: "v0.1.1", High: "v0.1.1"},
+			errMsg:   "untagged version v0.1.1 of github.com/demula/mono-example/core. only tagged versions can be retracted",
+		},
+		{
+			name:     "unknown module",
+			target:   "web",
+			interval: modfile.VersionInterval{Low: "v0.1.0", High: "v0.1.0"},
+			errMsg:   "input error. unknown module \"web\"",
+		},
+		{
+			name:     "major version of another module path",
+			target:   "api",
+			interval: modfile.VersionInterval{Low: "v2.0.0", High: "v2.0.0"},
+			errMsg: "input error. version \"v2.0.0\" invalid: " +
+				"should be v2.0.0+incompatible (or module github.com/demula/mono-example/api/v2)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fsys := vfs.NewOverlay(os.DirFS("./testdata/golden/"))
+			err := retract(fsys, tags, tt.target, tt.interval, "broken API")
+			if tt.errMsg != "" {
+				if err == nil || err.Error() != tt.errMsg {
+					t.Fatalf("expected error %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			// retracting again must not duplicate the directive
+			err = retract(fsys, tags, tt.target, tt.interval, "broken API")
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			changes := fsys.Changes()
+			if len(changes) != len(tt.expected) {
+				t.Errorf("expected %d changed files, got %v", len(tt.expected), changes)
+			}
+			for name, expected := range tt.expected {
+				data, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					t.Fatalf("unexpected error %q", err)
+				}
+				if !strings.HasSuffix(string(data), expected) {
+					t.Errorf("expected %q to end with:\n%s\ngot:\n%s", name, expected, data)
+				}
+				f, err := modfile.Parse(name, data, nil)
+				if err != nil {
+					t.Fatalf("invalid %q: %s", name, err)
+				}
+				if len(f.Retract) != 1 || f.Retract[0].VersionInterval != tt.interval {
+					t.Errorf("expected %q to retract %v once, got %+v", name, tt.interval, f.Retract)
+				}
+			}
+		})
+	}
+}
+
+func TestRetractAndRelease(t *testing.T) {
+	t.Parallel()
+
+	fsys := vfs.NewOverlay(os.DirFS("./testdata/golden/"))
+	interval := modfile.VersionInterval{Low: "v1.0.0-rc.1", High: "v1.0.0-rc.1"}
+	err := retract(fsys, []string{"v1.0.0-rc.1"}, "api", interval, "corrupt go.sum")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	err = release(fsys, "v1.0.0-rc.2", false)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	data, err := fs.ReadFile(fsys, "api/go.mod")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if !strings.Contains(string(data), "// corrupt go.sum\nretract v1.0.0-rc.1\n") {
+		t.Errorf("release dropped the retraction:\n%s", data)
+	}
+	data, err = fs.ReadFile(fsys, "core/go.mod")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if !strings.Contains(string(data), "github.com/demula/mono-example/api v1.0.0-rc.2") {
+		t.Errorf("release did not require the new version:\n%s", data)
+	}
+}
+
+func TestRetractCmdReleased(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	err := os.CopyFS(dir, os.DirFS("./testdata/prev-release/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, dir, "init", "--quiet")
+	gitRun(t, dir, "config", "user.name", "mono")
+	gitRun(t, dir, "config", "user.email", "mono@example.com")
+	gitRun(t, dir, "add", "--all")
+	gitRun(t, dir, "commit", "--quiet", "--no-gpg-sign", "--message=init")
+	gitRun(t, dir, "tag", "v0.10.2-alpha.2")
+	gitRun(t, dir, "tag", "core/v0.11.0")
+
+	interval := modfile.VersionInterval{Low: "v0.10.2-alpha.2", High: "v0.10.2-alpha.2"}
+	flags := flag.NewFlagSet("retract", flag.ContinueOnError)
+	err = RetractCmd(dir, "api", interval, "corrupt go.sum", "v0.10.2", nil, &releaseGuard{}, false, flags, nil).Run()
+	expected := "version already released: core has the higher v0.11.0. release v0.11.1 instead or use --force"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+	if status := gitRun(t, dir, "status", "--porcelain"); status != "" {
+		t.Errorf("retraction written on error:\n%s", status)
+	}
+
+	// --force
+	err = RetractCmd(dir, "api", interval, "corrupt go.sum", "v0.10.2", nil, nil, false, flags, nil).Run()
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "api", "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "retract v0.10.2-alpha.2\n") {
+		t.Errorf("expected the forced retraction to be written, got:\n%s", data)
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		arg      string
+		expected modfile.VersionInterval
+		errMsg   string
+	}{
+		{arg: "v0.1.0", expected: modfile.VersionInterval{Low: "v0.1.0", High: "v0.1.0"}},
+		{arg: "[v0.1.0,v0.2.0]", expected: modfile.VersionInterval{Low: "v0.1.0", High: "v0.2.0"}},
+		{arg: "[v0.1.0, v0.2.0-rc.1]", expected: modfile.VersionInterval{Low: "v0.1.0", High: "v0.2.0-rc.1"}},
+		{arg: "v0.1", errMsg: "invalid version \"v0.1\""},
+		{arg: "[v0.1.0]", errMsg: "invalid version range \"[v0.1.0]\""},
+		{arg: "[v0.1.0,v0.2.0", errMsg: "invalid version range \"[v0.1.0,v0.2.0\""},
+		{arg: "[v0.2.0,v0.1.0]", errMsg: "invalid version range \"[v0.2.0,v0.1.0]\", low is higher than high"},
+	}
+	for _, tt := range tests {
+		actual, err := parseInterval(tt.arg)
+		if tt.errMsg != "" {
+			if err == nil || err.Error() != tt.errMsg {
+				t.Errorf("expected error %q, got %v", tt.errMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error %q", err)
+			continue
+		}
+		if actual != tt.expected {
+			t.Errorf("expected %v, got %v", tt.expected, actual)
+		}
+	}
+}
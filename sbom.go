@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/demula/mono/license"
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+const sbomUsage = "" +
+	`Running on the root of your monorepo to write the SBOM of every module at the
+released version (run it after 'mono release'):
+	mono sbom "v0.1.0-alpha.1"
+
+Specify the root of your monorepo when not in current directory :
+	mono sbom --context="./testdata" "v0.1.0-alpha.1"
+
+SBOMs are written as CycloneDX (default) or SPDX JSON documents to a directory,
+one per module named after the module directory:
+	mono sbom --format=spdx-json --output-dir="./dist/sbom" "v0.1.0-alpha.1"
+
+The dependencies of external modules are read from the module cache, run
+'go mod download' first.
+
+Only the files tracked by git are hashed, as on release. Hash every file on
+disk with:
+	mono sbom --all-files "v0.1.0-alpha.1"
+
+Set SOURCE_DATE_EPOCH to get reproducible creation timestamps.
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+var sbomFormats = []string{"cyclonedx-json", "spdx-json"}
+
+var sbomCommand = &subcommand{
+	Name:          "sbom",
+	Args:          "<version>",
+	Summary:       "write a software bill of materials per module",
+	Usage:         sbomUsage,
+	MinArgs:       1,
+	MaxArgs:       1,
+	MissingArgs:   "missing version argument",
+	ArgsComplete:  []completer{completeVersions},
+	FlagsComplete: map[string]completer{"format": completeValues(sbomFormats...)},
+	Flags: func(fs *flag.FlagSet) builder {
+		var (
+			format      = fs.String("format", "cyclonedx-json", "SBOM format: "+strings.Join(sbomFormats, ", "))
+			outputDir   = fs.String("output-dir", "sbom", "directory to write the SBOM files to")
+			modCacheDir = fs.String("modcache", defaultModCache(), "go module cache directory")
+			isAllFiles  = fs.Bool("all-files", false, "hash untracked and ignored files too")
+		)
+		return func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+			if !slices.Contains(sbomFormats, *format) {
+				return nil, fmt.Errorf("%w. unknown format %q", ErrInput, *format)
+			}
+			version := args[0]
+			if !semver.IsValid(version) {
+				return nil, fmt.Errorf("%w. invalid version provided", ErrInput)
+			}
+			return SBOMCmd(g.ContextDir, version, *format, *outputDir, *modCacheDir, *isAllFiles, g.IsDebug, flags, args), nil
+		}
+	},
+}
+
+func SBOMCmd(
+	contextDir string,
+	version string,
+	format string,
+	outputDir string,
+	modCacheDir string,
+	isAllFiles bool,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "sbom",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			base, err := releaseBase(contextDir, "", isAllFiles)
+			if err != nil {
+				return err
+			}
+			err = os.MkdirAll(outputDir, 0755)
+			if err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+			now, err := sourceDate()
+			if err != nil {
+				return err
+			}
+			err = sbom(vfs.NewOverlay(base), os.DirFS(modCacheDir), vfs.Dir(outputDir), format, version, now)
+			if err != nil {
+				if errors.Is(err, ErrNoModulesFound) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// sourceDate returns the SOURCE_DATE_EPOCH time when set or the current time.
+func sourceDate() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now().UTC(), nil
+	}
+	sec, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w. invalid SOURCE_DATE_EPOCH %q", ErrInput, epoch)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// component is a module listed on a SBOM.
+type component struct {
+	Path    string
+	Version string
+	// Hash is the go.sum h1 hash of the module zip.
+	Hash    string
+	License string
+	Deps    []module.Version
+}
+
+func (c *component) purl() string {
+	return "pkg:golang/" + c.Path + "@" + c.Version
+}
+
+// hashProperty names the h1 hash on the SBOMs. The h1 hash is a digest of the
+// module file list and not of any file, so it is no SBOM checksum.
+const hashProperty = "mono:go.sum:h1"
+
+// sbom writes the SBOM of every monorepo module at version into w.
+func sbom(fsys vfs.FS, modCache fs.FS, w vfs.Writer, format, version string, now time.Time) error {
+	ms, err := modules.All(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return ErrNoModulesFound
+	}
+	entries, err := licenses(fsys, modCache, modules.LicenseFiles, nil)
+	if err != nil {
+		return err
+	}
+	licenseOf := func(m *modules.Module, p string) string {
+		i := slices.IndexFunc(entries, func(e licenseEntry) bool {
+			return e.Module == m.Path() && e.Path == p
+		})
+		if i < 0 || entries[i].License == license.NoAssertion {
+			return ""
+		}
+		return entries[i].License
+	}
+
+	for _, m := range ms {
+		m.File.Module.Mod.Version = version
+		hash, err := modules.DirHash(m)
+		if err != nil {
+			return fmt.Errorf("failed to hash %q: %w", m.Dir(), err)
+		}
+		root := &component{
+			Path:    m.Path(),
+			Version: version,
+			Hash:    hash,
+			License: licenseOf(m, m.Path()),
+			Deps:    requires(m),
+		}
+		var comps []*component
+		for _, r := range root.Deps {
+			var hash string
+			if sums := m.Sums[r]; len(sums) > 0 {
+				hash = sums[0]
+			}
+			comps = append(comps, &component{
+				Path:    r.Path,
+				Version: r.Version,
+				Hash:    hash,
+				License: licenseOf(m, r.Path),
+			})
+		}
+		err = dependencyEdges(m, ms, modCache, comps)
+		if err != nil {
+			return err
+		}
+
+		var (
+			doc  any
+			name string
+		)
+		switch format {
+		case "spdx-json":
+			doc = spdxDocument(root, comps, now)
+			name = m.FileName + ".spdx.json"
+		default:
+			doc = cycloneDXDocument(root, comps, now)
+			name = m.FileName + ".cdx.json"
+		}
+		data := &bytes.Buffer{}
+		enc := json.NewEncoder(data)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(doc)
+		if err != nil {
+			return err
+		}
+		err = w.WriteFile(name, data.Bytes(), 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write %q SBOM: %w", m.Dir(), err)
+		}
+		slog.Info("module sbom written",
+			slog.String("module", m.Path()),
+			slog.String("file", name),
+		)
+	}
+	return nil
+}
+
+// requires returns the requirements of the module go.mod file with
+// replacements applied. Local replacements are left out.
+func requires(m *modules.Module) []module.Version {
+	var reqs []module.Version
+	for _, r := range m.File.Require {
+		mv := replaced(m, r.Mod)
+		if mv.Version == "" {
+			continue
+		}
+		reqs = append(reqs, mv)
+	}
+	return reqs
+}
+
+// dependencyEdges sets the dependencies of the components required by m from
+// their go.mod files, the current one for siblings and the one in modCache for
+// external modules. Requirements point to the versions m selects and the ones
+// out of its module graph are left out.
+func dependencyEdges(m *modules.Module, ms []*modules.Module, modCache fs.FS, comps []*component) error {
+	// selected maps the required paths, before replacements, to components
+	selected := make(map[string]*component, len(comps))
+	for _, r := range m.File.Require {
+		mv := replaced(m, r.Mod)
+		for _, c := range comps {
+			if c.Path == mv.Path && c.Version == mv.Version {
+				selected[r.Mod.Path] = c
+			}
+		}
+	}
+	for _, c := range comps {
+		var f *modfile.File
+		if i := slices.IndexFunc(ms, func(s *modules.Module) bool { return s.Path() == c.Path }); i >= 0 {
+			f = ms[i].File
+		} else {
+			var err error
+			f, err = cachedGoMod(modCache, module.Version{Path: c.Path, Version: c.Version})
+			if err != nil {
+				return fmt.Errorf("failed to read %s@%s go.mod: %w", c.Path, c.Version, err)
+			}
+		}
+		if f == nil {
+			continue
+		}
+		for _, r := range f.Require {
+			if d := selected[r.Mod.Path]; d != nil && d != c {
+				c.Deps = append(c.Deps, module.Version{Path: d.Path, Version: d.Version})
+			}
+		}
+	}
+	return nil
+}
+
+// cachedGoMod reads the go.mod file of mv from the module cache, nil when it
+// is not downloaded.
+func cachedGoMod(modCache fs.FS, mv module.Version) (*modfile.File, error) {
+	escPath, err := module.EscapePath(mv.Path)
+	if err != nil {
+		return nil, err
+	}
+	escVersion, err := module.EscapeVersion(mv.Version)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{
+		path.Join("cache/download", escPath, "@v", escVersion+".mod"),
+		path.Join(escPath+"@"+escVersion, "go.mod"),
+	} {
+		data, err := fs.ReadFile(modCache, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return modfile.ParseLax(name, data, nil)
+	}
+	return nil, nil
+}
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Type       string        `json:"type"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Licenses   []cdxLicense  `json:"licenses,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func cycloneDXDocument(root *component, comps []*component, now time.Time) *cdxBOM {
+	toCDX := func(c *component) cdxComponent {
+		cc := cdxComponent{
+			BOMRef:  c.purl(),
+			Type:    "library",
+			Name:    c.Path,
+			Version: c.Version,
+			PURL:    c.purl(),
+		}
+		if c.License != "" {
+			cc.Licenses = []cdxLicense{{Expression: c.License}}
+		}
+		if c.Hash != "" {
+			cc.Properties = []cdxProperty{{Name: hashProperty, Value: c.Hash}}
+		}
+		return cc
+	}
+	refs := map[string]bool{root.purl(): true}
+	for _, c := range comps {
+		refs[c.purl()] = true
+	}
+	dependency := func(c *component) cdxDependency {
+		d := cdxDependency{Ref: c.purl(), DependsOn: []string{}}
+		for _, r := range c.Deps {
+			ref := (&component{Path: r.Path, Version: r.Version}).purl()
+			if refs[ref] {
+				d.DependsOn = append(d.DependsOn, ref)
+			}
+		}
+		return d
+	}
+	bom := &cdxBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cdxMetadata{
+			Timestamp: now.Format(time.RFC3339),
+			Tools: cdxTools{Components: []cdxComponent{
+				{Type: "application", Name: "mono", Version: Version},
+			}},
+			Component: toCDX(root),
+		},
+		Components:   []cdxComponent{},
+		Dependencies: []cdxDependency{dependency(root)},
+	}
+	for _, c := range comps {
+		bom.Components = append(bom.Components, toCDX(c))
+		if len(c.Deps) > 0 {
+			bom.Dependencies = append(bom.Dependencies, dependency(c))
+		}
+	}
+	return bom
+}
+
+type spdxDoc struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+	Annotations      []spdxAnnotation  `json:"annotations,omitempty"`
+}
+
+type spdxAnnotation struct {
+	AnnotationDate string `json:"annotationDate"`
+	AnnotationType string `json:"annotationType"`
+	Annotator      string `json:"annotator"`
+	Comment        string `json:"comment"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func spdxDocument(root *component, comps []*component, now time.Time) *spdxDoc {
+	ids := map[string]string{}
+	toSPDX := func(c *component) spdxPackage {
+		id := "SPDXRef-Package-" + strconv.Itoa(len(ids))
+		ids[c.purl()] = id
+		declared := c.License
+		if declared == "" {
+			declared = license.NoAssertion
+		}
+		p := spdxPackage{
+			SPDXID:           id,
+			Name:             c.Path,
+			VersionInfo:      c.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: license.NoAssertion,
+			LicenseDeclared:  declared,
+			CopyrightText:    "NOASSERTION",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  c.purl(),
+			}},
+		}
+		if c.Hash != "" {
+			p.Annotations = []spdxAnnotation{{
+				AnnotationDate: now.Format(time.RFC3339),
+				AnnotationType: "OTHER",
+				Annotator:      "Tool: mono-" + Version,
+				Comment:        hashProperty + " " + c.Hash,
+			}}
+		}
+		return p
+	}
+	doc := &spdxDoc{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              root.Path + "@" + root.Version,
+		DocumentNamespace: "https://" + root.Path + "/sbom/" + root.Version + ".spdx.json",
+		CreationInfo: spdxCreationInfo{
+			Created:  now.Format(time.RFC3339),
+			Creators: []string{"Tool: mono-" + Version},
+		},
+		Packages: []spdxPackage{toSPDX(root)},
+	}
+	for _, c := range comps {
+		doc.Packages = append(doc.Packages, toSPDX(c))
+	}
+	doc.Relationships = append(doc.Relationships, spdxRelationship{
+		SPDXElementID:      "SPDXRef-DOCUMENT",
+		RelationshipType:   "DESCRIBES",
+		RelatedSPDXElement: ids[root.purl()],
+	})
+	for _, c := range append([]*component{root}, comps...) {
+		for _, r := range c.Deps {
+			dep, ok := ids[(&component{Path: r.Path, Version: r.Version}).purl()]
+			if !ok {
+				continue
+			}
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      ids[c.purl()],
+				RelationshipType:   "DEPENDS_ON",
+				RelatedSPDXElement: dep,
+			})
+		}
+	}
+	return doc
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/module"
+)
+
+func TestSBOM(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		context  string
+		format   string
+		expected string
+		errMsg   string
+	}{
+		{
+			name:     "cyclonedx",
+			context:  "./testdata/licensed/",
+			format:   "cyclonedx-json",
+			expected: "./testdata/sbom/cyclonedx-json/",
+		},
+		{
+			name:     "spdx",
+			context:  "./testdata/licensed/",
+			format:   "spdx-json",
+			expected: "./testdata/sbom/spdx-json/",
+		},
+		{
+			name:    "no modules found",
+			context: "./testdata/empty/",
+			format:  "cyclonedx-json",
+			errMsg:  "no modules found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			out := vfs.NewOverlay(fstest.MapFS{})
+			err := sbom(
+				vfs.Dir(tt.context),
+				os.DirFS("./testdata/modcache/"),
+				out,
+				tt.format,
+				"v0.2.0",
+				time.Unix(1760000000, 0).UTC(),
+			)
+			if tt.errMsg != "" {
+				if err == nil || err.Error() != tt.errMsg {
+					t.Fatalf("expected error %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			assertAgainstGoldenTemplate(t, out, tt.expected)
+		})
+	}
+}
+
+func TestDependencyEdges(t *testing.T) {
+	t.Parallel()
+
+	ms, err := modules.All(vfs.Dir("./testdata/licensed/"), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	core := pickModule(ms, "core")
+	var comps []*component
+	for _, r := range requires(core) {
+		comps = append(comps, &component{Path: r.Path, Version: r.Version})
+	}
+	err = dependencyEdges(core, ms, os.DirFS("./testdata/modcache/"), comps)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	// Copyleft requires dep v0.9.0, core selects v1.0.0, and a module out
+	// of the graph. missing is not downloaded.
+	expected := map[string][]module.Version{
+		"example.com/Copyleft": {{Path: "example.com/dep", Version: "v1.0.0"}},
+		"example.com/mono/api": {
+			{Path: "example.com/dep", Version: "v1.0.0"},
+			{Path: "example.com/missing", Version: "v0.1.0"},
+		},
+		"example.com/dep":     {{Path: "example.com/missing", Version: "v0.1.0"}},
+		"example.com/missing": nil,
+	}
+	for _, c := range comps {
+		if !slices.Equal(c.Deps, expected[c.Path]) {
+			t.Errorf("expected %s dependencies %v, got %v", c.Path, expected[c.Path], c.Deps)
+		}
+	}
+}
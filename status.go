@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/demula/mono/git"
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/mono"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/semver"
+)
+
+const statusUsage = "" +
+	`Running on the root of your monorepo to show the release state of every
+module: its latest tag, the commits since then, its sibling requirements, if
+its go.sum hashes match the current tree and its uncommitted files:
+	mono status
+
+Specify the root of your monorepo when not in current directory :
+	mono status --context="./testdata"
+
+The state can be written as a table (default) or json:
+	mono status --output=json
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+var statusOutputs = []string{"table", "json"}
+
+// moduleStatus is the release state of a module.
+type moduleStatus struct {
+	Path string `json:"path"`
+	Dir  string `json:"dir"`
+	// LatestTag is empty for modules never released.
+	LatestTag string `json:"latestTag,omitempty"`
+	// Commits touching the module since LatestTag, or ever without one.
+	Commits   int              `json:"commits"`
+	Requires  []siblingRequire `json:"requires,omitempty"`
+	SumsMatch bool             `json:"sumsMatch"`
+	Dirty     []string         `json:"dirty,omitempty"`
+}
+
+// siblingRequire is the requirement of a monorepo module.
+type siblingRequire struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	// Latest is the latest tag version of the sibling, if any.
+	Latest   string `json:"latest,omitempty"`
+	UpToDate bool   `json:"upToDate"`
+}
+
+var statusCommand = &subcommand{
+	Name:          "status",
+	Summary:       "show the release state of every module",
+	Usage:         statusUsage,
+	FlagsComplete: map[string]completer{"output": completeValues(statusOutputs...)},
+	Flags: func(fs *flag.FlagSet) builder {
+		output := fs.String("output", "table", "output format: "+strings.Join(statusOutputs, ", "))
+		return func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+			if !slices.Contains(statusOutputs, *output) {
+				return nil, fmt.Errorf("%w. unknown output %q", ErrInput, *output)
+			}
+			return StatusCmd(g.ContextDir, *output, g.IsDebug, flags, args), nil
+		}
+	},
+}
+
+func StatusCmd(
+	contextDir string,
+	output string,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "status",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			h, err := gitHistory(contextDir)
+			if err != nil {
+				return err
+			}
+			dirty, err := git.Dirty(contextDir)
+			if err != nil {
+				return fmt.Errorf("failed to check for uncommitted changes: %w", err)
+			}
+			// hashes are checked as a release would calculate them
+			base, err := releaseBase(contextDir, "", false)
+			if err != nil {
+				return err
+			}
+			ss, err := status(vfs.NewOverlay(base), h, dirty)
+			if err != nil {
+				if errors.Is(err, ErrNoModulesFound) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			return writeStatus(os.Stdout, output, ss)
+		},
+	}
+}
+
+// status returns the release state of every module in fsys. dirty are the
+// uncommitted files of the monorepo.
+func status(fsys vfs.FS, h history, dirty []string) ([]moduleStatus, error) {
+	ms, err := modules.All(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, ErrNoModulesFound
+	}
+	ws, err := mono.Load(fsys, nil)
+	if err != nil {
+		return nil, err
+	}
+	var mismatches []mono.Mismatch
+	verr := &mono.VerifyError{}
+	err = ws.Verify()
+	if errors.As(err, &verr) {
+		mismatches = verr.Mismatches
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to check go.sum hashes: %w", err)
+	}
+	latest := make(map[string]string)
+	for _, m := range ms {
+		latest[m.Path()] = lastTag(h.Tags, m.FileName)
+	}
+
+	ss := make([]moduleStatus, 0, len(ms))
+	for _, m := range ms {
+		s := moduleStatus{
+			Path:      m.Path(),
+			Dir:       m.Dir(),
+			LatestTag: latest[m.Path()],
+			SumsMatch: !slices.ContainsFunc(mismatches, func(mm mono.Mismatch) bool {
+				return mm.Module == m.Path()
+			}),
+		}
+		s.Commits, err = h.Commits(s.LatestTag, m.Dir())
+		if err != nil {
+			return nil, fmt.Errorf("failed to count %q commits: %w", m.Dir(), err)
+		}
+		for _, r := range m.File.Require {
+			tag, ok := latest[r.Mod.Path]
+			if !ok {
+				continue
+			}
+			req := siblingRequire{Path: r.Mod.Path, Version: r.Mod.Version, UpToDate: true}
+			if tag != "" {
+				req.Latest = tagVersion(tag)
+				req.UpToDate = semver.Compare(r.Mod.Version, req.Latest) >= 0
+			}
+			s.Requires = append(s.Requires, req)
+		}
+		for _, name := range dirty {
+			if owner(ms, name) == m {
+				s.Dirty = append(s.Dirty, name)
+			}
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+// owner returns the module holding the file name, the one with the longest
+// directory as modules can be nested.
+func owner(ms []*modules.Module, name string) *modules.Module {
+	var found *modules.Module
+	for _, m := range ms {
+		if !strings.HasPrefix(name, m.Dir()+"/") {
+			continue
+		}
+		if found == nil || len(m.Dir()) > len(found.Dir()) {
+			found = m
+		}
+	}
+	return found
+}
+
+func writeStatus(w io.Writer, output string, ss []moduleStatus) error {
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ss)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	_, err := fmt.Fprintln(tw, "MODULE\tDIR\tTAG\tCOMMITS\tREQUIRES\tSUMS\tDIRTY")
+	if err != nil {
+		return err
+	}
+	for _, s := range ss {
+		tag := s.LatestTag
+		if tag == "" {
+			tag = "-"
+		}
+		var requires []string
+		for _, r := range s.Requires {
+			req := r.Path + "@" + r.Version
+			if !r.UpToDate {
+				req += " (latest " + r.Latest + ")"
+			}
+			requires = append(requires, req)
+		}
+		if len(requires) == 0 {
+			requires = []string{"-"}
+		}
+		sums := "ok"
+		if !s.SumsMatch {
+			sums = "mismatch"
+		}
+		_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%d\n",
+			s.Path, s.Dir, tag, s.Commits, strings.Join(requires, ", "), sums, len(s.Dirty))
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/demula/mono/vfs"
+)
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	const (
+		api  = "github.com/demula/mono-example/api"
+		cli  = "github.com/demula/mono-example/cli"
+		core = "github.com/demula/mono-example/core"
+	)
+	tests := []struct {
+		name     string
+		dir      string
+		tags     []string
+		dirty    []string
+		expected []moduleStatus
+	}{
+		{
+			name:  "released",
+			dir:   "./testdata/prev-release/",
+			tags:  []string{"v0.10.2-alpha.2"},
+			dirty: []string{"api/main.go", "go.work"},
+			expected: []moduleStatus{
+				{Path: api, Dir: "api", LatestTag: "v0.10.2-alpha.2", Commits: 1, SumsMatch: true,
+					Dirty: []string{"api/main.go"}},
+				{Path: cli, Dir: "cli", LatestTag: "v0.10.2-alpha.2", Commits: 2, SumsMatch: true,
+					Requires: []siblingRequire{
+						{Path: core, Version: "v0.10.2-alpha.2", Latest: "v0.10.2-alpha.2", UpToDate: true},
+						{Path: api, Version: "v0.10.2-alpha.2", Latest: "v0.10.2-alpha.2", UpToDate: true},
+					}},
+				{Path: core, Dir: "core", LatestTag: "v0.10.2-alpha.2", Commits: 0, SumsMatch: true,
+					Requires: []siblingRequire{
+						{Path: api, Version: "v0.10.2-alpha.2", Latest: "v0.10.2-alpha.2", UpToDate: true},
+					}},
+			},
+		},
+		{
+			name: "outdated requirements and hashes",
+			dir:  "./testdata/golden/",
+			tags: []string{"api/v1.1.0", "v1.0.0-rc.1"},
+			expected: []moduleStatus{
+				{Path: api, Dir: "api", LatestTag: "api/v1.1.0", Commits: 1, SumsMatch: true},
+				{Path: cli, Dir: "cli", LatestTag: "v1.0.0-rc.1", Commits: 2,
+					Requires: []siblingRequire{
+						{Path: core, Version: "v1.0.0-rc.1", Latest: "v1.0.0-rc.1", UpToDate: true},
+						{Path: api, Version: "v1.0.0-rc.1", Latest: "v1.1.0"},
+					}},
+				{Path: core, Dir: "core", LatestTag: "v1.0.0-rc.1", Commits: 0,
+					Requires: []siblingRequire{
+						{Path: api, Version: "v1.0.0-rc.1", Latest: "v1.1.0"},
+					}},
+			},
+		},
+		{
+			name: "never released",
+			dir:  "./testdata/prev-release/",
+			expected: []moduleStatus{
+				{Path: api, Dir: "api", Commits: 1, SumsMatch: true},
+				{Path: cli, Dir: "cli", Commits: 2, SumsMatch: true,
+					Requires: []siblingRequire{
+						{Path: core, Version: "v0.10.2-alpha.2", UpToDate: true},
+						{Path: api, Version: "v0.10.2-alpha.2", UpToDate: true},
+					}},
+				{Path: core, Dir: "core", Commits: 0, SumsMatch: true,
+					Requires: []siblingRequire{
+						{Path: api, Version: "v0.10.2-alpha.2", UpToDate: true},
+					}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := history{
+				Tags: test.tags,
+				Commits: func(rev, dir string) (int, error) {
+					return map[string]int{"api": 1, "cli": 2}[dir], nil
+				},
+			}
+			ss, err := status(vfs.NewOverlay(os.DirFS(test.dir)), h, test.dirty)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			// the server module adds nothing new to check
+			ss = ss[:len(test.expected)]
+			if !reflect.DeepEqual(ss, test.expected) {
+				t.Errorf("expected:\n%+v\ngot:\n%+v", test.expected, ss)
+			}
+		})
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	t.Parallel()
+
+	ss := []moduleStatus{
+		{Path: "example.com/mono/api", Dir: "api", LatestTag: "api/v1.1.0", Commits: 3, SumsMatch: true,
+			Dirty: []string{"api/api.go"}},
+		{Path: "example.com/mono/core", Dir: "core", Commits: 12,
+			Requires: []siblingRequire{
+				{Path: "example.com/mono/api", Version: "v1.0.0", Latest: "v1.1.0"},
+			}},
+	}
+	tests := []struct {
+		output   string
+		expected string
+	}{
+		{
+			output: "table",
+			expected: "" +
+				"MODULE                 DIR   TAG         COMMITS  REQUIRES                                     SUMS      DIRTY\n" +
+				"example.com/mono/api   api   api/v1.1.0  3        -                                            ok        1\n" +
+				"example.com/mono/core  core  -           12       example.com/mono/api@v1.0.0 (latest v1.1.0)  mismatch  0\n",
+		},
+		{
+			output: "json",
+			expected: `[
+  {
+    "path": "example.com/mono/api",
+    "dir": "api",
+    "latestTag": "api/v1.1.0",
+    "commits": 3,
+    "sumsMatch": true,
+    "dirty": [
+      "api/api.go"
+    ]
+  },
+  {
+    "path": "example.com/mono/core",
+    "dir": "core",
+    "commits": 12,
+    "requires": [
+      {
+        "path": "example.com/mono/api",
+        "version": "v1.0.0",
+        "latest": "v1.1.0",
+        "upToDate": false
+      }
+    ],
+    "sumsMatch": false
+  }
+]
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.output, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			err := writeStatus(&out, test.output, ss)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if out.String() != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, out.String())
+			}
+		})
+	}
+}
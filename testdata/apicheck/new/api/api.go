@@ -0,0 +1,31 @@
+package api
+
+import "errors"
+
+const Version = 2
+
+var ErrNotFound = errors.New("not found")
+
+type Hello struct {
+	Who string
+	Age int
+}
+
+type Greeter interface {
+	Greet(h Hello) string
+	Close() error
+}
+
+type Client struct{}
+
+func (c *Client) Do(h Hello) error {
+	return nil
+}
+
+func (c *Client) Close() error {
+	return nil
+}
+
+func Say(h Hello, lang string) string {
+	return "Hello " + h.Who
+}
@@ -0,0 +1,3 @@
+package extra
+
+func Extra() {}
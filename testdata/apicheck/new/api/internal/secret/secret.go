@@ -0,0 +1,5 @@
+package secret
+
+func Key(seed int) string {
+	return "new"
+}
@@ -0,0 +1,7 @@
+package sub
+
+type Option func(*Options)
+
+type Options struct {
+	Verbose bool
+}
@@ -0,0 +1,19 @@
+package core
+
+import (
+	"example.com/dep"
+	"example.com/mono/api"
+)
+
+func Say(it api.Hello) string {
+	return api.Say(it, "en")
+}
+
+func Fetch(c dep.Client) (dep.Result, error) {
+	return c.Fetch()
+}
+
+type Sayer interface {
+	Say(it api.Hello) string
+	sealed()
+}
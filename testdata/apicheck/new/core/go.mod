@@ -0,0 +1,8 @@
+module example.com/mono/core
+
+go 1.25
+
+require (
+	example.com/dep v1.0.0
+	example.com/mono/api v0.1.0
+)
@@ -0,0 +1,28 @@
+package api
+
+import "errors"
+
+const Version = 1
+
+var ErrNotFound = errors.New("not found")
+
+type Hello struct {
+	Who  string
+	Lang string
+}
+
+type Greeter interface {
+	Greet(h Hello) string
+}
+
+type Client struct{}
+
+func (c *Client) Do(h Hello) error {
+	return nil
+}
+
+func Say(h Hello) string {
+	return "Hello " + h.Who
+}
+
+func Removed() {}
@@ -0,0 +1,5 @@
+package secret
+
+func Key() string {
+	return "old"
+}
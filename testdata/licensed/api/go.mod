@@ -0,0 +1,8 @@
+module example.com/mono/api
+
+go 1.24.6
+
+require (
+	example.com/dep v1.0.0
+	example.com/missing v0.1.0 // indirect
+)
@@ -0,0 +1,13 @@
+module example.com/mono/core
+
+go 1.24.6
+
+require (
+	example.com/Copyleft v1.2.0
+	example.com/mono/api v0.1.0
+)
+
+require (
+	example.com/dep v1.0.0 // indirect
+	example.com/missing v0.1.0 // indirect
+)
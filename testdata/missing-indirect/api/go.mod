@@ -0,0 +1,3 @@
+module github.com/demula/mono-example/api
+
+go 1.24.6
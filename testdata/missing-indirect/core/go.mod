@@ -0,0 +1,5 @@
+module github.com/demula/mono-example/core
+
+go 1.24.6
+
+require github.com/demula/mono-example/api v0.10.2-alpha.2
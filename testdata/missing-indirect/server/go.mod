@@ -0,0 +1,8 @@
+module github.com/demula/mono-example/server
+
+go 1.24.6
+
+require (
+	github.com/demula/mono-example/api v0.10.2-alpha.2
+	github.com/demula/mono-example/core v0.10.2-alpha.2
+)
@@ -0,0 +1,8 @@
+module example.com/Copyleft
+
+go 1.21
+
+require (
+	example.com/dep v0.9.0
+	example.com/unrelated v1.0.0
+)
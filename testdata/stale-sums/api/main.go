@@ -0,0 +1,9 @@
+package api
+
+type Hello struct {
+	Who string
+}
+
+type HelloResponse struct {
+	Greeting string
+}
\ No newline at end of file
@@ -0,0 +1,7 @@
+module github.com/demula/mono-example/cli
+
+go 1.24.6
+
+require github.com/demula/mono-example/core v0.10.2-alpha.2
+
+require github.com/demula/mono-example/api v0.10.2-alpha.2 // indirect
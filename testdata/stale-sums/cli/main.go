@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/demula/mono-example/core"
+)
+
+func main() {
+	fmt.Println(core.SayYou())
+}
\ No newline at end of file
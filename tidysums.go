@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+)
+
+const tidySumsUsage = "" +
+	`Running on the root of your monorepo to remove go.sum entries of monorepo
+modules that are no longer required:
+	mono tidy-sums
+
+Specify the root of your monorepo when not in current directory :
+	mono tidy-sums --context="./testdata"
+
+You can skip writing any files by using --dry-run:
+	mono tidy-sums --dry-run
+
+The changes are printed as a unified diff instead, or side by side with
+--diff=side-by-side. Save them as a patch for "git apply" with:
+	mono tidy-sums --dry-run --patch-out="tidy-sums.patch"
+
+Entries of modules outside the monorepo are left for the go command to manage.
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+var tidySumsCommand = &subcommand{
+	Name:          "tidy-sums",
+	Summary:       "remove the go.sum entries of modules no longer required",
+	Usage:         tidySumsUsage,
+	FlagsComplete: map[string]completer{"diff": completeValues(diffUnified, diffSideBySide)},
+	Flags: func(fs *flag.FlagSet) builder {
+		var (
+			isDryRun  = fs.Bool("dry-run", false, "skip writing to files")
+			diffStyle = fs.String("diff", diffUnified, "diff style of --dry-run: unified or side-by-side")
+			patchOut  = fs.String("patch-out", "", "write the --dry-run changes as a git patch to the given file")
+		)
+		return func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+			dryRun, err := parseDryRun(*isDryRun, *diffStyle, *patchOut)
+			if err != nil {
+				return nil, err
+			}
+			return TidySumsCmd(g.ContextDir, dryRun, g.IsDebug, flags, args), nil
+		}
+	},
+}
+
+func TidySumsCmd(
+	contextDir string,
+	dryRun *dryRun,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "tidy-sums",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			// changes are only written once all of them are calculated
+			fsys := vfs.NewOverlay(os.DirFS(contextDir))
+			err := tidySums(fsys, siblingGoMods(contextDir), false)
+			if err != nil {
+				if errors.Is(err, ErrNoModulesFound) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			if dryRun != nil {
+				return dryRun.preview(contextDir, fsys, os.Stdout)
+			}
+			return fsys.Commit(vfs.Dir(contextDir))
+		},
+	}
+}
+
+func tidySums(fsys vfs.FS, goMods modules.GoModAt, isDryRun bool) error {
+	if isDryRun {
+		// changes are calculated in memory and never written
+		fsys = vfs.NewOverlay(fsys)
+	}
+	ms, err := modules.All(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return ErrNoModulesFound
+	}
+	modules.FetchDirectDeps(ms)
+	for _, m := range ms {
+		removed := modules.PruneSums(m, ms, goMods)
+		if len(removed) == 0 {
+			continue
+		}
+		err = modules.WriteGoSum(m)
+		if err != nil {
+			return fmt.Errorf("failed to update %q go.sum: %w", m.Dir(), err)
+		}
+		slog.Info("module go.sum pruned",
+			slog.String("module", m.Path()),
+			slog.String("file", path.Join(m.Dir(), "go.sum")),
+			slog.Int("removed", len(removed)),
+		)
+	}
+	slog.Info("all modules tidied")
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/demula/mono/vfs"
+)
+
+func TestTidySums(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		context  string
+		isDryRun bool
+		expected string
+	}{
+		{
+			name:     "with stale sibling sums",
+			context:  "./testdata/stale-sums/",
+			expected: "./testdata/prev-release/",
+		},
+		{
+			name:     "with stale sibling sums and dry-run",
+			context:  "./testdata/stale-sums/",
+			isDryRun: true,
+			expected: "./testdata/stale-sums/",
+		},
+		{
+			name:     "without stale sibling sums",
+			context:  "./testdata/prev-release/",
+			expected: "./testdata/prev-release/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual := vfs.NewOverlay(os.DirFS(tt.context))
+			err := tidySums(actual, nil, tt.isDryRun)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			assertAgainstGoldenTemplate(t, actual, tt.expected)
+		})
+	}
+}
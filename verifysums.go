@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+)
+
+const verifySumsUsage = "" +
+	`Running on the root of your monorepo to verify the go.sum entries of the
+siblings against the checksum database, and that their tags were not moved
+after publication:
+	mono verify-sums
+
+Specify the root of your monorepo when not in current directory :
+	mono verify-sums --context="./testdata"
+
+The checksum database and the modules left out of it are the ones of the go
+command, GOSUMDB and GONOSUMDB (or GOPRIVATE). Nothing is verified when
+GOSUMDB is off. Use another database, in the GOSUMDB format, with:
+	mono verify-sums --sumdb="sum.example.com+1234abcd+AW... https://sum.example.com"
+
+Every problem found is reported with its file:
+	core/go.sum: example.com/mono/api v0.1.0: go.sum has h1:..., sum.golang.org has h1:...
+	api/v0.1.0: example.com/mono/api v0.1.0: tag tree hashes to h1:..., sum.golang.org has h1:...
+
+Versions not yet in the checksum database are skipped.
+
+See https://github.com/demula/mono for
+examples on how to use it.
+`
+
+// knownSumDBs are the verifier keys of the public checksum databases.
+var knownSumDBs = map[string]string{
+	"sum.golang.org":       "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8",
+	"sum.golang.google.cn": "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8",
+}
+
+var ErrVerifyFailed = errors.New("verification failed")
+
+var verifySumsCommand = &subcommand{
+	Name:    "verify-sums",
+	Summary: "verify the sibling go.sum entries against the checksum database",
+	Usage:   verifySumsUsage,
+	Flags: func(fs *flag.FlagSet) builder {
+		db := fs.String("sumdb", "", "checksum database in the GOSUMDB format, GOSUMDB by default")
+		return func(g globals, flags *flag.FlagSet, args []string) (*Command, error) {
+			if *db != "" && *db != "off" {
+				_, _, err := parseSumDB(*db)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return VerifySumsCmd(g.ContextDir, *db, g.IsDebug, flags, args), nil
+		}
+	},
+}
+
+func VerifySumsCmd(
+	contextDir string,
+	db string,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "verify-sums",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			vars, err := localEnvironment(contextDir).GoEnv("GOSUMDB", "GONOSUMDB")
+			if err != nil {
+				return err
+			}
+			if db == "" {
+				db = vars["GOSUMDB"]
+			}
+			if db == "off" {
+				slog.Warn("checksum database verification disabled", slog.String("sumdb", db))
+				return nil
+			}
+			key, url, err := parseSumDB(db)
+			if err != nil {
+				return err
+			}
+			h, err := gitHistory(contextDir)
+			if err != nil {
+				return err
+			}
+			csdb := newChecksumDB(key, url, http.DefaultClient, vars["GONOSUMDB"])
+			problems, err := verifySums(vfs.Dir(contextDir), h, csdb)
+			if err != nil {
+				if errors.Is(err, ErrNoModulesFound) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			for _, p := range problems {
+				_, err = fmt.Fprintln(os.Stdout, p)
+				if err != nil {
+					return err
+				}
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("%w: %d problems found", ErrVerifyFailed, len(problems))
+			}
+			slog.Info("all go.sum entries verified", slog.String("sumdb", csdb.Name))
+			return nil
+		},
+	}
+}
+
+// parseSumDB returns the verifier key and URL of a checksum database in the
+// GOSUMDB format: a known name, or a key optionally followed by its URL.
+func parseSumDB(db string) (string, string, error) {
+	fields := strings.Fields(db)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", "", fmt.Errorf("%w. invalid checksum database %q", ErrInput, db)
+	}
+	key := fields[0]
+	name, _, hasKey := strings.Cut(key, "+")
+	if !hasKey {
+		known, ok := knownSumDBs[key]
+		if !ok {
+			return "", "", fmt.Errorf("%w. unknown checksum database %q, give its key", ErrInput, db)
+		}
+		key = known
+	}
+	url := "https://" + name
+	if len(fields) == 2 {
+		url = strings.TrimSuffix(fields[1], "/")
+	}
+	return key, url, nil
+}
+
+// checksumDB looks up the go.sum lines published in a checksum database.
+type checksumDB struct {
+	Name   string
+	ops    *sumdbOps
+	client *sumdb.Client
+}
+
+// newChecksumDB returns the checksum database with the verifier key served
+// at url. Modules matching the noSumDB patterns are not looked up.
+func newChecksumDB(key, url string, client *http.Client, noSumDB string) *checksumDB {
+	ops := &sumdbOps{
+		key:      key,
+		url:      url,
+		http:     client,
+		config:   make(map[string][]byte),
+		cache:    make(map[string][]byte),
+		notFound: make(map[string]bool),
+	}
+	c := sumdb.NewClient(ops)
+	c.SetGONOSUMDB(noSumDB)
+	name, _, _ := strings.Cut(key, "+")
+	return &checksumDB{Name: name, ops: ops, client: c}
+}
+
+// Lookup returns the published hash of the module version, that may end in
+// "/go.mod". It is empty when the version is not published and it fails with
+// sumdb.ErrGONOSUMDB for modules left out of the database.
+func (db *checksumDB) Lookup(modPath, version string) (string, error) {
+	lines, err := db.client.Lookup(modPath, version)
+	if err != nil {
+		if db.ops.isNotFound(modPath, strings.TrimSuffix(version, "/go.mod")) {
+			return "", nil
+		}
+		return "", err
+	}
+	for _, line := range lines {
+		if f := strings.Fields(line); len(f) == 3 {
+			return f[2], nil
+		}
+	}
+	return "", nil
+}
+
+// sumdbOps keeps the checksum database state in memory for a single run.
+type sumdbOps struct {
+	key  string
+	url  string
+	http *http.Client
+
+	mu       sync.Mutex
+	config   map[string][]byte
+	cache    map[string][]byte
+	notFound map[string]bool
+}
+
+func (o *sumdbOps) ReadRemote(remote string) ([]byte, error) {
+	resp, err := o.http.Get(o.url + remote)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		o.mu.Lock()
+		o.notFound[remote] = true
+		o.mu.Unlock()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s%s: %s", o.url, remote, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (o *sumdbOps) isNotFound(modPath, version string) bool {
+	epath, err := module.EscapePath(modPath)
+	if err != nil {
+		return false
+	}
+	evers, err := module.EscapeVersion(version)
+	if err != nil {
+		return false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.notFound["/lookup/"+epath+"@"+evers]
+}
+
+func (o *sumdbOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(o.key), nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// an empty latest tree is the first run
+	return o.config[file], nil
+}
+
+func (o *sumdbOps) WriteConfig(file string, old, new []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !bytes.Equal(o.config[file], old) {
+		return sumdb.ErrWriteConflict
+	}
+	o.config[file] = new
+	return nil
+}
+
+func (o *sumdbOps) ReadCache(file string) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	data, ok := o.cache[file]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return data, nil
+}
+
+func (o *sumdbOps) WriteCache(file string, data []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.cache[file] = data
+}
+
+func (o *sumdbOps) Log(msg string) {
+	slog.Debug(msg, slog.String("sumdb", o.url))
+}
+
+func (o *sumdbOps) SecurityError(msg string) {
+	slog.Error(msg, slog.String("sumdb", o.url))
+}
+
+// verifySums returns the go.sum entries of siblings in fsys that differ from
+// the published ones and the tags whose tree no longer hashes to them.
+func verifySums(fsys vfs.FS, h history, db *checksumDB) ([]string, error) {
+	ms, err := modules.All(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monorepo modules: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, ErrNoModulesFound
+	}
+	siblings := make(map[string]*modules.Module)
+	for _, m := range ms {
+		siblings[m.Path()] = m
+	}
+	var required []module.Version
+	for _, m := range ms {
+		for v := range m.Sums {
+			sv := module.Version{Path: v.Path, Version: strings.TrimSuffix(v.Version, "/go.mod")}
+			if siblings[v.Path] != nil && !slices.Contains(required, sv) {
+				required = append(required, sv)
+			}
+		}
+	}
+	slices.SortFunc(required, func(a, b module.Version) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	var problems []string
+	for _, r := range required {
+		d := siblings[r.Path]
+		for _, version := range []string{r.Version, r.Version + "/go.mod"} {
+			published, err := db.Lookup(r.Path, version)
+			if errors.Is(err, sumdb.ErrGONOSUMDB) {
+				slog.Debug("module left out of the checksum database", slog.String("module", r.Path))
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up %s %s: %w", r.Path, version, err)
+			}
+			if published == "" {
+				slog.Info("version not in the checksum database",
+					slog.String("module", r.Path),
+					slog.String("version", version),
+				)
+				break
+			}
+			for _, m := range ms {
+				sums, ok := m.Sums[module.Version{Path: r.Path, Version: version}]
+				if ok && !slices.Contains(sums, published) {
+					problems = append(problems, fmt.Sprintf("%s: %s %s: go.sum has %s, %s has %s",
+						path.Join(m.Dir(), "go.sum"), r.Path, version, sums[0], db.Name, published))
+				}
+			}
+			tag, tagged, err := taggedHash(h, d, r.Version, strings.HasSuffix(version, "/go.mod"))
+			if err != nil {
+				return nil, err
+			}
+			if tag != "" && tagged != published {
+				problems = append(problems, fmt.Sprintf("%s: %s %s: tag tree hashes to %s, %s has %s",
+					tag, r.Path, version, tagged, db.Name, published))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// taggedHash returns the tag of module m at version and the hash of its tree,
+// of its go.mod file when isGoMod. The tag is empty when there is none.
+func taggedHash(h history, m *modules.Module, version string, isGoMod bool) (string, string, error) {
+	tag := versionTag(h.Tags, m, version)
+	if tag == "" {
+		return "", "", nil
+	}
+	if isGoMod {
+		old, err := h.Archive(tag)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read monorepo at %q: %w", tag, err)
+		}
+		data, err := fs.ReadFile(old, path.Join(m.FileName, "go.mod"))
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read %q go.mod at %q: %w", m.Dir(), tag, err)
+		}
+		hash, err := modules.GoModHash(data)
+		return tag, hash, err
+	}
+	files, err := taggedManifest(h, tag, m.Path(), version)
+	if err != nil || files == nil {
+		return "", "", err
+	}
+	return tag, modules.ManifestHash(files), nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/rand"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestVerifySums(t *testing.T) {
+	t.Parallel()
+
+	const (
+		api     = "github.com/demula/mono-example/api"
+		core    = "github.com/demula/mono-example/core"
+		version = "v0.10.2-alpha.2"
+		apiHash = "h1:B7OtoTidl8/NrdyKqGgY5qhwpFCET0tZXeP9rBJERyQ="
+		apiMod  = "h1:D5a3K3mt3F4Pl63UfTUNn+mGZzzT4OpD0xi2bhJCeqU="
+		movedH1 = "h1:DmFUhwzq4loJyq5UPKESKNmfp1bHB5eqBhbJE9Hv2sA="
+	)
+	coreSums := "" +
+		core + " " + version + " h1:Bv2S2WBUVGUrO63+nj4BRQJdeadScjWskQuYYRoz4UE=\n" +
+		core + " " + version + "/go.mod h1:fQr5/2t+JxOT76eNI9ozVokbgtHIhRXG93iQl8qEqSM=\n"
+	apiSums := api + " " + version + " " + apiHash + "\n" + api + " " + version + "/go.mod " + apiMod + "\n"
+	tags := []string{"api/" + version, "core/" + version}
+
+	tests := []struct {
+		name      string
+		published map[string]string
+		tags      []string
+		noSumDB   string
+		expected  []string
+	}{
+		{
+			name:      "published as in go.sum",
+			published: map[string]string{api: apiSums, core: coreSums},
+			tags:      tags,
+		},
+		{
+			name: "tag moved after publication",
+			published: map[string]string{
+				api:  api + " " + version + " " + movedH1 + "\n" + api + " " + version + "/go.mod " + apiMod + "\n",
+				core: coreSums,
+			},
+			tags: tags,
+			expected: []string{
+				"cli/go.sum: " + api + " " + version + ": go.sum has " + apiHash + ", localhost.localdev has " + movedH1,
+				"core/go.sum: " + api + " " + version + ": go.sum has " + apiHash + ", localhost.localdev has " + movedH1,
+				"server/go.sum: " + api + " " + version + ": go.sum has " + apiHash + ", localhost.localdev has " + movedH1,
+				"api/" + version + ": " + api + " " + version + ": tag tree hashes to " + apiHash + ", localhost.localdev has " + movedH1,
+			},
+		},
+		{
+			name: "published without tags",
+			published: map[string]string{
+				api:  api + " " + version + " " + movedH1 + "\n" + api + " " + version + "/go.mod " + apiMod + "\n",
+				core: coreSums,
+			},
+			noSumDB: core,
+			expected: []string{
+				"cli/go.sum: " + api + " " + version + ": go.sum has " + apiHash + ", localhost.localdev has " + movedH1,
+				"core/go.sum: " + api + " " + version + ": go.sum has " + apiHash + ", localhost.localdev has " + movedH1,
+				"server/go.sum: " + api + " " + version + ": go.sum has " + apiHash + ", localhost.localdev has " + movedH1,
+			},
+		},
+		{
+			name:      "left out of the checksum database",
+			published: map[string]string{api: "", core: ""},
+			tags:      tags,
+			noSumDB:   "github.com/demula/*",
+		},
+		{
+			name:      "not published",
+			published: map[string]string{},
+			tags:      tags,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			skey, vkey, err := note.GenerateKey(rand.Reader, "localhost.localdev")
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			srv := httptest.NewServer(sumdb.NewServer(sumdb.NewTestServer(skey, func(path, vers string) ([]byte, error) {
+				sums, ok := tt.published[path]
+				if !ok {
+					return nil, fs.ErrNotExist
+				}
+				return []byte(sums), nil
+			})))
+			t.Cleanup(srv.Close)
+
+			h := history{
+				Tags: tt.tags,
+				Archive: func(rev string) (fs.FS, error) {
+					return os.DirFS("./testdata/prev-release/"), nil
+				},
+			}
+			db := newChecksumDB(vkey, srv.URL, srv.Client(), tt.noSumDB)
+			actual, err := verifySums(vfs.Dir("./testdata/prev-release/"), h, db)
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("expected problems:\n%q\ngot:\n%q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseSumDB(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		db     string
+		key    string
+		url    string
+		errMsg string
+	}{
+		{
+			db:  "sum.golang.org",
+			key: knownSumDBs["sum.golang.org"],
+			url: "https://sum.golang.org",
+		},
+		{
+			db:  "sum.example.com+1234abcd+AW",
+			key: "sum.example.com+1234abcd+AW",
+			url: "https://sum.example.com",
+		},
+		{
+			db:  "sum.example.com+1234abcd+AW https://proxy.example.com/sumdb/sum.example.com/",
+			key: "sum.example.com+1234abcd+AW",
+			url: "https://proxy.example.com/sumdb/sum.example.com",
+		},
+		{
+			db:     "sum.example.com",
+			errMsg: `input error. unknown checksum database "sum.example.com", give its key`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.db, func(t *testing.T) {
+			t.Parallel()
+
+			key, url, err := parseSumDB(tt.db)
+			if tt.errMsg != "" {
+				if err == nil || err.Error() != tt.errMsg {
+					t.Fatalf("expected error %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			if key != tt.key || url != tt.url {
+				t.Errorf("expected %q %q, got %q %q", tt.key, tt.url, key, url)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Package vfs holds the filesystem abstractions used to read and write the
+// monorepo files.
+//
+// Names follow the io/fs conventions: slash separated paths relative to the
+// root of the filesystem.
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing/fstest"
+	"time"
+)
+
+// Writer writes files.
+type Writer interface {
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// FS is a filesystem that can also be written to.
+type FS interface {
+	fs.FS
+	Writer
+}
+
+// Dir returns an FS for the tree of files rooted at the operating system
+// directory dir.
+func Dir(dir string) FS {
+	return &dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+func (d *dirFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.WriteFile(filepath.Join(d.dir, filepath.FromSlash(name)), data, perm)
+}
+
+// Overlay is an FS that keeps written files in memory on top of a read-only
+// base filesystem. Reads return the written content when there is one.
+type Overlay struct {
+	base  fs.FS
+	files fstest.MapFS
+}
+
+// NewOverlay returns an empty overlay on top of base.
+func NewOverlay(base fs.FS) *Overlay {
+	return &Overlay{base: base, files: fstest.MapFS{}}
+}
+
+func (o *Overlay) Open(name string) (fs.File, error) {
+	if _, ok := o.files[name]; ok {
+		return o.files.Open(name)
+	}
+	f, err := o.base.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		// directories holding only written files
+		return o.files.Open(name)
+	}
+	return f, err
+}
+
+// ReadDir merges the base directory entries with the written files.
+func (o *Overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	base, baseErr := fs.ReadDir(o.base, name)
+	if baseErr != nil && !errors.Is(baseErr, fs.ErrNotExist) {
+		return nil, baseErr
+	}
+	written, err := fs.ReadDir(o.files, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if baseErr != nil && err != nil {
+		return nil, baseErr
+	}
+	entries := slices.Clone(base)
+	for _, w := range written {
+		i := slices.IndexFunc(entries, func(e fs.DirEntry) bool {
+			return e.Name() == w.Name()
+		})
+		if i < 0 {
+			entries = append(entries, w)
+		} else if !w.IsDir() {
+			entries[i] = w
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+func (o *Overlay) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	o.files[name] = &fstest.MapFile{
+		Data:    slices.Clone(data),
+		Mode:    perm,
+		ModTime: time.Now(),
+	}
+	return nil
+}
+
+// Changes returns the names of the written files sorted.
+func (o *Overlay) Changes() []string {
+	names := make([]string, 0, len(o.files))
+	for name := range o.files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Commit writes every written file into w.
+func (o *Overlay) Commit(w Writer) error {
+	for _, name := range o.Changes() {
+		f := o.files[name]
+		err := w.WriteFile(name, f.Data, f.Mode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Original returns the content of name in the base filesystem, ignoring the
+// written files. New files return an fs.ErrNotExist error.
+func (o *Overlay) Original(name string) ([]byte, error) {
+	return fs.ReadFile(o.base, name)
+}
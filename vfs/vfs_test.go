@@ -0,0 +1,100 @@
+package vfs_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/demula/mono/vfs"
+)
+
+func TestOverlay(t *testing.T) {
+	t.Parallel()
+
+	base := fstest.MapFS{
+		"api/go.mod":  {Data: []byte("module example.com/api\n")},
+		"core/go.mod": {Data: []byte("module example.com/core\n")},
+	}
+	o := vfs.NewOverlay(base)
+
+	err := o.WriteFile("api/go.mod", []byte("module example.com/api/v2\n"), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	err = o.WriteFile("cli/go.mod", []byte("module example.com/cli\n"), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	err = o.WriteFile("../go.mod", nil, 0644)
+	if err == nil {
+		t.Errorf("expected error writing outside of the filesystem")
+	}
+
+	data, err := fs.ReadFile(o, "api/go.mod")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if string(data) != "module example.com/api/v2\n" {
+		t.Errorf("written file not read, got %q", data)
+	}
+	data, err = fs.ReadFile(base, "api/go.mod")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if string(data) != "module example.com/api\n" {
+		t.Errorf("base file modified, got %q", data)
+	}
+	data, err = o.Original("api/go.mod")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if string(data) != "module example.com/api\n" {
+		t.Errorf("unexpected original content %q", data)
+	}
+	_, err = o.Original("cli/go.mod")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist error for a new file, got %v", err)
+	}
+
+	entries, err := fs.ReadDir(o, ".")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !slices.Equal(names, []string{"api", "cli", "core"}) {
+		t.Errorf("unexpected root entries %v", names)
+	}
+
+	changes := o.Changes()
+	if !slices.Equal(changes, []string{"api/go.mod", "cli/go.mod"}) {
+		t.Errorf("unexpected changes %v", changes)
+	}
+
+	dir := t.TempDir()
+	err = os.Mkdir(filepath.Join(dir, "api"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(dir, "cli"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.Commit(vfs.Dir(dir))
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "cli", "go.mod"))
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	if string(data) != "module example.com/cli\n" {
+		t.Errorf("unexpected committed content %q", data)
+	}
+}
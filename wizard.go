@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/demula/mono/git"
+	"github.com/demula/mono/modules"
+	"github.com/demula/mono/mono"
+	"github.com/demula/mono/vfs"
+	"golang.org/x/mod/semver"
+)
+
+// ANSI styles of the wizard on terminals.
+const (
+	styleBold  = "\x1b[1m"
+	styleDim   = "\x1b[2m"
+	styleGreen = "\x1b[32m"
+	styleReset = "\x1b[0m"
+)
+
+// wizard asks the release questions one per line so the answers can be
+// scripted through stdin. Questions are styled on terminals and plain text
+// otherwise, and answers not typed on a terminal are echoed so the output
+// reads as a dialog.
+type wizard struct {
+	in       *bufio.Reader
+	out      io.Writer
+	isStyled bool
+	isEcho   bool
+}
+
+func newWizard(in io.Reader, out io.Writer) *wizard {
+	f, ok := in.(*os.File)
+	return &wizard{
+		in:       bufio.NewReader(in),
+		out:      out,
+		isStyled: isTerminal(out) && os.Getenv("NO_COLOR") == "",
+		isEcho:   !ok || !isTerminal(f),
+	}
+}
+
+// releaseChoice is the release answered to the wizard.
+type releaseChoice struct {
+	// Modules to tag in release order.
+	Modules []*modules.Module
+	Version string
+}
+
+func ReleaseWizardCmd(
+	contextDir string,
+	version string,
+	fromGit string,
+	isAllFiles bool,
+	commit *releaseCommit,
+	preview *dryRun,
+	isDryRun bool,
+	guard *releaseGuard,
+	in io.Reader,
+	out io.Writer,
+	isDebug bool,
+	flags *flag.FlagSet,
+	args []string,
+) *Command {
+	return &Command{
+		Name:  "release",
+		Flags: flags,
+		Args:  args,
+		Run: func() error {
+			debug(isDebug, flags, args)
+			w := newWizard(in, out)
+			base, err := releaseBase(contextDir, fromGit, isAllFiles)
+			if err != nil {
+				return err
+			}
+			ws, err := mono.Load(vfs.NewOverlay(base), nil)
+			if err != nil {
+				if errors.Is(err, mono.ErrNoModules) {
+					return fmt.Errorf("%w: no modules found at %q", ErrInput, contextDir)
+				}
+				return err
+			}
+			h, err := gitHistory(contextDir)
+			if err != nil {
+				return err
+			}
+			ss, err := next(vfs.NewOverlay(base), h)
+			if err != nil {
+				return err
+			}
+			var released map[string][]string
+			if guard != nil {
+				released, err = guard.released(contextDir, ws.Modules)
+				if err != nil {
+					return err
+				}
+			}
+			choice, err := w.choose(ws.Modules, ss, released, version)
+			if err != nil {
+				return err
+			}
+
+			names := make([]string, 0, len(choice.Modules))
+			for _, m := range choice.Modules {
+				names = append(names, m.FileName)
+			}
+			fsys := vfs.NewOverlay(base)
+			err = releaseModules(fsys, choice.Version, names, h.goMods(), false)
+			if err != nil {
+				return err
+			}
+			w.printf("\n%s\n", w.style(styleBold, "Changes:"))
+			err = preview.preview(contextDir, fsys, out)
+			if err != nil {
+				return err
+			}
+			if isDryRun {
+				return nil
+			}
+			tags := make([]string, 0, len(choice.Modules))
+			for _, m := range choice.Modules {
+				tags = append(tags, moduleTag(m, choice.Version))
+			}
+			ok, err := w.confirm(fmt.Sprintf("Apply, commit and tag %s?", strings.Join(tags, ", ")))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				w.printf("Release cancelled, nothing was written.\n")
+				return nil
+			}
+
+			err = checkClean(contextDir)
+			if err != nil {
+				return err
+			}
+			err = fsys.Commit(vfs.Dir(contextDir))
+			if err != nil {
+				return err
+			}
+			err = commitRelease(contextDir, choice.Version, fsys.Changes(), commit)
+			if err != nil {
+				return err
+			}
+			prefix, err := git.Prefix(contextDir)
+			if err != nil {
+				return err
+			}
+			for i, t := range tags {
+				tags[i] = prefix + t
+				err = git.Tag(contextDir, tags[i], commit.IsSign)
+				if err != nil {
+					return fmt.Errorf("failed to tag release: %w", err)
+				}
+				slog.Info("release tagged", slog.String("tag", tags[i]))
+			}
+			w.printf("%s Push the release with:\n\tgit push origin HEAD %s\n",
+				w.style(styleGreen, "Released."), strings.Join(tags, " "))
+			return nil
+		},
+	}
+}
+
+// choose shows the modules in release order with their suggested versions
+// and asks which ones to release and at which version. version is the
+// suggested one, if given. Versions already released for the chosen modules
+// are refused, unless released is nil.
+func (w *wizard) choose(
+	ms []*modules.Module,
+	ss []*suggestion,
+	released map[string][]string,
+	version string,
+) (*releaseChoice, error) {
+	suggested := make(map[string]*suggestion, len(ss))
+	for _, s := range ss {
+		suggested[s.Module] = s
+	}
+	w.printf("%s\n", w.style(styleBold, "Modules in release order:"))
+	tw := tabwriter.NewWriter(w.out, 0, 8, 2, ' ', 0)
+	w.fprintf(tw, "\t#\tDIR\tMODULE\tLATEST\tNEXT\tREQUIRES\n")
+	for i, m := range ms {
+		latest, next := "-", "-"
+		if s, ok := suggested[m.Path()]; ok {
+			if s.Previous != "" {
+				latest = s.Previous
+			}
+			next = s.Version + " (" + s.Bump + ")"
+		}
+		var requires []string
+		for _, d := range m.Deps {
+			requires = append(requires, d.FileName)
+		}
+		if len(requires) == 0 {
+			requires = []string{"-"}
+		}
+		w.fprintf(tw, "\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			i+1, m.FileName, m.Path(), latest, next, strings.Join(requires, ", "))
+	}
+	_ = tw.Flush()
+
+	var selected []*modules.Module
+	_, err := w.ask("Modules to release (numbers or directories)", "all", func(answer string) error {
+		selected = nil
+		if answer == "all" {
+			selected = ms
+			return nil
+		}
+		for _, f := range strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == ' ' }) {
+			m := pickModule(ms, f)
+			if m == nil {
+				return fmt.Errorf("unknown module %q", f)
+			}
+			selected = append(selected, m)
+		}
+		if len(selected) == 0 {
+			return errors.New("no module selected")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	chosen := requiredModules(ms, selected)
+	if len(chosen) > len(selected) {
+		var added []string
+		for _, m := range chosen {
+			if !slices.Contains(selected, m) {
+				added = append(added, m.FileName)
+			}
+		}
+		w.printf("Also releasing %s, required by the selected modules.\n", strings.Join(added, ", "))
+	}
+
+	if version == "" {
+		for _, m := range chosen {
+			s, ok := suggested[m.Path()]
+			if ok && (version == "" || semver.Compare(s.Version, version) > 0) {
+				version = s.Version
+			}
+		}
+	}
+	isFree := func(v string) error {
+		if released == nil {
+			return nil
+		}
+		return checkVersion(chosen, released, v)
+	}
+	if isFree(version) != nil {
+		// i.e. nothing changed since the latest release
+		latest := ""
+		for _, m := range chosen {
+			if vs := released[m.Path()]; len(vs) > 0 && semver.Compare(vs[len(vs)-1], latest) > 0 {
+				latest = vs[len(vs)-1]
+			}
+		}
+		version = nextFreeVersion(latest)
+	}
+	version, err = w.ask("Version", version, func(answer string) error {
+		if !semver.IsValid(answer) || semver.Canonical(answer) != answer {
+			return fmt.Errorf("invalid version %q, i.e. v1.2.3 or v1.2.3-rc.1", answer)
+		}
+		return isFree(answer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if semver.Prerelease(version) == "" {
+		id, err := w.ask("Pre-release identifier, i.e. rc.1 (empty for none)", "", func(answer string) error {
+			if answer == "" {
+				return nil
+			}
+			if !semver.IsValid(version + "-" + answer) {
+				return fmt.Errorf("invalid pre-release identifier %q", answer)
+			}
+			return isFree(version + "-" + answer)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if id != "" {
+			version += "-" + id
+		}
+	}
+	return &releaseChoice{Modules: chosen, Version: version}, nil
+}
+
+// pickModule returns the module of ms with the given list number, directory
+// or module path.
+func pickModule(ms []*modules.Module, name string) *modules.Module {
+	if i, err := strconv.Atoi(name); err == nil {
+		if i < 1 || i > len(ms) {
+			return nil
+		}
+		return ms[i-1]
+	}
+	for _, m := range ms {
+		if m.FileName == name || m.Dir() == name || m.Path() == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// requiredModules returns the selected modules with every sibling they
+// require, as they get the new version too, in the order of ms.
+func requiredModules(ms, selected []*modules.Module) []*modules.Module {
+	required := make(map[*modules.Module]bool)
+	var add func(m *modules.Module)
+	add = func(m *modules.Module) {
+		if required[m] {
+			return
+		}
+		required[m] = true
+		for _, d := range m.Deps {
+			add(d)
+		}
+	}
+	for _, m := range selected {
+		add(m)
+	}
+	var found []*modules.Module
+	for _, m := range ms {
+		if required[m] {
+			found = append(found, m)
+		}
+	}
+	return found
+}
+
+// moduleTag returns the tag of the module release, relative to the
+// monorepo root, as the go command expects it.
+func moduleTag(m *modules.Module, version string) string {
+	if m.Dir() == "." || m.Dir() == "" {
+		return version
+	}
+	return m.Dir() + "/" + version
+}
+
+// ask prints the question and reads the answer, the default one when empty.
+// Invalid answers are explained and asked again until the input ends.
+func (w *wizard) ask(question, def string, valid func(string) error) (string, error) {
+	for {
+		prompt := w.style(styleBold, question)
+		if def != "" {
+			prompt += " " + w.style(styleDim, "["+def+"]")
+		}
+		w.printf("%s: ", prompt)
+		line, err := w.in.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			if errors.Is(err, io.EOF) {
+				w.printf("\n")
+				return "", fmt.Errorf("%w. no answer to %q", ErrInput, question)
+			}
+			return "", err
+		}
+		if w.isEcho {
+			w.printf("%s\n", strings.TrimRight(line, "\r\n"))
+		}
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+		err = valid(answer)
+		if err == nil {
+			return answer, nil
+		}
+		w.printf("%s\n", err)
+	}
+}
+
+// confirm asks a yes or no question, no by default.
+func (w *wizard) confirm(question string) (bool, error) {
+	answer, err := w.ask(question+" (y/n)", "n", func(answer string) error {
+		switch strings.ToLower(answer) {
+		case "y", "yes", "n", "no":
+			return nil
+		}
+		return fmt.Errorf("answer y or n")
+	})
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(strings.ToLower(answer), "y"), nil
+}
+
+func (w *wizard) style(style, s string) string {
+	if !w.isStyled {
+		return s
+	}
+	return style + s + styleReset
+}
+
+func (w *wizard) printf(format string, a ...any) {
+	w.fprintf(w.out, format, a...)
+}
+
+func (w *wizard) fprintf(out io.Writer, format string, a ...any) {
+	_, err := fmt.Fprintf(out, format, a...)
+	if err != nil {
+		slog.Error("could not use given output for the release wizard",
+			slog.String("error", err.Error()),
+		)
+	}
+}
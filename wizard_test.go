@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/demula/mono/mono"
+	"github.com/demula/mono/vfs"
+)
+
+func TestWizardChoose(t *testing.T) {
+	t.Parallel()
+
+	ws, err := mono.Load(vfs.NewOverlay(os.DirFS("./testdata/prev-release/")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := []*suggestion{
+		{Module: "github.com/demula/mono-example/api", Previous: "v0.10.2-alpha.2", Version: "v0.11.0", Bump: bumpMinor},
+		{Module: "github.com/demula/mono-example/cli", Previous: "v0.10.2-alpha.2", Version: "v0.10.2", Bump: bumpPatch},
+	}
+	tests := []struct {
+		name     string
+		input    string
+		version  string
+		released map[string][]string
+		expected []string
+		output   []string
+		errMsg   string
+	}{
+		{
+			name:     "defaults",
+			input:    "\n\n\n",
+			expected: []string{"api", "core", "cli", "server", "v0.11.0"},
+			output: []string{
+				"  1  api     github.com/demula/mono-example/api     v0.10.2-alpha.2  v0.11.0 (minor)  -\n",
+				"Modules to release (numbers or directories) [all]: \n",
+				"Version [v0.11.0]: \n",
+			},
+		},
+		{
+			name:     "required siblings and pre-release",
+			input:    "cli\nv0.10.2\nrc.1\n",
+			expected: []string{"api", "core", "cli", "v0.10.2-rc.1"},
+			output:   []string{"Also releasing api, core, required by the selected modules.\n"},
+		},
+		{
+			name:     "invalid answers are asked again",
+			input:    "5\n1 github.com/demula/mono-example/core\nv1.0\nv1.0.0\nrc_1\n\n",
+			expected: []string{"api", "core", "v1.0.0"},
+			output: []string{
+				"unknown module \"5\"\n",
+				"invalid version \"v1.0\", i.e. v1.2.3 or v1.2.3-rc.1\n",
+				"invalid pre-release identifier \"rc_1\"\n",
+			},
+		},
+		{
+			name:     "given pre-release version",
+			input:    "api\n\n",
+			version:  "v0.10.2-beta.1",
+			expected: []string{"api", "v0.10.2-beta.1"},
+		},
+		{
+			name:     "released versions are refused",
+			input:    "\nv0.11.0\n\nrc.1\n",
+			released: map[string][]string{"github.com/demula/mono-example/api": {"v0.10.2-alpha.2", "v0.11.0"}},
+			expected: []string{"api", "core", "cli", "server", "v0.11.1-rc.1"},
+			output: []string{
+				"Version [v0.11.1]: v0.11.0\n",
+				"version already released: api has v0.11.0. release v0.11.1 instead or use --force\n",
+			},
+		},
+		{
+			name:   "input ends",
+			input:  "all\n",
+			errMsg: `input error. no answer to "Version"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			out := &bytes.Buffer{}
+			w := newWizard(strings.NewReader(test.input), out)
+			choice, err := w.choose(ws.Modules, ss, test.released, test.version)
+			if test.errMsg != "" {
+				if err == nil || err.Error() != test.errMsg {
+					t.Fatalf("expected error %q, got %v", test.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %q", err)
+			}
+			var actual []string
+			for _, m := range choice.Modules {
+				actual = append(actual, m.FileName)
+			}
+			actual = append(actual, choice.Version)
+			if !slices.Equal(actual, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+			for _, o := range test.output {
+				if !strings.Contains(out.String(), o) {
+					t.Errorf("expected output to contain %q, got:\n%s", o, out.String())
+				}
+			}
+			if strings.Contains(out.String(), "\x1b[") {
+				t.Errorf("expected plain prompts, got:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestReleaseWizardCmd(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tests := []struct {
+		name     string
+		input    string
+		isDryRun bool
+		tags     []string
+		isCommit bool
+		// untouched modules not chosen
+		untouched []string
+	}{
+		{
+			name:  "released",
+			input: "cli\n\nrc.1\ny\n",
+			tags: []string{
+				"mono/api/v0.10.2-rc.1",
+				"mono/cli/v0.10.2-rc.1",
+				"mono/core/v0.10.2-rc.1",
+				"mono/v0.10.2-alpha.2",
+			},
+			isCommit:  true,
+			untouched: []string{"server"},
+		},
+		{
+			name:  "cancelled",
+			input: "\n\n\nn\n",
+			tags:  []string{"mono/v0.10.2-alpha.2"},
+		},
+		{
+			name:     "dry run",
+			input:    "\n\n\n",
+			isDryRun: true,
+			tags:     []string{"mono/v0.10.2-alpha.2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			contextDir := filepath.Join(dir, "mono")
+			err := os.CopyFS(contextDir, os.DirFS("./testdata/prev-release/"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			gitRun(t, dir, "init", "--quiet")
+			gitRun(t, dir, "config", "user.name", "mono")
+			gitRun(t, dir, "config", "user.email", "mono@example.com")
+			gitRun(t, dir, "config", "commit.gpgSign", "false")
+			gitRun(t, dir, "add", "--all")
+			gitRun(t, dir, "commit", "--quiet", "--message=init")
+			gitRun(t, dir, "tag", "mono/v0.10.2-alpha.2")
+			err = os.WriteFile(filepath.Join(contextDir, "api", "api.go"), []byte("package api\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gitRun(t, dir, "add", "--all")
+			gitRun(t, dir, "commit", "--quiet", "--message=api")
+
+			msg := template.Must(template.New("message").Parse(defaultMessageTemplate))
+			flags := flag.NewFlagSet("release", flag.ContinueOnError)
+			out := &bytes.Buffer{}
+			err = ReleaseWizardCmd(contextDir, "", "", false, &releaseCommit{Message: msg},
+				&dryRun{Style: diffUnified}, test.isDryRun, &releaseGuard{},
+				strings.NewReader(test.input), out, false, flags, nil).Run()
+			if err != nil {
+				t.Fatalf("unexpected error %q, output:\n%s", err, out.String())
+			}
+			if !strings.Contains(out.String(), "diff --git a/mono/cli/go.mod b/mono/cli/go.mod\n") {
+				t.Errorf("expected the diff preview, got:\n%s", out.String())
+			}
+			tags := strings.Fields(gitRun(t, dir, "tag", "--list"))
+			if !slices.Equal(tags, test.tags) {
+				t.Errorf("expected tags %v, got %v", test.tags, tags)
+			}
+			subject := strings.TrimSpace(gitRun(t, dir, "log", "-1", "--format=%s"))
+			if test.isCommit != (subject == "chore(release): v0.10.2-rc.1") {
+				t.Errorf("unexpected last commit %q", subject)
+			}
+			if status := gitRun(t, dir, "status", "--porcelain"); status != "" {
+				t.Errorf("expected a clean tree, got:\n%s", status)
+			}
+			for _, name := range test.untouched {
+				if diff := gitRun(t, dir, "diff", "HEAD~1", "--", "mono/"+name); diff != "" {
+					t.Errorf("expected %s untouched, got:\n%s", name, diff)
+				}
+				if strings.Contains(out.String(), "mono/"+name+"/go.mod") {
+					t.Errorf("expected no %s changes previewed, got:\n%s", name, out.String())
+				}
+			}
+		})
+	}
+}